@@ -0,0 +1,248 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	// indexName 为文件名索引的属性名
+	indexName = "$I30"
+
+	indexEntrySubnode = 0x1
+	indexEntryLast    = 0x2
+
+	// namespaceDOS 为只有 8.3 短文件名的目录项,与对应的长文件名项指向同一记录
+	namespaceDOS = 2
+
+	fileNameFlagDirectory = 0x10000000
+)
+
+// DirEntry 为目录中的一项
+type DirEntry struct {
+	Name   string
+	Record uint64
+	Dir    bool
+	// Size 为目录项中记录的大小,可能不是最新值,准确的大小见 File.Size
+	Size int64
+}
+
+// File 为卷中的一个文件,实现了 io.ReaderAt,读取的是未命名的 $DATA 流
+type File struct {
+	v      *Volume
+	Record uint64
+	Name   string
+	Dir    bool
+	Size   int64
+	data   *attribute
+}
+
+// ReadAt 实现 io.ReaderAt
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.data == nil {
+		return 0, fmt.Errorf("%w: %s 没有 $DATA 属性", registry.ErrNotFound, f.Name)
+	}
+	if off >= f.Size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if rest := f.Size - off; int64(n) > rest {
+		n = int(rest)
+	}
+	if err := f.v.readAttribute(f.data, p[:n], off); err != nil {
+		return 0, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Bytes 读取文件的全部内容
+func (f *File) Bytes() ([]byte, error) {
+	if f.data == nil {
+		return nil, fmt.Errorf("%w: %s 没有 $DATA 属性", registry.ErrNotFound, f.Name)
+	}
+	return f.v.attributeData(f.data)
+}
+
+// Registry 把文件内容作为 hive 读取
+func (f *File) Registry() (*registry.Registry, error) {
+	data, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return registry.NewRegistryFromBytes(data), nil
+}
+
+// openRecord 按记录号打开文件
+func (v *Volume) openRecord(number uint64, name string) (*File, error) {
+	r, err := v.loadRecord(number, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.flags&recordFlagInUse == 0 {
+		return nil, fmt.Errorf("%w: MFT 记录 %d 未被使用", registry.ErrNotFound, number)
+	}
+	f := &File{v: v, Record: number, Name: name, Dir: r.flags&recordFlagDirectory != 0, data: r.find(attrData, "")}
+	if f.data != nil {
+		f.Size = f.data.size
+	}
+	return f, nil
+}
+
+// Open 打开卷中的文件,路径以反斜杠或斜杠分隔,相对于根目录,不区分大小写,
+// 如 Windows\System32\config\SYSTEM
+func (v *Volume) Open(path string) (*File, error) {
+	number := uint64(mftRecordRoot)
+	name := ""
+	for _, part := range splitPath(path) {
+		entries, err := v.readDir(number)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		found := false
+		for _, e := range entries {
+			if strings.EqualFold(e.Name, part) {
+				number, name, found = e.Record, e.Name, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", registry.ErrNotFound, path)
+		}
+	}
+	return v.openRecord(number, name)
+}
+
+// ReadDir 列出目录中的文件,不包括只有 8.3 短文件名的重复项
+func (v *Volume) ReadDir(path string) ([]DirEntry, error) {
+	dir, err := v.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.Dir {
+		return nil, fmt.Errorf("%w: %s 不是目录", registry.ErrTypeMismatch, path)
+	}
+	return v.readDir(dir.Record)
+}
+
+func splitPath(path string) []string {
+	parts := make([]string, 0)
+	for _, p := range strings.FieldsFunc(path, func(r rune) bool { return r == '\\' || r == '/' }) {
+		if p != "." {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// readDir 读取目录的 $INDEX_ROOT 与 $INDEX_ALLOCATION 中的所有目录项,
+// 只读取 $BITMAP 中标记为使用中的索引记录,避免列出已删除文件残留的目录项
+func (v *Volume) readDir(number uint64) ([]DirEntry, error) {
+	r, err := v.loadRecord(number, nil)
+	if err != nil {
+		return nil, err
+	}
+	root := r.find(attrIndexRoot, indexName)
+	if root == nil {
+		return nil, fmt.Errorf("%w: MFT 记录 %d 不是目录", registry.ErrTypeMismatch, number)
+	}
+	if len(root.value) < 0x20 {
+		return nil, fmt.Errorf("%w: MFT 记录 %d 的 $INDEX_ROOT 过短", registry.ErrCorrupt, number)
+	}
+	seen := make(map[uint64]bool)
+	entries := make([]DirEntry, 0)
+	add := func(list []DirEntry) {
+		for _, e := range list {
+			if !seen[e.Record] {
+				seen[e.Record] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	list, err := parseIndexNode(root.value, 0x10)
+	if err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d: %w", number, err)
+	}
+	add(list)
+
+	alloc := r.find(attrIndexAllocation, indexName)
+	if alloc == nil {
+		return entries, nil
+	}
+	if err := v.checkSize(alloc); err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d 的 $INDEX_ALLOCATION: %w", number, err)
+	}
+	size := int(binary.LittleEndian.Uint32(root.value[8:]))
+	if size == 0 {
+		size = v.IndexRecordSize
+	}
+	if size < minIndexRecordSize || size > maxRecordSize {
+		return nil, fmt.Errorf("%w: MFT 记录 %d 的索引记录大小 %d 无效", registry.ErrCorrupt, number, size)
+	}
+	var bitmap []byte
+	if b := r.find(attrBitmap, indexName); b != nil {
+		if bitmap, err = v.attributeData(b); err != nil {
+			return nil, err
+		}
+	}
+	block := make([]byte, size)
+	for i := int64(0); (i+1)*int64(size) <= alloc.size; i++ {
+		if bitmap != nil && (int(i/8) >= len(bitmap) || bitmap[i/8]&(1<<(i%8)) == 0) {
+			continue
+		}
+		if err := v.readAttribute(alloc, block, i*int64(size)); err != nil {
+			return nil, fmt.Errorf("MFT 记录 %d 的索引记录 %d: %w", number, i, err)
+		}
+		if string(block[0:4]) != "INDX" {
+			continue
+		}
+		if err := applyFixup(block, v.BytesPerSector); err != nil {
+			return nil, fmt.Errorf("MFT 记录 %d 的索引记录 %d: %w", number, i, err)
+		}
+		list, err := parseIndexNode(block, 0x18)
+		if err != nil {
+			return nil, fmt.Errorf("MFT 记录 %d 的索引记录 %d: %w", number, i, err)
+		}
+		add(list)
+	}
+	return entries, nil
+}
+
+// parseIndexNode 解析位于 header 处的索引节点头部及其后的目录项,目录项的键为 $FILE_NAME 属性
+func parseIndexNode(b []byte, header int) ([]DirEntry, error) {
+	start := header + int(binary.LittleEndian.Uint32(b[header:]))
+	end := header + int(binary.LittleEndian.Uint32(b[header+4:]))
+	if end > len(b) || start > end {
+		return nil, fmt.Errorf("%w: 索引节点大小无效", registry.ErrCorrupt)
+	}
+	result := make([]DirEntry, 0)
+	for off := start; off+0x10 <= end; {
+		length := int(binary.LittleEndian.Uint16(b[off+8:]))
+		keyLength := int(binary.LittleEndian.Uint16(b[off+0xA:]))
+		flags := b[off+0xC]
+		if flags&indexEntryLast != 0 {
+			break
+		}
+		if length < 0x10 || off+length > end || keyLength < 0x42 || 0x10+keyLength > length {
+			return result, fmt.Errorf("%w: 目录项长度无效", registry.ErrCorrupt)
+		}
+		key := b[off+0x10 : off+0x10+keyLength]
+		nameLength := int(key[0x40])
+		if 0x42+nameLength*2 <= len(key) && key[0x41] != namespaceDOS {
+			result = append(result, DirEntry{
+				Name:   decodeUTF16(key[0x42 : 0x42+nameLength*2]),
+				Record: binary.LittleEndian.Uint64(b[off:]) & fileReferenceMask,
+				Dir:    binary.LittleEndian.Uint32(key[0x38:])&fileNameFlagDirectory != 0,
+				Size:   int64(binary.LittleEndian.Uint64(key[0x30:])),
+			})
+		}
+		off += length
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package ntfs
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	configLocation  = "Windows\\System32\\config"
+	amcacheLocation = "Windows\\AppCompat\\Programs\\Amcache.hve"
+)
+
+// SystemHives 为 config 目录下的 hive 文件名
+var SystemHives = []string{"SAM", "SECURITY", "SOFTWARE", "SYSTEM", "DEFAULT", "COMPONENTS", "DRIVERS"}
+
+// ProfileLocations 为用户配置文件所在的目录,XP 之前为 Documents and Settings
+var ProfileLocations = []string{"Users", "Documents and Settings"}
+
+// UserHives 为用户 hive 相对于配置文件目录的位置
+var UserHives = []string{
+	"NTUSER.DAT",
+	"AppData\\Local\\Microsoft\\Windows\\UsrClass.dat",
+	"Local Settings\\Application Data\\Microsoft\\Windows\\UsrClass.dat",
+}
+
+// LogExtensions 为事务日志的扩展名,Vista 之后为 .LOG1 / .LOG2,之前为 .LOG
+var LogExtensions = []string{".LOG", ".LOG1", ".LOG2"}
+
+// Hive 为从卷中读取的一个 hive 文件及其事务日志
+type Hive struct {
+	// Name 为文件名,如 SYSTEM、NTUSER.DAT、UsrClass.dat
+	Name string
+	// Path 为在卷中的路径
+	Path string
+	// User 为用户 hive 所在的配置文件目录名,其他 hive 为空
+	User     string
+	Size     int64
+	Registry *registry.Registry
+	// Logs 为同目录下的事务日志内容,键为扩展名,如 .LOG1
+	Logs map[string][]byte
+}
+
+// OpenHive 读取 path 处的 hive 及其同名的事务日志
+func (v *Volume) OpenHive(path string) (*Hive, error) {
+	f, err := v.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	hive := &Hive{
+		Name:     f.Name,
+		Path:     path,
+		Size:     f.Size,
+		Registry: registry.NewRegistryFromBytes(data),
+		Logs:     make(map[string][]byte),
+	}
+	for _, ext := range LogExtensions {
+		log, err := v.Open(path + ext)
+		if err != nil {
+			continue
+		}
+		if data, err := log.Bytes(); err == nil {
+			hive.Logs[ext] = data
+		}
+	}
+	return hive, nil
+}
+
+// Hives 读取卷中所有标准位置的 hive:config 目录下的系统 hive、每个用户的 NTUSER.DAT 与
+// UsrClass.dat 以及 Amcache.hve。不存在的文件会被跳过,其他错误合并后返回
+func (v *Volume) Hives() ([]*Hive, error) {
+	result := make([]*Hive, 0)
+	var errs []error
+	open := func(path, user string) {
+		hive, err := v.OpenHive(path)
+		if errors.Is(err, registry.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		hive.User = user
+		result = append(result, hive)
+	}
+	for _, name := range SystemHives {
+		open(configLocation+"\\"+name, "")
+	}
+	for _, location := range ProfileLocations {
+		users, err := v.ReadDir(location)
+		if err != nil {
+			if !errors.Is(err, registry.ErrNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, u := range users {
+			if !u.Dir {
+				continue
+			}
+			for _, name := range UserHives {
+				open(strings.Join([]string{location, u.Name, name}, "\\"), u.Name)
+			}
+		}
+	}
+	open(amcacheLocation, "")
+	return result, errors.Join(errs...)
+}
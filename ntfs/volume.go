@@ -0,0 +1,503 @@
+// Package ntfs 直接从 NTFS 卷的原始镜像中读取文件,用于在不挂载镜像的情况下
+// 取出 config 目录下的 hive、事务日志以及用户的 NTUSER.DAT / UsrClass.dat 与 Amcache.hve
+package ntfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"unicode/utf16"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+var (
+	// ErrNotNTFS 数据不是 NTFS 卷
+	ErrNotNTFS = errors.New("不是 NTFS 卷")
+	// ErrUnsupported 文件使用了不支持的存储方式,如压缩或加密
+	ErrUnsupported = errors.New("不支持的 NTFS 文件存储方式")
+)
+
+// 属性类型
+const (
+	attrStandardInformation = 0x10
+	attrAttributeList       = 0x20
+	attrFileName            = 0x30
+	attrData                = 0x80
+	attrIndexRoot           = 0x90
+	attrIndexAllocation     = 0xA0
+	attrBitmap              = 0xB0
+	attrEnd                 = 0xFFFFFFFF
+)
+
+const (
+	mftRecordMFT  = 0
+	mftRecordRoot = 5
+
+	recordFlagInUse     = 0x1
+	recordFlagDirectory = 0x2
+
+	attrFlagCompressed = 0x0001
+	attrFlagEncrypted  = 0x4000
+
+	// fileReferenceMask 为文件引用中 MFT 记录号的部分,高 16 位为序列号
+	fileReferenceMask = 0x0000FFFFFFFFFFFF
+
+	// maxRecordSize 为 MFT 记录与索引记录大小的上限,实际使用的为 1K 或 4K
+	maxRecordSize = 64 << 10
+	// maxClusterSize 为簇大小的上限,NTFS 支持的最大簇为 2M
+	maxClusterSize = 2 << 20
+	// minIndexRecordSize 为索引记录的最小大小,需要容纳 0x18 处的索引节点头部
+	minIndexRecordSize = 0x28
+)
+
+// Volume 为一个 NTFS 卷,r 中偏移 0 处应为卷的引导扇区。
+// 整个磁盘镜像需要先用 io.NewSectionReader 截取分区
+type Volume struct {
+	r               io.ReaderAt
+	BytesPerSector  int
+	ClusterSize     int
+	MFTRecordSize   int
+	IndexRecordSize int
+	SerialNumber    uint64
+	// Size 为引导扇区中记录的卷大小,属性的大小不会超过它
+	Size       int64
+	mftCluster int64
+	mft        *attribute
+}
+
+// Open 解析引导扇区与 $MFT 的位置
+func Open(r io.ReaderAt) (*Volume, error) {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotNTFS, err)
+	}
+	if string(boot[3:11]) != "NTFS    " {
+		return nil, ErrNotNTFS
+	}
+	v := &Volume{
+		r:              r,
+		BytesPerSector: int(binary.LittleEndian.Uint16(boot[0x0B:])),
+		SerialNumber:   binary.LittleEndian.Uint64(boot[0x48:]),
+		mftCluster:     int64(binary.LittleEndian.Uint64(boot[0x30:])),
+	}
+	v.ClusterSize = v.BytesPerSector * clusterCount(boot[0x0D])
+	v.MFTRecordSize = recordSize(int8(boot[0x40]), v.ClusterSize)
+	v.IndexRecordSize = recordSize(int8(boot[0x44]), v.ClusterSize)
+	if v.BytesPerSector < 256 || v.ClusterSize <= 0 || v.ClusterSize > maxClusterSize || v.ClusterSize&(v.ClusterSize-1) != 0 ||
+		v.MFTRecordSize < 256 || v.MFTRecordSize > maxRecordSize ||
+		v.IndexRecordSize < minIndexRecordSize || v.IndexRecordSize > maxRecordSize {
+		return nil, fmt.Errorf("%w: 引导扇区中的大小字段无效", ErrNotNTFS)
+	}
+	sectors := binary.LittleEndian.Uint64(boot[0x28:])
+	if sectors == 0 || sectors > uint64(math.MaxInt64/v.BytesPerSector) {
+		return nil, fmt.Errorf("%w: 引导扇区中的总扇区数无效", ErrNotNTFS)
+	}
+	v.Size = int64(sectors) * int64(v.BytesPerSector)
+	// $MFT 自身的 $DATA 可能需要从属性列表中读取,此时先用基本记录中的数据段定位扩展记录
+	data, err := v.readRecordAt(v.mftCluster * int64(v.ClusterSize))
+	if err != nil {
+		return nil, err
+	}
+	base, err := v.parseRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	v.mft = base.find(attrData, "")
+	if v.mft == nil {
+		return nil, fmt.Errorf("%w: $MFT 没有 $DATA 属性", registry.ErrCorrupt)
+	}
+	file, err := v.loadRecord(mftRecordMFT, data)
+	if err != nil {
+		return nil, err
+	}
+	if full := file.find(attrData, ""); full != nil {
+		v.mft = full
+	}
+	return v, nil
+}
+
+// clusterCount 解析每簇扇区数,大于 0x80 时为 2 的负指数,指数超出簇大小的上限时返回 0
+func clusterCount(b byte) int {
+	if b > 0x80 {
+		if n := 256 - int(b); 1<<n <= maxClusterSize {
+			return 1 << n
+		}
+		return 0
+	}
+	return int(b)
+}
+
+// recordSize 解析 MFT 记录与索引记录的大小,负数表示 2 的 -n 次方字节,否则为簇数
+func recordSize(n int8, cluster int) int {
+	if n < 0 {
+		return 1 << -n
+	}
+	return int(n) * cluster
+}
+
+// run 为非常驻属性的一个数据段,lcn 为 -1 时为稀疏段
+type run struct {
+	vcn    int64
+	lcn    int64
+	length int64
+}
+
+// attribute 为文件的一个属性,非常驻属性在属性列表中分散的数据段已合并
+type attribute struct {
+	typ       uint32
+	name      string
+	flags     uint16
+	resident  bool
+	value     []byte
+	runs      []run
+	size      int64
+	allocated int64
+	// initialized 之后的数据读出为 0
+	initialized int64
+}
+
+// record 为一个 MFT 记录及其扩展记录中的所有属性
+type record struct {
+	number     uint64
+	flags      uint16
+	attributes []*attribute
+}
+
+func (r *record) find(typ uint32, name string) *attribute {
+	for _, a := range r.attributes {
+		if a.typ == typ && a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// readRecordAt 读取卷中 offset 处的一个 MFT 记录并应用修正序列
+func (v *Volume) readRecordAt(offset int64) ([]byte, error) {
+	data := make([]byte, v.MFTRecordSize)
+	if _, err := v.r.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(data[0:4]) != "FILE" {
+		return nil, fmt.Errorf("%w: 偏移 %#x 处不是 MFT 记录", registry.ErrCorrupt, offset)
+	}
+	if err := applyFixup(data, v.BytesPerSector); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readRecord 按记录号读取 MFT 记录
+func (v *Volume) readRecord(number uint64) ([]byte, error) {
+	data := make([]byte, v.MFTRecordSize)
+	if err := v.readAttribute(v.mft, data, int64(number)*int64(v.MFTRecordSize)); err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d: %w", number, err)
+	}
+	if string(data[0:4]) != "FILE" {
+		return nil, fmt.Errorf("%w: MFT 记录 %d 签名无效", registry.ErrCorrupt, number)
+	}
+	if err := applyFixup(data, v.BytesPerSector); err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d: %w", number, err)
+	}
+	return data, nil
+}
+
+// applyFixup 校验并还原每个扇区最后两个字节,它们在写入时被替换为更新序列号
+func applyFixup(data []byte, sector int) error {
+	offset := int(binary.LittleEndian.Uint16(data[4:]))
+	count := int(binary.LittleEndian.Uint16(data[6:]))
+	if count == 0 || offset+count*2 > len(data) || (count-1)*sector > len(data) {
+		return fmt.Errorf("%w: 更新序列数组无效", registry.ErrCorrupt)
+	}
+	usn := data[offset : offset+2]
+	for i := 1; i < count; i++ {
+		end := i*sector - 2
+		if data[end] != usn[0] || data[end+1] != usn[1] {
+			return fmt.Errorf("%w: 扇区 %d 的更新序列号不匹配", registry.ErrCorrupt, i-1)
+		}
+		copy(data[end:end+2], data[offset+i*2:offset+i*2+2])
+	}
+	return nil
+}
+
+// parseRecord 解析一个 MFT 记录中的属性,不处理属性列表
+func (v *Volume) parseRecord(data []byte) (*record, error) {
+	r := &record{flags: binary.LittleEndian.Uint16(data[0x16:])}
+	off := int(binary.LittleEndian.Uint16(data[0x14:]))
+	for off+8 <= len(data) {
+		typ := binary.LittleEndian.Uint32(data[off:])
+		if typ == attrEnd {
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(data[off+4:]))
+		if length < 0x18 || off+length > len(data) {
+			return r, fmt.Errorf("%w: 属性长度 %d 无效", registry.ErrCorrupt, length)
+		}
+		a, err := v.parseAttribute(data[off : off+length])
+		if err != nil {
+			return r, err
+		}
+		r.attributes = append(r.attributes, a)
+		off += length
+	}
+	return r, nil
+}
+
+func (v *Volume) parseAttribute(b []byte) (*attribute, error) {
+	a := &attribute{
+		typ:      binary.LittleEndian.Uint32(b[0:]),
+		resident: b[8] == 0,
+		flags:    binary.LittleEndian.Uint16(b[0x0C:]),
+	}
+	if n := int(b[9]); n > 0 {
+		off := int(binary.LittleEndian.Uint16(b[0x0A:]))
+		if off+n*2 > len(b) {
+			return nil, fmt.Errorf("%w: 属性名超出范围", registry.ErrCorrupt)
+		}
+		a.name = decodeUTF16(b[off : off+n*2])
+	}
+	if a.resident {
+		size := int(binary.LittleEndian.Uint32(b[0x10:]))
+		off := int(binary.LittleEndian.Uint16(b[0x14:]))
+		if off+size > len(b) {
+			return nil, fmt.Errorf("%w: 常驻属性超出范围", registry.ErrCorrupt)
+		}
+		a.value = b[off : off+size]
+		a.size = int64(size)
+		a.allocated = a.size
+		a.initialized = a.size
+		return a, nil
+	}
+	if len(b) < 0x40 {
+		return nil, fmt.Errorf("%w: 非常驻属性头部过短", registry.ErrCorrupt)
+	}
+	startVCN := int64(binary.LittleEndian.Uint64(b[0x10:]))
+	a.allocated = int64(binary.LittleEndian.Uint64(b[0x28:]))
+	a.size = int64(binary.LittleEndian.Uint64(b[0x30:]))
+	a.initialized = int64(binary.LittleEndian.Uint64(b[0x38:]))
+	// 大小字段只在起始 VCN 为 0 的部分中有效
+	if startVCN == 0 && (a.size < 0 || a.initialized < 0 || a.size > a.allocated) {
+		return nil, fmt.Errorf("%w: 非常驻属性的大小 %d 无效", registry.ErrCorrupt, a.size)
+	}
+	runsOffset := int(binary.LittleEndian.Uint16(b[0x20:]))
+	if runsOffset > len(b) {
+		return nil, fmt.Errorf("%w: 数据段列表超出范围", registry.ErrCorrupt)
+	}
+	runs, err := v.parseRuns(b[runsOffset:], startVCN)
+	if err != nil {
+		return nil, err
+	}
+	a.runs = runs
+	return a, nil
+}
+
+// parseRuns 解析数据段列表:每项的首字节低 4 位为长度字段的字节数,高 4 位为偏移字段的字节数,
+// 偏移为相对上一段起始簇的有符号数,偏移字段为 0 字节时为稀疏段。
+// 属性的大小不超过卷的大小,因此数据段的长度与 VCN 范围也不能超过卷的簇数
+func (v *Volume) parseRuns(b []byte, vcn int64) ([]run, error) {
+	runs := make([]run, 0)
+	lcn := int64(0)
+	clusters := (v.Size + int64(v.ClusterSize) - 1) / int64(v.ClusterSize)
+	for i := 0; i < len(b) && b[i] != 0; {
+		lenSize, offSize := int(b[i]&0x0F), int(b[i]>>4)
+		i++
+		if lenSize == 0 || lenSize > 8 || offSize > 8 || i+lenSize+offSize > len(b) {
+			return nil, fmt.Errorf("%w: 数据段列表无效", registry.ErrCorrupt)
+		}
+		length := int64(readVarInt(b[i:i+lenSize], false))
+		if length <= 0 || length > clusters || vcn < 0 || vcn > clusters-length {
+			return nil, fmt.Errorf("%w: 数据段长度 %d 无效(起始 VCN %d,卷共 %d 簇)", registry.ErrCorrupt, length, vcn, clusters)
+		}
+		i += lenSize
+		r := run{vcn: vcn, lcn: -1, length: length}
+		if offSize > 0 {
+			lcn += readVarInt(b[i:i+offSize], true)
+			r.lcn = lcn
+			i += offSize
+		}
+		runs = append(runs, r)
+		vcn += length
+	}
+	return runs, nil
+}
+
+func readVarInt(b []byte, signed bool) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	if signed && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		v |= ^uint64(0) << (8 * len(b))
+	}
+	return int64(v)
+}
+
+// loadRecord 解析记录号为 number 的 MFT 记录,并合并属性列表引用的扩展记录中的属性
+func (v *Volume) loadRecord(number uint64, data []byte) (*record, error) {
+	if data == nil {
+		var err error
+		if data, err = v.readRecord(number); err != nil {
+			return nil, err
+		}
+	}
+	r, err := v.parseRecord(data)
+	if err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d: %w", number, err)
+	}
+	r.number = number
+	list := r.find(attrAttributeList, "")
+	if list == nil {
+		return r, nil
+	}
+	listData, err := v.attributeData(list)
+	if err != nil {
+		return nil, fmt.Errorf("MFT 记录 %d 的属性列表: %w", number, err)
+	}
+	// 属性列表中每项为:类型、项长度、名称长度与偏移、起始 VCN、所在记录的引用、属性 ID
+	extensions := make([]uint64, 0)
+	for off := 0; off+0x1A <= len(listData); {
+		length := int(binary.LittleEndian.Uint16(listData[off+4:]))
+		if length < 0x1A {
+			break
+		}
+		ref := binary.LittleEndian.Uint64(listData[off+0x10:]) & fileReferenceMask
+		if ref != number && !containsRecord(extensions, ref) {
+			extensions = append(extensions, ref)
+		}
+		off += length
+	}
+	for _, ext := range extensions {
+		data, err := v.readRecord(ext)
+		if err != nil {
+			return nil, err
+		}
+		er, err := v.parseRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("MFT 记录 %d: %w", ext, err)
+		}
+		r.attributes = append(r.attributes, er.attributes...)
+	}
+	r.attributes = mergeAttributes(r.attributes)
+	return r, nil
+}
+
+func containsRecord(list []uint64, n uint64) bool {
+	for _, x := range list {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeAttributes 把分布在多个记录中的同一非常驻属性的数据段按 VCN 合并,
+// 大小等字段以起始 VCN 为 0 的部分为准
+func mergeAttributes(attrs []*attribute) []*attribute {
+	result := make([]*attribute, 0, len(attrs))
+	index := make(map[string]*attribute)
+	for _, a := range attrs {
+		if a.resident {
+			result = append(result, a)
+			continue
+		}
+		key := fmt.Sprintf("%x:%s", a.typ, a.name)
+		first, ok := index[key]
+		if !ok {
+			index[key] = a
+			result = append(result, a)
+			continue
+		}
+		if len(a.runs) > 0 && (len(first.runs) == 0 || a.runs[0].vcn < first.runs[0].vcn) {
+			first.size, first.allocated, first.initialized = a.size, a.allocated, a.initialized
+			first.flags = a.flags
+		}
+		first.runs = append(first.runs, a.runs...)
+	}
+	for _, a := range index {
+		sort.Slice(a.runs, func(i, j int) bool { return a.runs[i].vcn < a.runs[j].vcn })
+	}
+	return result
+}
+
+// checkSize 检查非常驻属性的大小:不能为负数、不能超过分配的大小,也不能超过卷的大小
+func (v *Volume) checkSize(a *attribute) error {
+	if !a.resident && (a.size < 0 || a.size > a.allocated || a.size > v.Size) {
+		return fmt.Errorf("%w: 属性大小 %d 无效(分配大小 %d,卷大小 %d)", registry.ErrCorrupt, a.size, a.allocated, v.Size)
+	}
+	return nil
+}
+
+// attributeData 读取属性的全部数据
+func (v *Volume) attributeData(a *attribute) ([]byte, error) {
+	if a.resident {
+		return a.value, nil
+	}
+	if err := v.checkSize(a); err != nil {
+		return nil, err
+	}
+	data := make([]byte, a.size)
+	if err := v.readAttribute(a, data, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readAttribute 从属性数据的 offset 处读取 len(p) 字节,稀疏段与超出已初始化大小的部分为 0
+func (v *Volume) readAttribute(a *attribute, p []byte, offset int64) error {
+	if a.flags&(attrFlagCompressed|attrFlagEncrypted) != 0 {
+		return ErrUnsupported
+	}
+	if offset+int64(len(p)) > a.size {
+		return fmt.Errorf("%w: 读取范围超出属性大小", registry.ErrCorrupt)
+	}
+	if a.resident {
+		copy(p, a.value[offset:])
+		return nil
+	}
+	cluster := int64(v.ClusterSize)
+	for len(p) > 0 {
+		if offset >= a.initialized {
+			clear(p)
+			return nil
+		}
+		vcn := offset / cluster
+		r := findRun(a.runs, vcn)
+		if r == nil {
+			return fmt.Errorf("%w: VCN %d 不在任何数据段中", registry.ErrCorrupt, vcn)
+		}
+		within := offset - r.vcn*cluster
+		n := min(int64(len(p)), r.length*cluster-within, a.initialized-offset)
+		if n <= 0 {
+			return fmt.Errorf("%w: VCN %d 处的数据段无效", registry.ErrCorrupt, vcn)
+		}
+		if r.lcn < 0 {
+			clear(p[:n])
+		} else if _, err := v.r.ReadAt(p[:n], r.lcn*cluster+within); err != nil && err != io.EOF {
+			return err
+		}
+		p = p[n:]
+		offset += n
+	}
+	return nil
+}
+
+func findRun(runs []run, vcn int64) *run {
+	for i := range runs {
+		if vcn >= runs[i].vcn && vcn < runs[i].vcn+runs[i].length {
+			return &runs[i]
+		}
+	}
+	return nil
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
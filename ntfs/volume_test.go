@@ -0,0 +1,581 @@
+package ntfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// 测试镜像的参数:512 字节扇区、4K 簇、1K MFT 记录,$MFT 共 64 个记录,分为两段
+const (
+	testSector     = 512
+	testCluster    = 4096
+	testRecordSize = 1024
+	testRecords    = 64
+)
+
+// testNode 为测试镜像中的一个文件或目录
+type testNode struct {
+	name     string
+	dir      bool
+	children []*testNode
+	data     []byte
+	// resident 为 true 时 $DATA 为常驻属性
+	resident bool
+	// fragment 把数据分为两段,第二段位于第一段之前
+	fragment bool
+	// sparse 把数据的第一簇与最后一簇之间作为稀疏段,数据中对应部分应为 0
+	sparse bool
+	// attrList 把 $DATA 放到扩展记录中,由 $ATTRIBUTE_LIST 引用
+	attrList bool
+	// indexAlloc 把目录项放到 $INDEX_ALLOCATION 的索引记录中
+	indexAlloc bool
+	// size 与 allocated 不为 0 时覆盖非常驻 $DATA 中记录的大小
+	size      int64
+	allocated int64
+	// indexBlockSize 不为 0 时覆盖 $INDEX_ROOT 中的索引记录大小
+	indexBlockSize uint32
+	// runs 不为 nil 时替换 $DATA 的数据段,数据不写入镜像
+	runs []testRun
+
+	number uint64
+	parent uint64
+}
+
+func (n *testNode) add(c *testNode) *testNode {
+	n.children = append(n.children, c)
+	return c
+}
+
+// testRun 为数据段,lcn 为 -1 时为稀疏段
+type testRun struct{ lcn, length int64 }
+
+type testImage struct {
+	buf     []byte
+	next    int64
+	records map[uint64][]byte
+	nextRec uint64
+}
+
+func (g *testImage) alloc(n int64) int64 {
+	lcn := g.next
+	g.next += n
+	if need := int(g.next * testCluster); len(g.buf) < need {
+		g.buf = append(g.buf, make([]byte, need-len(g.buf))...)
+	}
+	return lcn
+}
+
+func encodeName(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, x := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], x)
+	}
+	return b
+}
+
+func align8(n int) int { return (n + 7) &^ 7 }
+
+func residentAttr(typ uint32, name string, value []byte) []byte {
+	nb := encodeName(name)
+	voff := align8(0x18 + len(nb))
+	a := make([]byte, align8(voff+len(value)))
+	binary.LittleEndian.PutUint32(a[0:], typ)
+	binary.LittleEndian.PutUint32(a[4:], uint32(len(a)))
+	a[9] = byte(len(nb) / 2)
+	binary.LittleEndian.PutUint16(a[0xA:], 0x18)
+	copy(a[0x18:], nb)
+	binary.LittleEndian.PutUint32(a[0x10:], uint32(len(value)))
+	binary.LittleEndian.PutUint16(a[0x14:], uint16(voff))
+	copy(a[voff:], value)
+	return a
+}
+
+func varBytes(v int64, signed bool) []byte {
+	b := []byte{}
+	for {
+		b = append(b, byte(v))
+		v >>= 8
+		if signed {
+			if (v == 0 && b[len(b)-1]&0x80 == 0) || (v == -1 && b[len(b)-1]&0x80 != 0) {
+				return b
+			}
+		} else if v == 0 {
+			return b
+		}
+	}
+}
+
+func runList(runs []testRun) []byte {
+	out := []byte{}
+	prev := int64(0)
+	for _, r := range runs {
+		lb := varBytes(r.length, false)
+		if r.lcn < 0 {
+			out = append(append(out, byte(len(lb))), lb...)
+			continue
+		}
+		ob := varBytes(r.lcn-prev, true)
+		prev = r.lcn
+		out = append(append(append(out, byte(len(lb))|byte(len(ob))<<4), lb...), ob...)
+	}
+	return append(out, 0)
+}
+
+func nonresidentAttr(typ uint32, name string, runs []testRun, size, allocated int64) []byte {
+	nb := encodeName(name)
+	rl := runList(runs)
+	roff := align8(0x40 + len(nb))
+	a := make([]byte, align8(roff+len(rl)))
+	binary.LittleEndian.PutUint32(a[0:], typ)
+	binary.LittleEndian.PutUint32(a[4:], uint32(len(a)))
+	a[8] = 1
+	a[9] = byte(len(nb) / 2)
+	binary.LittleEndian.PutUint16(a[0xA:], 0x40)
+	copy(a[0x40:], nb)
+	var total int64
+	for _, r := range runs {
+		total += r.length
+	}
+	if allocated == 0 {
+		allocated = total * testCluster
+	}
+	binary.LittleEndian.PutUint64(a[0x18:], uint64(total-1))
+	binary.LittleEndian.PutUint16(a[0x20:], uint16(roff))
+	binary.LittleEndian.PutUint64(a[0x28:], uint64(allocated))
+	binary.LittleEndian.PutUint64(a[0x30:], uint64(size))
+	binary.LittleEndian.PutUint64(a[0x38:], uint64(size))
+	copy(a[roff:], rl)
+	return a
+}
+
+func fileNameValue(parent uint64, name string, dir bool, size int64, namespace byte) []byte {
+	nb := encodeName(name)
+	v := make([]byte, 0x42+len(nb))
+	binary.LittleEndian.PutUint64(v[0:], parent|1<<48)
+	binary.LittleEndian.PutUint64(v[0x28:], uint64(size))
+	binary.LittleEndian.PutUint64(v[0x30:], uint64(size))
+	if dir {
+		binary.LittleEndian.PutUint32(v[0x38:], fileNameFlagDirectory)
+	}
+	v[0x40] = byte(len(nb) / 2)
+	v[0x41] = namespace
+	copy(v[0x42:], nb)
+	return v
+}
+
+func writeFixup(b []byte, usaOffset int) {
+	count := len(b)/testSector + 1
+	binary.LittleEndian.PutUint16(b[4:], uint16(usaOffset))
+	binary.LittleEndian.PutUint16(b[6:], uint16(count))
+	binary.LittleEndian.PutUint16(b[usaOffset:], 7)
+	for i := 1; i < count; i++ {
+		end := i*testSector - 2
+		copy(b[usaOffset+i*2:], b[end:end+2])
+		binary.LittleEndian.PutUint16(b[end:], 7)
+	}
+}
+
+func fileRecord(number uint64, flags uint16, base uint64, attrs ...[]byte) []byte {
+	r := make([]byte, testRecordSize)
+	copy(r, "FILE")
+	binary.LittleEndian.PutUint16(r[0x10:], 1)
+	binary.LittleEndian.PutUint16(r[0x14:], 0x38)
+	binary.LittleEndian.PutUint16(r[0x16:], flags)
+	binary.LittleEndian.PutUint32(r[0x1C:], testRecordSize)
+	binary.LittleEndian.PutUint64(r[0x20:], base)
+	binary.LittleEndian.PutUint32(r[0x2C:], uint32(number))
+	off := 0x38
+	for _, a := range attrs {
+		off += copy(r[off:], a)
+	}
+	binary.LittleEndian.PutUint32(r[off:], attrEnd)
+	binary.LittleEndian.PutUint32(r[0x18:], uint32(off+8))
+	writeFixup(r, 0x30)
+	return r
+}
+
+func indexEntry(ref uint64, key []byte, flags uint32) []byte {
+	e := make([]byte, align8(0x10+len(key)))
+	binary.LittleEndian.PutUint64(e[0:], ref|1<<48)
+	binary.LittleEndian.PutUint16(e[8:], uint16(len(e)))
+	binary.LittleEndian.PutUint16(e[0xA:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(e[0xC:], flags)
+	copy(e[0x10:], key)
+	return e
+}
+
+func (g *testImage) dataAttr(n *testNode) []byte {
+	if n.resident {
+		return residentAttr(attrData, "", n.data)
+	}
+	clusters := max((int64(len(n.data))+testCluster-1)/testCluster, 1)
+	var runs []testRun
+	switch {
+	case n.runs != nil:
+		runs = n.runs
+	case n.fragment && clusters >= 2:
+		half := clusters / 2
+		second := g.alloc(clusters - half)
+		g.alloc(3)
+		first := g.alloc(half)
+		copy(g.buf[first*testCluster:], n.data[:half*testCluster])
+		copy(g.buf[second*testCluster:], n.data[half*testCluster:])
+		runs = []testRun{{first, half}, {second, clusters - half}}
+	case n.sparse && clusters >= 3:
+		first := g.alloc(1)
+		last := g.alloc(1)
+		copy(g.buf[first*testCluster:], n.data[:testCluster])
+		copy(g.buf[last*testCluster:], n.data[(clusters-1)*testCluster:])
+		runs = []testRun{{first, 1}, {-1, clusters - 2}, {last, 1}}
+	default:
+		lcn := g.alloc(clusters)
+		copy(g.buf[lcn*testCluster:], n.data)
+		runs = []testRun{{lcn, clusters}}
+	}
+	size := int64(len(n.data))
+	if n.size != 0 {
+		size = n.size
+	}
+	return nonresidentAttr(attrData, "", runs, size, n.allocated)
+}
+
+func (g *testImage) build(n *testNode) {
+	for _, c := range n.children {
+		c.parent = n.number
+		c.number = g.nextRec
+		g.nextRec++
+		if c.attrList {
+			g.nextRec++
+		}
+	}
+	fn := residentAttr(attrFileName, "", fileNameValue(n.parent, n.name, n.dir, int64(len(n.data)), 1))
+	flags := uint16(recordFlagInUse)
+	if !n.dir {
+		if !n.attrList {
+			g.records[n.number] = fileRecord(n.number, flags, 0, fn, g.dataAttr(n))
+			return
+		}
+		// 属性列表中每项为 0x20 字节,$FILE_NAME 在基本记录中,$DATA 在扩展记录中
+		ext := n.number + 1
+		list := make([]byte, 0)
+		for _, e := range []struct {
+			typ uint32
+			ref uint64
+		}{{attrFileName, n.number}, {attrData, ext}} {
+			item := make([]byte, 0x20)
+			binary.LittleEndian.PutUint32(item[0:], e.typ)
+			binary.LittleEndian.PutUint16(item[4:], 0x20)
+			item[7] = 0x1A
+			binary.LittleEndian.PutUint64(item[0x10:], e.ref|1<<48)
+			list = append(list, item...)
+		}
+		g.records[n.number] = fileRecord(n.number, flags, 0, fn, residentAttr(attrAttributeList, "", list))
+		g.records[ext] = fileRecord(ext, flags, n.number|1<<48, g.dataAttr(n))
+		return
+	}
+	flags |= recordFlagDirectory
+	var entries []byte
+	for _, c := range n.children {
+		entries = append(entries, indexEntry(c.number, fileNameValue(n.number, c.name, c.dir, int64(len(c.data)), 1), 0)...)
+		if len(c.name) > 8 {
+			// 长文件名的 8.3 短文件名项,ReadDir 不应列出
+			entries = append(entries, indexEntry(c.number, fileNameValue(n.number, "DOSNAM~1", c.dir, 0, namespaceDOS), 0)...)
+		}
+	}
+	blockSize := uint32(testCluster)
+	if n.indexBlockSize != 0 {
+		blockSize = n.indexBlockSize
+	}
+	indexRoot := func(body []byte, large bool) []byte {
+		v := make([]byte, 0x20)
+		binary.LittleEndian.PutUint32(v[0:], attrFileName)
+		binary.LittleEndian.PutUint32(v[4:], 1)
+		binary.LittleEndian.PutUint32(v[8:], blockSize)
+		v[0xC] = 1
+		binary.LittleEndian.PutUint32(v[0x10:], 0x10)
+		binary.LittleEndian.PutUint32(v[0x14:], uint32(0x10+len(body)))
+		binary.LittleEndian.PutUint32(v[0x18:], uint32(0x10+len(body)))
+		if large {
+			v[0x1C] = 1
+		}
+		return append(v, body...)
+	}
+	attrs := [][]byte{fn}
+	if n.indexAlloc {
+		lcn := g.alloc(1)
+		b := g.buf[lcn*testCluster : (lcn+1)*testCluster]
+		copy(b, "INDX")
+		body := append(entries, indexEntry(0, nil, indexEntryLast)...)
+		binary.LittleEndian.PutUint32(b[0x18:], 0x40-0x18)
+		binary.LittleEndian.PutUint32(b[0x1C:], uint32(0x40-0x18+len(body)))
+		binary.LittleEndian.PutUint32(b[0x20:], testCluster-0x18)
+		copy(b[0x40:], body)
+		writeFixup(b, 0x28)
+		attrs = append(attrs,
+			residentAttr(attrIndexRoot, indexName, indexRoot(indexEntry(0, nil, indexEntrySubnode|indexEntryLast), true)),
+			nonresidentAttr(attrIndexAllocation, indexName, []testRun{{lcn, 1}}, testCluster, 0),
+			residentAttr(attrBitmap, indexName, []byte{1, 0, 0, 0, 0, 0, 0, 0}))
+	} else {
+		attrs = append(attrs, residentAttr(attrIndexRoot, indexName, indexRoot(append(entries, indexEntry(0, nil, indexEntryLast)...), false)))
+	}
+	g.records[n.number] = fileRecord(n.number, flags, 0, attrs...)
+	for _, c := range n.children {
+		g.build(c)
+	}
+}
+
+// buildImage 生成以 root 为根目录的 NTFS 卷镜像,$MFT 的 $DATA 分为两段
+func buildImage(root *testNode) []byte {
+	g := &testImage{records: make(map[uint64][]byte), nextRec: 16}
+	g.alloc(2)
+	mft1 := g.alloc(8)
+	root.dir, root.name, root.number, root.parent = true, ".", mftRecordRoot, mftRecordRoot
+	g.build(root)
+	g.alloc(5)
+	mft2 := g.alloc(8)
+	g.records[mftRecordMFT] = fileRecord(mftRecordMFT, recordFlagInUse, 0,
+		residentAttr(attrFileName, "", fileNameValue(mftRecordRoot, "$MFT", false, testRecords*testRecordSize, 1)),
+		nonresidentAttr(attrData, "", []testRun{{mft1, 8}, {mft2, 8}}, testRecords*testRecordSize, 0))
+	for number, rec := range g.records {
+		pos := mft1*testCluster + int64(number)*testRecordSize
+		if number >= 32 {
+			pos = mft2*testCluster + int64(number-32)*testRecordSize
+		}
+		copy(g.buf[pos:], rec)
+	}
+	b := g.buf[:testSector]
+	copy(b, "\xEB\x52\x90NTFS    ")
+	binary.LittleEndian.PutUint16(b[0xB:], testSector)
+	b[0xD] = testCluster / testSector
+	binary.LittleEndian.PutUint64(b[0x28:], uint64(len(g.buf)/testSector-1))
+	binary.LittleEndian.PutUint64(b[0x30:], uint64(mft1))
+	b[0x40] = 0xF6 // 2^10 字节
+	b[0x44] = 1    // 1 簇
+	binary.LittleEndian.PutUint64(b[0x48:], 0x1234ABCD)
+	return g.buf
+}
+
+// pattern 生成 n 字节可区分的数据
+func pattern(seed byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i/7)
+	}
+	return b
+}
+
+func testVolume() (*testNode, map[string][]byte) {
+	files := map[string][]byte{
+		`Windows\System32\config\SYSTEM`:      pattern(1, 5*testCluster+100),
+		`Windows\System32\config\SYSTEM.LOG1`: []byte("LOG1"),
+		`Windows\System32\config\SOFTWARE`:    pattern(2, 2*testCluster),
+		`Windows\System32\config\SAM`:         pattern(3, testCluster),
+		`Windows\AppCompat\Programs\Amcache.hve`: append(append(pattern(4, testCluster),
+			make([]byte, 2*testCluster)...), pattern(5, testCluster/2)...),
+		`Users\bob\NTUSER.DAT`: pattern(6, 3*testCluster),
+		`Users\bob\AppData\Local\Microsoft\Windows\UsrClass.dat`: pattern(7, testCluster),
+	}
+	root := &testNode{}
+	win := root.add(&testNode{name: "Windows", dir: true})
+	config := win.add(&testNode{name: "System32", dir: true}).add(&testNode{name: "config", dir: true, indexAlloc: true})
+	config.add(&testNode{name: "SYSTEM", data: files[`Windows\System32\config\SYSTEM`], fragment: true})
+	config.add(&testNode{name: "SYSTEM.LOG1", data: files[`Windows\System32\config\SYSTEM.LOG1`], resident: true})
+	config.add(&testNode{name: "SOFTWARE", data: files[`Windows\System32\config\SOFTWARE`], attrList: true})
+	config.add(&testNode{name: "SAM", data: files[`Windows\System32\config\SAM`]})
+	programs := win.add(&testNode{name: "AppCompat", dir: true}).add(&testNode{name: "Programs", dir: true})
+	programs.add(&testNode{name: "Amcache.hve", data: files[`Windows\AppCompat\Programs\Amcache.hve`], sparse: true})
+	users := root.add(&testNode{name: "Users", dir: true, indexAlloc: true})
+	bob := users.add(&testNode{name: "bob", dir: true})
+	bob.add(&testNode{name: "NTUSER.DAT", data: files[`Users\bob\NTUSER.DAT`], fragment: true})
+	p := bob
+	for _, name := range []string{"AppData", "Local", "Microsoft", "Windows"} {
+		p = p.add(&testNode{name: name, dir: true})
+	}
+	p.add(&testNode{name: "UsrClass.dat", data: files[`Users\bob\AppData\Local\Microsoft\Windows\UsrClass.dat`]})
+	users.add(&testNode{name: "Public", dir: true})
+	for i := 0; i < 3; i++ {
+		users.add(&testNode{name: fmt.Sprintf("desktop-%d.ini", i), data: []byte("x"), resident: true})
+	}
+	return root, files
+}
+
+func TestOpen(t *testing.T) {
+	root, files := testVolume()
+	v, err := Open(bytes.NewReader(buildImage(root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ClusterSize != testCluster || v.MFTRecordSize != testRecordSize || v.IndexRecordSize != testCluster || v.SerialNumber != 0x1234ABCD {
+		t.Fatalf("引导扇区解析错误: %+v", v)
+	}
+	for path, want := range files {
+		f, err := v.Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		got, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if f.Size != int64(len(want)) || !bytes.Equal(got, want) {
+			t.Fatalf("%s 的内容不符,大小为 %d,应为 %d", path, f.Size, len(want))
+		}
+	}
+	// 路径不区分大小写,也可以用斜杠分隔
+	f, err := v.Open("windows/system32/CONFIG/system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 跨越两个数据段读取
+	buf := make([]byte, 100)
+	if _, err := f.ReadAt(buf, 2*testCluster+testCluster-50); err != nil {
+		t.Fatal(err)
+	}
+	if want := files[`Windows\System32\config\SYSTEM`][3*testCluster-50 : 3*testCluster+50]; !bytes.Equal(buf, want) {
+		t.Fatal("跨越数据段读取的内容不符")
+	}
+
+	if _, err := v.Open(`Windows\nope`); !errors.Is(err, registry.ErrNotFound) {
+		t.Fatalf("不存在的文件返回 %v", err)
+	}
+	if _, err := Open(bytes.NewReader(make([]byte, testCluster))); !errors.Is(err, ErrNotNTFS) {
+		t.Fatalf("非 NTFS 数据返回 %v", err)
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	root, _ := testVolume()
+	v, err := Open(bytes.NewReader(buildImage(root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		names []string
+	}{
+		{"", []string{"Windows", "Users"}},
+		{`Windows\System32\config`, []string{"SYSTEM", "SYSTEM.LOG1", "SOFTWARE", "SAM"}},
+		{"users", []string{"bob", "Public", "desktop-0.ini", "desktop-1.ini", "desktop-2.ini"}},
+	}
+	for _, tt := range tests {
+		entries, err := v.ReadDir(tt.path)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.path, err)
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+			t.Fatalf("%q 的目录项为 %v,应为 %v", tt.path, names, tt.names)
+		}
+	}
+	if _, err := v.ReadDir(`Windows\System32\config\SAM`); !errors.Is(err, registry.ErrTypeMismatch) {
+		t.Fatalf("对文件调用 ReadDir 返回 %v", err)
+	}
+}
+
+func TestHives(t *testing.T) {
+	root, files := testVolume()
+	v, err := Open(bytes.NewReader(buildImage(root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hives, err := v.Hives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ path, user string }{
+		{`Windows\System32\config\SAM`, ""},
+		{`Windows\System32\config\SOFTWARE`, ""},
+		{`Windows\System32\config\SYSTEM`, ""},
+		{`Users\bob\NTUSER.DAT`, "bob"},
+		{`Users\bob\AppData\Local\Microsoft\Windows\UsrClass.dat`, "bob"},
+		{`Windows\AppCompat\Programs\Amcache.hve`, ""},
+	}
+	if len(hives) != len(want) {
+		t.Fatalf("找到 %d 个 hive,应为 %d 个", len(hives), len(want))
+	}
+	for i, h := range hives {
+		if h.Path != want[i].path || h.User != want[i].user {
+			t.Fatalf("第 %d 个 hive 为 %s(%q),应为 %s(%q)", i, h.Path, h.User, want[i].path, want[i].user)
+		}
+		if !bytes.Equal(h.Registry.Buffers, files[h.Path]) {
+			t.Fatalf("%s 的内容不符", h.Path)
+		}
+	}
+	if log := hives[2].Logs[".LOG1"]; string(log) != "LOG1" || len(hives[2].Logs) != 1 {
+		t.Fatalf("SYSTEM 的事务日志为 %v", hives[2].Logs)
+	}
+}
+
+func TestCorruptSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		node *testNode
+	}{
+		{"negative", &testNode{name: "f", data: pattern(1, testCluster), size: -1}},
+		{"above allocated", &testNode{name: "f", data: pattern(1, testCluster), size: 2 * testCluster}},
+		{"above volume", &testNode{name: "f", data: pattern(1, testCluster), size: 1 << 40, allocated: 1 << 40}},
+		{"run length", &testNode{name: "f", data: pattern(1, testCluster), runs: []testRun{{1, 1 << 62}}, allocated: testCluster}},
+		{"zero run length", &testNode{name: "f", data: pattern(1, testCluster), runs: []testRun{{1, 0}}, allocated: testCluster}},
+		{"sparse run length", &testNode{name: "f", data: pattern(1, testCluster), runs: []testRun{{1, 1}, {-1, 1 << 50}}, allocated: testCluster}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &testNode{}
+			root.add(tt.node)
+			v, err := Open(bytes.NewReader(buildImage(root)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := v.Open("f")
+			if err == nil {
+				_, err = f.Bytes()
+			}
+			if !errors.Is(err, registry.ErrCorrupt) {
+				t.Fatalf("返回 %v,应为 ErrCorrupt", err)
+			}
+		})
+	}
+
+	t.Run("index block size", func(t *testing.T) {
+		root := &testNode{}
+		root.add(&testNode{name: "d", dir: true, indexAlloc: true, indexBlockSize: 0x18}).add(&testNode{name: "f", data: []byte("x"), resident: true})
+		v, err := Open(bytes.NewReader(buildImage(root)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.ReadDir("d"); !errors.Is(err, registry.ErrCorrupt) {
+			t.Fatalf("返回 %v,应为 ErrCorrupt", err)
+		}
+	})
+
+	// 0x81 到 0xCA 为溢出的负指数,3 个扇区不是 2 的幂
+	for _, count := range []byte{0x81, 0xC0, 0xCA, 3} {
+		t.Run(fmt.Sprintf("boot sectors per cluster %#x", count), func(t *testing.T) {
+			img := buildImage(&testNode{})
+			img[0x0D] = count
+			if _, err := Open(bytes.NewReader(img)); !errors.Is(err, ErrNotNTFS) {
+				t.Fatalf("返回 %v,应为 ErrNotNTFS", err)
+			}
+		})
+	}
+
+	for _, size := range []byte{0xFB, 0x7F} {
+		t.Run(fmt.Sprintf("boot index record size %#x", size), func(t *testing.T) {
+			img := buildImage(&testNode{})
+			img[0x44] = size
+			if _, err := Open(bytes.NewReader(img)); !errors.Is(err, ErrNotNTFS) {
+				t.Fatalf("返回 %v,应为 ErrNotNTFS", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Package amcache 解析 Amcache.hve 中的程序清单,
+// 包括 Windows 10 之后的 Inventory* 键和 Windows 8 时期的 Root\File 键
+package amcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// Amcache.hve 中各个清单相对于 hive 根键的位置
+const (
+	ApplicationFileLocation = "Root\\InventoryApplicationFile"
+	ApplicationLocation     = "Root\\InventoryApplication"
+	DriverBinaryLocation    = "Root\\InventoryDriverBinary"
+	DevicePnpLocation       = "Root\\InventoryDevicePnp"
+	FileLocation            = "Root\\File"
+)
+
+// dateLayout 为 LinkDate、InstallDate 等字符串时间的格式
+const dateLayout = "01/02/2006 15:04:05"
+
+// ApplicationFile 为 InventoryApplicationFile 下的一个文件记录
+type ApplicationFile struct {
+	KeyName      string    `reg:",keyname"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+	ProgramID    string    `reg:"ProgramId,optional"`
+	// FileID 为 "0000" 加 SHA1,SHA1 为去掉前缀之后的值
+	FileID            string `reg:"FileId,optional"`
+	SHA1              string `reg:"-"`
+	Path              string `reg:"LowerCaseLongPath,optional"`
+	LongPathHash      string `reg:"LongPathHash,optional"`
+	Name              string `reg:"Name,optional"`
+	OriginalFileName  string `reg:"OriginalFileName,optional"`
+	Publisher         string `reg:"Publisher,optional"`
+	Version           string `reg:"Version,optional"`
+	BinFileVersion    string `reg:"BinFileVersion,optional"`
+	BinaryType        string `reg:"BinaryType,optional"`
+	ProductName       string `reg:"ProductName,optional"`
+	ProductVersion    string `reg:"ProductVersion,optional"`
+	BinProductVersion string `reg:"BinProductVersion,optional"`
+	AppxPackage       string `reg:"AppxPackageFullName,optional"`
+	Size              uint64 `reg:"Size,optional"`
+	Language          uint32 `reg:"Language,optional"`
+	Usn               uint64 `reg:"Usn,optional"`
+	IsOsComponent     bool   `reg:"IsOsComponent,optional"`
+	IsPeFile          bool   `reg:"IsPeFile,optional"`
+	// LinkDate 为 PE 头中的链接时间
+	LinkDateString string    `reg:"LinkDate,optional"`
+	LinkDate       time.Time `reg:"-"`
+}
+
+// Application 为 InventoryApplication 下的一个已安装程序记录
+type Application struct {
+	KeyName            string    `reg:",keyname"`
+	KeyLastWrite       time.Time `reg:",timestamp"`
+	ProgramID          string    `reg:"ProgramId,optional"`
+	ProgramInstanceID  string    `reg:"ProgramInstanceId,optional"`
+	Name               string    `reg:"Name,optional"`
+	Version            string    `reg:"Version,optional"`
+	Publisher          string    `reg:"Publisher,optional"`
+	Language           uint32    `reg:"Language,optional"`
+	Source             string    `reg:"Source,optional"`
+	Type               string    `reg:"Type,optional"`
+	MsiPackageCode     string    `reg:"MsiPackageCode,optional"`
+	MsiProductCode     string    `reg:"MsiProductCode,optional"`
+	PackageFullName    string    `reg:"PackageFullName,optional"`
+	RootDirPath        string    `reg:"RootDirPath,optional"`
+	UninstallString    string    `reg:"UninstallString,optional"`
+	RegistryKeyPath    string    `reg:"RegistryKeyPath,optional"`
+	ManifestPath       string    `reg:"ManifestPath,optional"`
+	OSVersionAtInstall string    `reg:"OSVersionAtInstallTime,optional"`
+	HiddenArp          bool      `reg:"HiddenArp,optional"`
+	InboxModernApp     bool      `reg:"InboxModernApp,optional"`
+	InstallDateString  string    `reg:"InstallDate,optional"`
+	InstallDate        time.Time `reg:"-"`
+}
+
+// DriverBinary 为 InventoryDriverBinary 下的一个驱动记录,键名为驱动文件路径
+type DriverBinary struct {
+	Path           string    `reg:",keyname"`
+	KeyLastWrite   time.Time `reg:",timestamp"`
+	DriverName     string    `reg:"DriverName,optional"`
+	DriverID       string    `reg:"DriverId,optional"`
+	SHA1           string    `reg:"-"`
+	Company        string    `reg:"DriverCompany,optional"`
+	Version        string    `reg:"DriverVersion,optional"`
+	Product        string    `reg:"Product,optional"`
+	ProductVersion string    `reg:"ProductVersion,optional"`
+	Service        string    `reg:"Service,optional"`
+	Inf            string    `reg:"Inf,optional"`
+	WdfVersion     string    `reg:"WdfVersion,optional"`
+	Type           uint32    `reg:"DriverType,optional"`
+	ImageSize      uint32    `reg:"ImageSize,optional"`
+	CheckSum       uint32    `reg:"DriverCheckSum,optional"`
+	Signed         bool      `reg:"DriverSigned,optional"`
+	IsKernelMode   bool      `reg:"DriverIsKernelMode,optional"`
+	InBox          bool      `reg:"DriverInBox,optional"`
+	LinkDate       time.Time `reg:"DriverTimeStamp,optional,unix"`
+	// LastWriteTime 为驱动文件的最后修改时间
+	LastWriteTimeString string    `reg:"DriverLastWriteTime,optional"`
+	LastWriteTime       time.Time `reg:"-"`
+}
+
+// DevicePnp 为 InventoryDevicePnp 下的一个即插即用设备记录,键名为设备实例 ID
+type DevicePnp struct {
+	KeyName          string    `reg:",keyname"`
+	KeyLastWrite     time.Time `reg:",timestamp"`
+	Model            string    `reg:"Model,optional"`
+	Manufacturer     string    `reg:"Manufacturer,optional"`
+	Description      string    `reg:"Description,optional"`
+	BusDescription   string    `reg:"BusReportedDescription,optional"`
+	Class            string    `reg:"Class,optional"`
+	ClassGUID        string    `reg:"ClassGuid,optional"`
+	ContainerID      string    `reg:"ContainerId,optional"`
+	ParentID         string    `reg:"ParentId,optional"`
+	Enumerator       string    `reg:"Enumerator,optional"`
+	HWID             string    `reg:"HWID,optional"`
+	CompID           string    `reg:"COMPID,optional"`
+	MatchingID       string    `reg:"MatchingID,optional"`
+	Service          string    `reg:"Service,optional"`
+	Inf              string    `reg:"Inf,optional"`
+	Provider         string    `reg:"Provider,optional"`
+	DriverID         string    `reg:"DriverId,optional"`
+	DriverName       string    `reg:"DriverName,optional"`
+	DriverPackage    string    `reg:"DriverPackageStrongName,optional"`
+	DriverVerVersion string    `reg:"DriverVerVersion,optional"`
+	DriverVerDate    string    `reg:"DriverVerDate,optional"`
+	InstallState     uint32    `reg:"InstallState,optional"`
+	ProblemCode      uint32    `reg:"ProblemCode,optional"`
+}
+
+// File 为 Windows 8 / 早期 Windows 10 中 Root\File\{卷 GUID}\{文件 ID} 下的记录,
+// 值名为十六进制编号
+type File struct {
+	VolumeGUID    string    `reg:"-"`
+	KeyName       string    `reg:",keyname"`
+	KeyLastWrite  time.Time `reg:",timestamp"`
+	ProductName   string    `reg:"0,optional"`
+	CompanyName   string    `reg:"1,optional"`
+	Language      uint32    `reg:"3,optional"`
+	FileVersion   string    `reg:"5,optional"`
+	Size          uint32    `reg:"6,optional"`
+	SizeOfImage   uint32    `reg:"7,optional"`
+	PEHeaderHash  string    `reg:"8,optional"`
+	PEChecksum    uint32    `reg:"9,optional"`
+	Description   string    `reg:"c,optional"`
+	LinkDate      time.Time `reg:"f,optional,unix"`
+	LastModified  time.Time `reg:"11,optional,filetime"`
+	Created       time.Time `reg:"12,optional,filetime"`
+	Path          string    `reg:"15,optional"`
+	LastModified2 time.Time `reg:"17,optional,filetime"`
+	ProgramID     string    `reg:"100,optional"`
+	FileID        string    `reg:"101,optional"`
+	SHA1          string    `reg:"-"`
+}
+
+// Amcache 为从 Amcache.hve 中解析出的所有清单
+type Amcache struct {
+	ApplicationFiles []*ApplicationFile
+	Applications     []*Application
+	DriverBinaries   []*DriverBinary
+	DevicePnps       []*DevicePnp
+	Files            []*File
+}
+
+// Parse 解析 Amcache.hve 中所有已知的清单。单条记录中类型不符的值以错误形式合并返回,
+// 其余字段仍然会被填充
+func Parse(reg *registry.Registry) (*Amcache, error) {
+	result := &Amcache{}
+	var errs []error
+	found := false
+	if key := reg.Open(ApplicationFileLocation); key != nil {
+		found = true
+		result.ApplicationFiles = parseSubkeys[ApplicationFile](key, &errs)
+		for _, f := range result.ApplicationFiles {
+			f.SHA1 = sha1FromFileID(f.FileID)
+			f.LinkDate = parseDate(f.LinkDateString)
+		}
+	}
+	if key := reg.Open(ApplicationLocation); key != nil {
+		found = true
+		result.Applications = parseSubkeys[Application](key, &errs)
+		for _, a := range result.Applications {
+			a.InstallDate = parseDate(a.InstallDateString)
+		}
+	}
+	if key := reg.Open(DriverBinaryLocation); key != nil {
+		found = true
+		result.DriverBinaries = parseSubkeys[DriverBinary](key, &errs)
+		for _, d := range result.DriverBinaries {
+			d.SHA1 = sha1FromFileID(d.DriverID)
+			d.LastWriteTime = parseDate(d.LastWriteTimeString)
+		}
+	}
+	if key := reg.Open(DevicePnpLocation); key != nil {
+		found = true
+		result.DevicePnps = parseSubkeys[DevicePnp](key, &errs)
+	}
+	if key := reg.Open(FileLocation); key != nil {
+		found = true
+		result.Files = make([]*File, 0)
+		for _, volume := range key.Subkeys() {
+			for _, f := range parseSubkeys[File](volume, &errs) {
+				f.VolumeGUID = volume.Name()
+				f.SHA1 = sha1FromFileID(f.FileID)
+				result.Files = append(result.Files, f)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", registry.ErrNotFound, "Root\\Inventory* / Root\\File")
+	}
+	return result, errors.Join(errs...)
+}
+
+// parseSubkeys 把 key 的每个子键解析为一条记录
+func parseSubkeys[T any](key *registry.RegistryKey, errs *[]error) []*T {
+	result := make([]*T, 0)
+	for _, sub := range key.Subkeys() {
+		item := new(T)
+		if err := sub.Unmarshal(item); err != nil {
+			*errs = append(*errs, err)
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// sha1FromFileID 去掉 FileId 开头的 "0000",得到 40 位的 SHA1
+func sha1FromFileID(id string) string {
+	if len(id) == 44 && strings.HasPrefix(id, "0000") {
+		return strings.ToLower(id[4:])
+	}
+	if len(id) == 40 {
+		return strings.ToLower(id)
+	}
+	return ""
+}
+
+// parseDate 解析 "MM/DD/YYYY hh:mm:ss" 格式的 UTC 时间,无法解析时返回零值
+func parseDate(s string) time.Time {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,249 @@
+// Package autoruns 列出 SOFTWARE、SYSTEM、NTUSER.DAT 与 UsrClass.dat 中常见的自启动位置(ASEP),
+// 用于排查持久化
+package autoruns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// Category 为自启动项的类别
+type Category string
+
+const (
+	CategoryRun           Category = "Run"
+	CategoryWinlogon      Category = "Winlogon"
+	CategoryIFEO          Category = "Image File Execution Options"
+	CategoryAppInit       Category = "AppInit_DLLs"
+	CategoryService       Category = "Service"
+	CategoryScheduledTask Category = "Scheduled Task"
+	CategoryCOM           Category = "COM Hijack"
+	CategoryActiveSetup   Category = "Active Setup"
+	CategoryLSA           Category = "LSA Package"
+	CategoryBootExecute   Category = "BootExecute"
+)
+
+// Entry 为一个自启动项
+type Entry struct {
+	Category Category
+	// KeyPath 为自启动项所在的键,Name 为值名或子键名
+	KeyPath      string
+	Name         string
+	Command      string
+	KeyLastWrite time.Time
+}
+
+// checker 检查 hive 中的一类自启动位置,prefix 为 SOFTWARE 路径在当前 hive 中的前缀
+type checker func(reg *registry.Registry, prefix string) []*Entry
+
+// softwarePrefixes 为 SOFTWARE hive 中路径在各 hive 中的前缀,NTUSER.DAT 中位于 Software 键下
+var softwarePrefixes = []string{"", "Software\\"}
+
+var checkers = []checker{
+	checkRun,
+	checkWinlogon,
+	checkIFEO,
+	checkAppInit,
+	checkScheduledTasks,
+	checkActiveSetup,
+	checkCOM,
+}
+
+// Parse 在 hive 中查找所有已知的自启动位置,不同类型的 hive 中只会找到其中一部分
+func Parse(reg *registry.Registry) ([]*Entry, error) {
+	if reg.Root() == nil {
+		return nil, fmt.Errorf("%w: root", registry.ErrNotFound)
+	}
+	result := make([]*Entry, 0)
+	for _, prefix := range softwarePrefixes {
+		for _, check := range checkers {
+			result = append(result, check(reg, prefix)...)
+		}
+	}
+	if cs := reg.CurrentControlSet(); cs != nil {
+		result = append(result, checkServices(cs)...)
+		result = append(result, checkLSA(cs)...)
+		result = append(result, checkBootExecute(cs)...)
+	}
+	return result, nil
+}
+
+// valueStrings 返回值中的字符串,REG_MULTI_SZ 返回每一项
+func valueStrings(v *registry.RegistryValue) []string {
+	if s, err := v.AsStrings(); err == nil {
+		return s
+	}
+	return nil
+}
+
+// valueEntries 把键中的每个字符串值作为一个自启动项,names 为空时取所有值
+func valueEntries(key *registry.RegistryKey, category Category, names ...string) []*Entry {
+	result := make([]*Entry, 0)
+	if key == nil {
+		return result
+	}
+	var values []*registry.RegistryValue
+	if len(names) == 0 {
+		values = key.Values()
+	} else {
+		for _, name := range names {
+			if v := key.Value(name); v != nil {
+				values = append(values, v)
+			}
+		}
+	}
+	for _, v := range values {
+		for _, s := range valueStrings(v) {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			result = append(result, &Entry{
+				Category:     category,
+				KeyPath:      key.Path(),
+				Name:         v.Name(),
+				Command:      s,
+				KeyLastWrite: key.Timestamp(),
+			})
+		}
+	}
+	return result
+}
+
+var runKeys = []string{
+	"Microsoft\\Windows\\CurrentVersion\\Run",
+	"Microsoft\\Windows\\CurrentVersion\\RunOnce",
+	"Microsoft\\Windows\\CurrentVersion\\RunServices",
+	"Microsoft\\Windows\\CurrentVersion\\RunServicesOnce",
+	"Microsoft\\Windows\\CurrentVersion\\Policies\\Explorer\\Run",
+	"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Run",
+	"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\RunOnce",
+}
+
+func checkRun(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	for _, p := range runKeys {
+		key := reg.Open(prefix + p)
+		result = append(result, valueEntries(key, CategoryRun)...)
+		// RunOnceEx 等键的子键中也可能保存命令
+		for _, sub := range key.Subkeys() {
+			result = append(result, valueEntries(sub, CategoryRun)...)
+		}
+	}
+	// NTUSER.DAT 中 Windows 键的 Load / Run 值
+	if prefix != "" {
+		key := reg.Open(prefix + "Microsoft\\Windows NT\\CurrentVersion\\Windows")
+		result = append(result, valueEntries(key, CategoryRun, "Load", "Run")...)
+	}
+	return result
+}
+
+func checkWinlogon(reg *registry.Registry, prefix string) []*Entry {
+	key := reg.Open(prefix + "Microsoft\\Windows NT\\CurrentVersion\\Winlogon")
+	return valueEntries(key, CategoryWinlogon, "Shell", "Userinit", "Taskman", "AppSetup", "VMApplet")
+}
+
+func checkIFEO(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	for _, p := range []string{
+		"Microsoft\\Windows NT\\CurrentVersion\\Image File Execution Options",
+		"Wow6432Node\\Microsoft\\Windows NT\\CurrentVersion\\Image File Execution Options",
+	} {
+		for _, sub := range reg.Open(prefix + p).Subkeys() {
+			for _, e := range valueEntries(sub, CategoryIFEO, "Debugger") {
+				e.Name = sub.Name()
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+func checkAppInit(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	for _, p := range []string{
+		"Microsoft\\Windows NT\\CurrentVersion\\Windows",
+		"Wow6432Node\\Microsoft\\Windows NT\\CurrentVersion\\Windows",
+	} {
+		result = append(result, valueEntries(reg.Open(prefix+p), CategoryAppInit, "AppInit_DLLs")...)
+	}
+	return result
+}
+
+func checkActiveSetup(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	for _, p := range []string{
+		"Microsoft\\Active Setup\\Installed Components",
+		"Wow6432Node\\Microsoft\\Active Setup\\Installed Components",
+	} {
+		for _, sub := range reg.Open(prefix + p).Subkeys() {
+			for _, e := range valueEntries(sub, CategoryActiveSetup, "StubPath") {
+				e.Name = sub.Name()
+				if name, err := sub.GetStringValue("(default)"); err == nil && name != "" {
+					e.Name = sub.Name() + " (" + name + ")"
+				}
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+// checkCOM 列出用户 Classes 中注册的 COM 服务器。用户 Classes 优先于 HKLM,
+// 因此其中出现的 InprocServer32 / LocalServer32 都可能是 COM 劫持
+func checkCOM(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	paths := []string{"Software\\Classes\\CLSID", "Software\\Classes\\Wow6432Node\\CLSID"}
+	if prefix == "" {
+		// UsrClass.dat 的根键即为 HKCU\Software\Classes
+		paths = []string{"CLSID", "Wow6432Node\\CLSID"}
+	}
+	for _, p := range paths {
+		for _, clsid := range reg.Open(p).Subkeys() {
+			for _, server := range []string{"InprocServer32", "LocalServer32"} {
+				for _, e := range valueEntries(clsid.SubKey(server), CategoryCOM, "(default)") {
+					e.Name = clsid.Name()
+					result = append(result, e)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// serviceStartAuto 为自动启动的服务启动类型的最大值(0 Boot、1 System、2 Automatic)
+const serviceStartAuto = 2
+
+// checkServices 列出自动启动的服务及其 ImagePath 和 ServiceDll
+func checkServices(cs *registry.RegistryKey) []*Entry {
+	result := make([]*Entry, 0)
+	for _, svc := range cs.FindKey("Services").Subkeys() {
+		start, err := svc.GetInt32Value("Start")
+		if err != nil || start > serviceStartAuto {
+			continue
+		}
+		for _, e := range valueEntries(svc, CategoryService, "ImagePath") {
+			e.Name = svc.Name()
+			result = append(result, e)
+		}
+		for _, e := range valueEntries(svc.SubKey("Parameters"), CategoryService, "ServiceDll") {
+			e.Name = svc.Name()
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func checkLSA(cs *registry.RegistryKey) []*Entry {
+	result := make([]*Entry, 0)
+	packages := []string{"Authentication Packages", "Notification Packages", "Security Packages"}
+	result = append(result, valueEntries(cs.FindKey("Control\\Lsa"), CategoryLSA, packages...)...)
+	result = append(result, valueEntries(cs.FindKey("Control\\Lsa\\OSConfig"), CategoryLSA, "Security Packages")...)
+	return result
+}
+
+func checkBootExecute(cs *registry.RegistryKey) []*Entry {
+	return valueEntries(cs.FindKey("Control\\Session Manager"), CategoryBootExecute, "BootExecute", "SetupExecute", "Execute")
+}
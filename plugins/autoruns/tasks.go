@@ -0,0 +1,132 @@
+package autoruns
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+const taskCache = "Microsoft\\Windows NT\\CurrentVersion\\Schedule\\TaskCache"
+
+// Actions 中操作的类型
+const (
+	actionExec       = 0x6666
+	actionComHandler = 0x7777
+	actionEmail      = 0x8888
+	actionMessageBox = 0x9999
+)
+
+// checkScheduledTasks 遍历 TaskCache\Tree,通过 Id 找到 TaskCache\Tasks\{Id} 并解析其中的 Actions
+func checkScheduledTasks(reg *registry.Registry, prefix string) []*Entry {
+	result := make([]*Entry, 0)
+	tree := reg.Open(prefix + taskCache + "\\Tree")
+	if tree == nil {
+		return result
+	}
+	tasks := reg.Open(prefix + taskCache + "\\Tasks")
+	walkTaskTree(tree, "", tasks, 0, &result)
+	return result
+}
+
+func walkTaskTree(key *registry.RegistryKey, path string, tasks *registry.RegistryKey, depth int, result *[]*Entry) {
+	if depth > 32 {
+		return
+	}
+	for _, sub := range key.Subkeys() {
+		taskPath := path + "\\" + sub.Name()
+		if id, err := sub.GetStringValue("Id"); err == nil {
+			entry := &Entry{
+				Category:     CategoryScheduledTask,
+				KeyPath:      sub.Path(),
+				Name:         taskPath,
+				KeyLastWrite: sub.Timestamp(),
+			}
+			if actions, err := tasks.SubKey(id).GetBinaryValue("Actions"); err == nil {
+				entry.Command = strings.Join(ParseTaskActions(actions), "; ")
+			}
+			*result = append(*result, entry)
+		}
+		walkTaskTree(sub, taskPath, tasks, depth+1, result)
+	}
+}
+
+// ParseTaskActions 解析 TaskCache\Tasks\{Id} 中 Actions 值,返回每个操作的描述,
+// 执行操作为 "命令 参数",COM 操作为 "COM {CLSID} 数据"
+func ParseTaskActions(data []byte) []string {
+	result := make([]string, 0)
+	r := &actionReader{data: data}
+	version := r.u16()
+	if version >= 2 {
+		// 版本 2 之后操作前为执行者的上下文 ID,如 "Author"
+		r.str()
+	}
+	for !r.failed && r.pos+2 <= len(data) {
+		switch r.u16() {
+		case actionExec:
+			r.str()
+			command := r.str()
+			args := r.str()
+			r.str()
+			if version >= 3 {
+				r.u16()
+			}
+			if r.failed {
+				return result
+			}
+			result = append(result, strings.TrimSpace(command+" "+args))
+		case actionComHandler:
+			r.str()
+			clsid := r.bytes(16)
+			payload := r.str()
+			if r.failed {
+				return result
+			}
+			result = append(result, strings.TrimSpace("COM {"+strings.ToUpper(registry.ReadGuid(clsid).String())+"} "+payload))
+		case actionEmail, actionMessageBox:
+			// 已废弃的操作类型,不再解析后续内容
+			return result
+		default:
+			return result
+		}
+	}
+	return result
+}
+
+// actionReader 顺序读取 Actions 数据,越界之后的读取都返回零值
+type actionReader struct {
+	data   []byte
+	pos    int
+	failed bool
+}
+
+func (r *actionReader) bytes(n int) []byte {
+	if r.failed || n < 0 || r.pos+n > len(r.data) {
+		r.failed = true
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *actionReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+// str 读取以 4 字节长度(字节数)开头的 UTF-16 字符串
+func (r *actionReader) str() string {
+	b := r.bytes(4)
+	if b == nil {
+		return ""
+	}
+	s := r.bytes(int(binary.LittleEndian.Uint32(b)))
+	if s == nil {
+		return ""
+	}
+	return strings.TrimRight(utils.DecodeUTF16(s[:len(s)&^1]), "\x00")
+}
@@ -0,0 +1,301 @@
+// Package mru 解析 NTUSER.DAT 中各种最近使用(MRU)列表,
+// 按 MRUList / MRUListEx 还原从新到旧的顺序
+package mru
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/plugins/shellbags"
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// Entry 为 MRU 列表中的一项
+type Entry struct {
+	// Location 为列表所属的位置名称,如 "RecentDocs"
+	Location string
+	KeyPath  string
+	Value    string
+	// Position 为在列表中的位置,0 为最近使用的项
+	Position int
+	// Name 为解码出的字符串,如文件名、命令或搜索词
+	Name string
+	// Program 为 LastVisitedMRU 中打开文件对话框的程序
+	Program string
+	// Path 与 Items 为由 PIDL 还原出的路径和 Shell Item
+	Path  string
+	Items []*shellbags.ShellItem
+	// LastWrite 只对 Position 为 0 的项有值,为键的最后写入时间,即该项最后一次被使用的时间
+	LastWrite    time.Time
+	KeyLastWrite time.Time
+	Raw          []byte
+}
+
+// Decoder 把一个 MRU 值解码到 entry 中,返回错误时跳过该值
+type Decoder func(entry *Entry, value *registry.RegistryValue) error
+
+var errEmpty = errors.New("空的 MRU 项")
+
+// Ordered 按 MRUListEx 或 MRUList 返回从新到旧排列的值。
+// 两者都不存在时(如 TypedPaths 的 url1..urlN),按值名中的数字从小到大排列
+func Ordered(key *registry.RegistryKey) []*registry.RegistryValue {
+	values := make(map[string]*registry.RegistryValue)
+	rest := make([]*registry.RegistryValue, 0)
+	for _, v := range key.Values() {
+		name := v.Name()
+		if strings.EqualFold(name, "MRUList") || strings.EqualFold(name, "MRUListEx") {
+			continue
+		}
+		values[strings.ToLower(name)] = v
+		rest = append(rest, v)
+	}
+	var order []string
+	if data, err := key.GetBinaryValue("MRUListEx"); err == nil {
+		for _, n := range utils.ParseMRUListEx(data) {
+			order = append(order, strconv.Itoa(int(n)))
+		}
+	} else if s, err := key.GetStringValue("MRUList"); err == nil {
+		order = utils.ParseMRUList(s)
+	}
+	if order == nil {
+		sort.SliceStable(rest, func(i, j int) bool {
+			return trailingNumber(rest[i].Name()) < trailingNumber(rest[j].Name())
+		})
+		return rest
+	}
+	result := make([]*registry.RegistryValue, 0, len(order))
+	for _, name := range order {
+		if v, ok := values[strings.ToLower(name)]; ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// trailingNumber 返回值名末尾的数字,没有数字时返回一个较大的值使其排在最后
+func trailingNumber(name string) int {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	n, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return int(^uint(0) >> 1)
+	}
+	return n
+}
+
+// ParseKey 按顺序解码 key 中的 MRU 列表,location 为记录在 Entry 中的位置名称
+func ParseKey(key *registry.RegistryKey, location string, decode Decoder) []*Entry {
+	result := make([]*Entry, 0)
+	for i, value := range Ordered(key) {
+		entry := &Entry{
+			Location:     location,
+			KeyPath:      key.Path(),
+			Value:        value.Name(),
+			Position:     i,
+			KeyLastWrite: key.Timestamp(),
+		}
+		if err := decode(entry, value); err != nil {
+			continue
+		}
+		if entry.Position == 0 {
+			entry.LastWrite = key.Timestamp()
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// DecodeString 解码字符串值,二进制值按 UTF-16 解码
+func DecodeString(entry *Entry, value *registry.RegistryValue) error {
+	if s, err := value.AsString(); err == nil {
+		entry.Name = s
+	} else if b, err := value.AsBinary(); err == nil {
+		entry.Raw = b
+		entry.Name, _ = cutUTF16(b)
+	} else {
+		return err
+	}
+	if entry.Name == "" {
+		return errEmpty
+	}
+	return nil
+}
+
+// DecodeRunMRU 解码 RunMRU 中的命令,去掉结尾的 "\1"
+func DecodeRunMRU(entry *Entry, value *registry.RegistryValue) error {
+	if err := DecodeString(entry, value); err != nil {
+		return err
+	}
+	entry.Name = strings.TrimSuffix(entry.Name, "\\1")
+	return nil
+}
+
+// DecodePIDL 把值作为 ItemIDList 解析并还原路径
+func DecodePIDL(entry *Entry, value *registry.RegistryValue) error {
+	data, err := value.AsBinary()
+	if err != nil {
+		return err
+	}
+	entry.Raw = data
+	entry.Items = shellbags.ParseItemIDList(data)
+	if len(entry.Items) == 0 {
+		return errEmpty
+	}
+	entry.Path = itemsPath(entry.Items)
+	entry.Name = entry.Items[len(entry.Items)-1].Name
+	return nil
+}
+
+// DecodeRecentDocs 解码 RecentDocs 中的值:UTF-16 文件名,之后为对应快捷方式的 Shell Item
+func DecodeRecentDocs(entry *Entry, value *registry.RegistryValue) error {
+	data, err := value.AsBinary()
+	if err != nil {
+		return err
+	}
+	entry.Raw = data
+	name, end := cutUTF16(data)
+	if name == "" {
+		return errEmpty
+	}
+	entry.Name = name
+	if end < len(data) {
+		entry.Items = shellbags.ParseItemIDList(data[end:])
+	}
+	return nil
+}
+
+// DecodeLastVisitedPidl 解码 LastVisitedPidlMRU 中的值:UTF-16 程序名,之后为最后访问目录的 PIDL
+func DecodeLastVisitedPidl(entry *Entry, value *registry.RegistryValue) error {
+	data, err := value.AsBinary()
+	if err != nil {
+		return err
+	}
+	entry.Raw = data
+	program, end := cutUTF16(data)
+	if program == "" {
+		return errEmpty
+	}
+	entry.Program = program
+	entry.Name = program
+	if end < len(data) {
+		entry.Items = shellbags.ParseItemIDList(data[end:])
+		entry.Path = itemsPath(entry.Items)
+	}
+	return nil
+}
+
+// DecodeLastVisited 解码 Windows XP 中 LastVisitedMRU 的值:UTF-16 程序名与 UTF-16 目录
+func DecodeLastVisited(entry *Entry, value *registry.RegistryValue) error {
+	data, err := value.AsBinary()
+	if err != nil {
+		return err
+	}
+	entry.Raw = data
+	program, end := cutUTF16(data)
+	if program == "" {
+		return errEmpty
+	}
+	entry.Program = program
+	entry.Name = program
+	if end < len(data) {
+		entry.Path, _ = cutUTF16(data[end:])
+	}
+	return nil
+}
+
+// cutUTF16 读取开头以 \0\0 结尾的 UTF-16LE 字符串,返回字符串和结尾之后的偏移
+func cutUTF16(data []byte) (string, int) {
+	end := 0
+	for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+		end += 2
+	}
+	if end+1 >= len(data) {
+		return utils.DecodeUTF16(data[:end]), len(data)
+	}
+	return utils.DecodeUTF16(data[:end]), end + 2
+}
+
+// itemsPath 用反斜杠拼接 Shell Item 的名称
+func itemsPath(items []*shellbags.ShellItem) string {
+	path := ""
+	for _, item := range items {
+		if path == "" {
+			path = item.Name
+			continue
+		}
+		path = strings.TrimRight(path, "\\") + "\\" + item.Name
+	}
+	return path
+}
+
+// Location 为一个已知的 MRU 位置
+type Location struct {
+	Name string
+	// Path 为相对于 NTUSER.DAT 根键的路径
+	Path string
+	// Subkeys 表示除该键本身外,其每个子键(如按扩展名划分的列表)也是一个 MRU 列表
+	Subkeys bool
+	Decode  Decoder
+}
+
+const explorer = "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\"
+
+// 已知的 MRU 位置
+var (
+	RecentDocs               = Location{"RecentDocs", explorer + "RecentDocs", true, DecodeRecentDocs}
+	RunMRU                   = Location{"RunMRU", explorer + "RunMRU", false, DecodeRunMRU}
+	TypedPaths               = Location{"TypedPaths", explorer + "TypedPaths", false, DecodeString}
+	WordWheelQuery           = Location{"WordWheelQuery", explorer + "WordWheelQuery", false, DecodeString}
+	OpenSavePidlMRU          = Location{"OpenSavePidlMRU", explorer + "ComDlg32\\OpenSavePidlMRU", true, DecodePIDL}
+	LastVisitedPidlMRU       = Location{"LastVisitedPidlMRU", explorer + "ComDlg32\\LastVisitedPidlMRU", false, DecodeLastVisitedPidl}
+	LastVisitedPidlMRULegacy = Location{"LastVisitedPidlMRULegacy", explorer + "ComDlg32\\LastVisitedPidlMRULegacy", false, DecodeLastVisitedPidl}
+	OpenSaveMRU              = Location{"OpenSaveMRU", explorer + "ComDlg32\\OpenSaveMRU", true, DecodeString}
+	LastVisitedMRU           = Location{"LastVisitedMRU", explorer + "ComDlg32\\LastVisitedMRU", false, DecodeLastVisited}
+)
+
+// Locations 为 Parse 会解析的所有已知位置
+var Locations = []Location{
+	RecentDocs, RunMRU, TypedPaths, WordWheelQuery,
+	OpenSavePidlMRU, LastVisitedPidlMRU, LastVisitedPidlMRULegacy,
+	OpenSaveMRU, LastVisitedMRU,
+}
+
+// Parse 解析该位置的 MRU 列表,位置不存在时返回 ErrNotFound
+func (l Location) Parse(reg *registry.Registry) ([]*Entry, error) {
+	key := reg.Open(l.Path)
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", registry.ErrNotFound, l.Path)
+	}
+	result := ParseKey(key, l.Name, l.Decode)
+	if l.Subkeys {
+		for _, sub := range key.Subkeys() {
+			result = append(result, ParseKey(sub, l.Name, l.Decode)...)
+		}
+	}
+	return result, nil
+}
+
+// Parse 解析 NTUSER.DAT 中所有已知位置的 MRU 列表
+func Parse(reg *registry.Registry) ([]*Entry, error) {
+	result := make([]*Entry, 0)
+	found := false
+	for _, l := range Locations {
+		entries, err := l.Parse(reg)
+		if err != nil {
+			continue
+		}
+		found = true
+		result = append(result, entries...)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: MRU", registry.ErrNotFound)
+	}
+	return result, nil
+}
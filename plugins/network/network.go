@@ -0,0 +1,200 @@
+// Package network 汇总 SOFTWARE 中的 NetworkList 与 SYSTEM 中的 Tcpip 接口配置,
+// 得到主机连接过的网络及其时间
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	profilesLocation   = "Microsoft\\Windows NT\\CurrentVersion\\NetworkList\\Profiles"
+	signaturesLocation = "Microsoft\\Windows NT\\CurrentVersion\\NetworkList\\Signatures"
+	interfacesLocation = "Services\\Tcpip\\Parameters\\Interfaces"
+)
+
+// Category 为网络位置类别
+type Category uint32
+
+const (
+	CategoryPublic Category = iota
+	CategoryPrivate
+	CategoryDomain
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategoryPublic:
+		return "Public"
+	case CategoryPrivate:
+		return "Private"
+	case CategoryDomain:
+		return "Domain"
+	}
+	return fmt.Sprintf("Unknown (%d)", uint32(c))
+}
+
+// NameType 为网络的连接类型,取值为 IANA ifType
+type NameType uint32
+
+const (
+	NameTypeWired     NameType = 0x06
+	NameTypeBroadband NameType = 0x17
+	NameTypeWireless  NameType = 0x47
+	NameTypeMobile    NameType = 0xF3
+)
+
+func (n NameType) String() string {
+	switch n {
+	case NameTypeWired:
+		return "Wired"
+	case NameTypeBroadband:
+		return "Broadband"
+	case NameTypeWireless:
+		return "Wireless"
+	case NameTypeMobile:
+		return "Mobile Broadband"
+	}
+	return fmt.Sprintf("Unknown (0x%X)", uint32(n))
+}
+
+// Profile 为 NetworkList\Profiles 下的一个网络,并合并了 Signatures 中对应的记录
+type Profile struct {
+	GUID         string    `reg:",keyname"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+	ProfileName  string    `reg:"ProfileName,optional"`
+	Description  string    `reg:"Description,optional"`
+	Managed      bool      `reg:"Managed,optional"`
+	Category     Category  `reg:"Category,optional"`
+	NameType     NameType  `reg:"NameType,optional"`
+	// DateCreated 与 DateLastConnected 为 SYSTEMTIME,保存的是本地时间
+	DateCreated       time.Time `reg:"DateCreated,optional,systemtime"`
+	DateLastConnected time.Time `reg:"DateLastConnected,optional,systemtime"`
+	// 以下字段来自 Signatures\Managed 或 Signatures\Unmanaged
+	SignatureKey string `reg:"-"`
+	DNSSuffix    string `reg:"-"`
+	FirstNetwork string `reg:"-"`
+	GatewayMAC   string `reg:"-"`
+}
+
+// signature 为 NetworkList\Signatures 下的一条记录
+type signature struct {
+	ProfileGUID  string `reg:"ProfileGuid,optional"`
+	DNSSuffix    string `reg:"DnsSuffix,optional"`
+	FirstNetwork string `reg:"FirstNetwork,optional"`
+	GatewayMAC   []byte `reg:"DefaultGatewayMac,optional"`
+}
+
+// Interface 为 Tcpip\Parameters\Interfaces 下的一个接口,
+// Windows 10 中同一接口连接过的每个网络保存为其子键,同样作为一个 Interface 返回
+type Interface struct {
+	GUID           string    `reg:"-"`
+	KeyPath        string    `reg:"-"`
+	KeyLastWrite   time.Time `reg:",timestamp"`
+	EnableDHCP     bool      `reg:"EnableDHCP,optional"`
+	IPAddress      []string  `reg:"IPAddress,optional"`
+	SubnetMask     []string  `reg:"SubnetMask,optional"`
+	DefaultGateway []string  `reg:"DefaultGateway,optional"`
+	NameServer     string    `reg:"NameServer,optional"`
+	Domain         string    `reg:"Domain,optional"`
+	DhcpIPAddress  string    `reg:"DhcpIPAddress,optional"`
+	DhcpSubnetMask string    `reg:"DhcpSubnetMask,optional"`
+	DhcpServer     string    `reg:"DhcpServer,optional"`
+	DhcpGateway    []string  `reg:"DhcpDefaultGateway,optional"`
+	DhcpNameServer string    `reg:"DhcpNameServer,optional"`
+	DhcpDomain     string    `reg:"DhcpDomain,optional"`
+	// 租约时间为 Unix 秒数
+	LeaseObtained   time.Time `reg:"LeaseObtainedTime,optional,unix"`
+	LeaseTerminates time.Time `reg:"LeaseTerminatesTime,optional,unix"`
+}
+
+// Report 为网络历史的汇总
+type Report struct {
+	Profiles   []*Profile
+	Interfaces []*Interface
+}
+
+// Parse 从 SOFTWARE 与 SYSTEM 中汇总网络历史,两者都可以为 nil
+func Parse(software, system *registry.Registry) (*Report, error) {
+	report := &Report{Profiles: make([]*Profile, 0), Interfaces: make([]*Interface, 0)}
+	var errs []error
+	found := false
+	if key := software.Open(profilesLocation); key != nil {
+		found = true
+		profiles, err := ParseProfiles(key, software.Open(signaturesLocation))
+		report.Profiles = profiles
+		errs = append(errs, err)
+	}
+	if cs := system.CurrentControlSet(); cs != nil {
+		if key := cs.FindKey(interfacesLocation); key != nil {
+			found = true
+			interfaces, err := ParseInterfaces(key)
+			report.Interfaces = interfaces
+			errs = append(errs, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: NetworkList / Tcpip", registry.ErrNotFound)
+	}
+	return report, errors.Join(errs...)
+}
+
+// ParseProfiles 解析 NetworkList\Profiles,signatures 为 NetworkList\Signatures,可以为 nil。
+// 结果按最后连接时间从新到旧排序
+func ParseProfiles(profiles, signatures *registry.RegistryKey) ([]*Profile, error) {
+	result := make([]*Profile, 0)
+	index := make(map[string]*Profile)
+	var errs []error
+	for _, sub := range profiles.Subkeys() {
+		p := &Profile{}
+		if err := sub.Unmarshal(p); err != nil {
+			errs = append(errs, err)
+		}
+		index[strings.ToUpper(p.GUID)] = p
+		result = append(result, p)
+	}
+	for _, kind := range []string{"Managed", "Unmanaged"} {
+		for _, sub := range signatures.SubKey(kind).Subkeys() {
+			var s signature
+			if err := sub.Unmarshal(&s); err != nil {
+				errs = append(errs, err)
+			}
+			p, ok := index[strings.ToUpper(s.ProfileGUID)]
+			if !ok {
+				continue
+			}
+			p.SignatureKey = sub.Path()
+			p.DNSSuffix = s.DNSSuffix
+			p.FirstNetwork = s.FirstNetwork
+			if len(s.GatewayMAC) == 6 {
+				p.GatewayMAC = strings.ToUpper(net.HardwareAddr(s.GatewayMAC).String())
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DateLastConnected.After(result[j].DateLastConnected)
+	})
+	return result, errors.Join(errs...)
+}
+
+// ParseInterfaces 解析 Tcpip\Parameters\Interfaces 下的接口及其按网络保存的子键
+func ParseInterfaces(key *registry.RegistryKey) ([]*Interface, error) {
+	result := make([]*Interface, 0)
+	var errs []error
+	for _, iface := range key.Subkeys() {
+		for _, k := range append([]*registry.RegistryKey{iface}, iface.Subkeys()...) {
+			i := &Interface{GUID: iface.Name(), KeyPath: k.Path()}
+			if err := k.Unmarshal(i); err != nil {
+				errs = append(errs, err)
+			}
+			result = append(result, i)
+		}
+	}
+	return result, errors.Join(errs...)
+}
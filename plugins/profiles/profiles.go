@@ -0,0 +1,243 @@
+// Package profiles 根据 SOFTWARE 中的 ProfileList、SAM 中的账户名与知名 SID
+// 把 BAM、HKU 路径与安全描述符中出现的 SID 解析为用户名
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	profileListLocation = "Microsoft\\Windows NT\\CurrentVersion\\ProfileList"
+	accountLocation     = "SAM\\Domains\\Account"
+	builtinLocation     = "SAM\\Domains\\Builtin"
+	builtinSID          = "S-1-5-32"
+)
+
+// Profile 为 ProfileList 下的一个用户配置文件
+type Profile struct {
+	// SID 为键名,临时配置文件对应的键名带有 .bak 后缀,此处已去掉
+	SID          string    `reg:"-"`
+	KeyName      string    `reg:",keyname"`
+	ImagePath    string    `reg:"ProfileImagePath,optional"`
+	Flags        uint32    `reg:"Flags,optional"`
+	State        uint32    `reg:"State,optional"`
+	RefCount     uint32    `reg:"RefCount,optional"`
+	RawSID       []byte    `reg:"Sid,optional"`
+	Username     string    `reg:"-"`
+	Temporary    bool      `reg:"-"`
+	LoadTime     time.Time `reg:"-"`
+	UnloadTime   time.Time `reg:"-"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+}
+
+// Account 为 SAM 中的本地用户或本地组
+type Account struct {
+	SID  string
+	Name string
+	RID  uint32
+	// Group 为 true 时表示来自 Aliases 的本地组
+	Group        bool
+	KeyLastWrite time.Time
+}
+
+// Resolver 把 SID 解析为账户名,依次查找 SAM 账户、知名 SID 与用户配置文件
+type Resolver struct {
+	// DomainSID 为 SAM 中记录的本机 SID,SAM 不可用时为空
+	DomainSID string
+	Profiles  []*Profile
+	Accounts  []*Account
+	names     map[string]string
+	profiles  map[string]*Profile
+}
+
+var _ registry.SIDResolver = (*Resolver)(nil)
+
+// NewResolver 从 SOFTWARE 与 SAM 中建立解析器,两者都可以为 nil。
+// 两者都找不到时仍返回只能解析知名 SID 的解析器,同时返回 ErrNotFound
+func NewResolver(software, sam *registry.Registry) (*Resolver, error) {
+	r := &Resolver{
+		Profiles: make([]*Profile, 0),
+		Accounts: make([]*Account, 0),
+		names:    make(map[string]string),
+		profiles: make(map[string]*Profile),
+	}
+	var errs []error
+	found := false
+	if key := software.Open(profileListLocation); key != nil {
+		found = true
+		profiles, err := ParseProfileList(key)
+		errs = append(errs, err)
+		for _, p := range profiles {
+			r.addProfile(p)
+		}
+	}
+	if key := sam.Open(accountLocation); key != nil {
+		found = true
+		accounts, domainSID, err := ParseSAM(sam)
+		errs = append(errs, err)
+		r.DomainSID = domainSID
+		for _, a := range accounts {
+			r.Add(a.SID, a.Name)
+			r.Accounts = append(r.Accounts, a)
+		}
+	}
+	if !found {
+		errs = append(errs, fmt.Errorf("%w: ProfileList / SAM", registry.ErrNotFound))
+	}
+	return r, errors.Join(errs...)
+}
+
+func (r *Resolver) addProfile(p *Profile) {
+	sid := strings.ToUpper(p.SID)
+	// 同一 SID 同时存在正常键与 .bak 键时以正常键为准
+	if old, ok := r.profiles[sid]; ok && !old.Temporary {
+		r.Profiles = append(r.Profiles, p)
+		return
+	}
+	r.profiles[sid] = p
+	r.Profiles = append(r.Profiles, p)
+}
+
+// Add 添加或覆盖一个 SID 对应的名称,如从域控导出的映射
+func (r *Resolver) Add(sid, name string) {
+	r.names[strings.ToUpper(sid)] = name
+}
+
+// Lookup 返回 SID 对应的账户名,依次查找 SAM 账户与手动添加的名称、知名 SID、
+// ProfileList 中配置文件路径的最后一级目录名
+func (r *Resolver) Lookup(sid string) (string, bool) {
+	if r == nil {
+		return registry.WellKnownSID(sid)
+	}
+	sid = strings.ToUpper(sid)
+	if name, ok := r.names[sid]; ok {
+		return name, true
+	}
+	if name, ok := registry.WellKnownSID(sid); ok {
+		return name, true
+	}
+	if p, ok := r.profiles[sid]; ok && p.Username != "" {
+		return p.Username, true
+	}
+	return "", false
+}
+
+// Name 返回 SID 对应的账户名,无法解析时原样返回 SID
+func (r *Resolver) Name(sid string) string {
+	if name, ok := r.Lookup(sid); ok {
+		return name
+	}
+	return sid
+}
+
+// Profile 返回 SID 对应的用户配置文件,不存在时返回 nil
+func (r *Resolver) Profile(sid string) *Profile {
+	if r == nil {
+		return nil
+	}
+	return r.profiles[strings.ToUpper(sid)]
+}
+
+// ParseProfileList 解析 ProfileList 键,结果按最后加载时间从新到旧排序
+func ParseProfileList(key *registry.RegistryKey) ([]*Profile, error) {
+	result := make([]*Profile, 0)
+	var errs []error
+	for _, sub := range key.Subkeys() {
+		p := &Profile{}
+		if err := sub.Unmarshal(p); err != nil {
+			errs = append(errs, err)
+		}
+		p.SID = p.KeyName
+		if strings.HasSuffix(strings.ToLower(p.SID), ".bak") {
+			p.SID = p.SID[:len(p.SID)-4]
+			p.Temporary = true
+		}
+		if i := strings.LastIndexAny(p.ImagePath, "\\/"); i >= 0 {
+			p.Username = p.ImagePath[i+1:]
+		} else {
+			p.Username = p.ImagePath
+		}
+		p.LoadTime = filetimePair(sub, "LocalProfileLoadTime")
+		p.UnloadTime = filetimePair(sub, "LocalProfileUnloadTime")
+		result = append(result, p)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LoadTime.After(result[j].LoadTime)
+	})
+	return result, errors.Join(errs...)
+}
+
+// filetimePair 把以 <name>High 与 <name>Low 两个 DWORD 分开保存的 FILETIME 合并,任一值缺失时返回零值
+func filetimePair(key *registry.RegistryKey, name string) time.Time {
+	high, err := key.GetInt32Value(name + "High")
+	if err != nil {
+		return time.Time{}
+	}
+	low, err := key.GetInt32Value(name + "Low")
+	if err != nil || high == 0 && low == 0 {
+		return time.Time{}
+	}
+	return registry.ParseWindowsTimestamp(int64(uint64(high)<<32 | uint64(low)))
+}
+
+// ParseSAM 解析 SAM 中的本地用户、本地组与内置组,并返回本机 SID。
+// Names 子键下每个账户名键的默认值不保存数据,其类型字段即为账户的 RID
+func ParseSAM(sam *registry.Registry) ([]*Account, string, error) {
+	account := sam.Open(accountLocation)
+	if account == nil {
+		return nil, "", fmt.Errorf("%w: %s", registry.ErrNotFound, accountLocation)
+	}
+	var errs []error
+	domainSID, err := parseDomainSID(account)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	result := make([]*Account, 0)
+	if domainSID != "" {
+		result = append(result, parseNames(account.FindKey("Users\\Names"), domainSID, false)...)
+		result = append(result, parseNames(account.FindKey("Aliases\\Names"), domainSID, true)...)
+	}
+	result = append(result, parseNames(sam.Open(builtinLocation+"\\Aliases\\Names"), builtinSID, true)...)
+	return result, domainSID, errors.Join(errs...)
+}
+
+// parseDomainSID 从 Domains\Account 的 V 值中取得本机 SID,位于 V 值的最后 24 字节
+func parseDomainSID(account *registry.RegistryKey) (string, error) {
+	v, err := account.GetBinaryValue("V")
+	if err != nil {
+		return "", err
+	}
+	if len(v) < 24 {
+		return "", fmt.Errorf("%w: %s\\V 长度为 %d", registry.ErrCorrupt, account.Path(), len(v))
+	}
+	sid, _, err := registry.ParseSID(v[len(v)-24:])
+	if err != nil {
+		return "", fmt.Errorf("%s\\V: %w", account.Path(), err)
+	}
+	return sid, nil
+}
+
+func parseNames(names *registry.RegistryKey, domainSID string, group bool) []*Account {
+	result := make([]*Account, 0)
+	for _, sub := range names.Subkeys() {
+		value := sub.Value("(default)")
+		if value == nil {
+			continue
+		}
+		rid := value.Value_type_raw()
+		result = append(result, &Account{
+			SID:          fmt.Sprintf("%s-%d", domainSID, rid),
+			Name:         sub.Name(),
+			RID:          rid,
+			Group:        group,
+			KeyLastWrite: sub.Timestamp(),
+		})
+	}
+	return result
+}
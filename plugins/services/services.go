@@ -0,0 +1,262 @@
+// Package services 解析 SYSTEM hive 中每个 ControlSet 下的服务与驱动配置
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// ServiceType 为服务的 Type 值,可以是多个标志的组合
+type ServiceType uint32
+
+const (
+	TypeKernelDriver        ServiceType = 0x1
+	TypeFileSystemDriver    ServiceType = 0x2
+	TypeAdapter             ServiceType = 0x4
+	TypeRecognizerDriver    ServiceType = 0x8
+	TypeWin32OwnProcess     ServiceType = 0x10
+	TypeWin32ShareProcess   ServiceType = 0x20
+	TypeUserService         ServiceType = 0x40
+	TypeUserServiceInstance ServiceType = 0x80
+	TypeInteractiveProcess  ServiceType = 0x100
+	TypePackagedService     ServiceType = 0x200
+)
+
+var serviceTypeNames = []struct {
+	flag ServiceType
+	name string
+}{
+	{TypeKernelDriver, "Kernel Driver"},
+	{TypeFileSystemDriver, "File System Driver"},
+	{TypeAdapter, "Adapter"},
+	{TypeRecognizerDriver, "Recognizer Driver"},
+	{TypeWin32OwnProcess, "Own Process"},
+	{TypeWin32ShareProcess, "Share Process"},
+	{TypeUserService, "User Service"},
+	{TypeUserServiceInstance, "User Service Instance"},
+	{TypeInteractiveProcess, "Interactive"},
+	{TypePackagedService, "Packaged Service"},
+}
+
+func (t ServiceType) String() string {
+	names := make([]string, 0)
+	rest := t
+	for _, n := range serviceTypeNames {
+		if t&n.flag != 0 {
+			names = append(names, n.name)
+			rest &^= n.flag
+		}
+	}
+	if rest != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("0x%X", uint32(rest)))
+	}
+	return strings.Join(names, " | ")
+}
+
+// IsDriver 判断是否为内核或文件系统驱动
+func (t ServiceType) IsDriver() bool {
+	return t&(TypeKernelDriver|TypeFileSystemDriver|TypeRecognizerDriver) != 0
+}
+
+// StartType 为服务的 Start 值
+type StartType uint32
+
+const (
+	StartBoot StartType = iota
+	StartSystem
+	StartAutomatic
+	StartManual
+	StartDisabled
+)
+
+func (s StartType) String() string {
+	switch s {
+	case StartBoot:
+		return "Boot"
+	case StartSystem:
+		return "System"
+	case StartAutomatic:
+		return "Automatic"
+	case StartManual:
+		return "Manual"
+	case StartDisabled:
+		return "Disabled"
+	}
+	return fmt.Sprintf("Unknown (%d)", uint32(s))
+}
+
+// ErrorControl 为服务的 ErrorControl 值
+type ErrorControl uint32
+
+const (
+	ErrorIgnore ErrorControl = iota
+	ErrorNormal
+	ErrorSevere
+	ErrorCritical
+)
+
+func (e ErrorControl) String() string {
+	switch e {
+	case ErrorIgnore:
+		return "Ignore"
+	case ErrorNormal:
+		return "Normal"
+	case ErrorSevere:
+		return "Severe"
+	case ErrorCritical:
+		return "Critical"
+	}
+	return fmt.Sprintf("Unknown (%d)", uint32(e))
+}
+
+// ActionType 为服务失败时执行的操作
+type ActionType uint32
+
+const (
+	ActionNone ActionType = iota
+	ActionRestart
+	ActionReboot
+	ActionRunCommand
+)
+
+func (a ActionType) String() string {
+	switch a {
+	case ActionNone:
+		return "None"
+	case ActionRestart:
+		return "Restart"
+	case ActionReboot:
+		return "Reboot"
+	case ActionRunCommand:
+		return "Run Command"
+	}
+	return fmt.Sprintf("Unknown (%d)", uint32(a))
+}
+
+// FailureAction 为 FailureActions 中的一个操作
+type FailureAction struct {
+	Type  ActionType
+	Delay time.Duration
+}
+
+// FailureActions 为 FailureActions 值中序列化的 SERVICE_FAILURE_ACTIONS
+type FailureActions struct {
+	// ResetPeriod 为失败计数清零的时间,INFINITE 时为 -1
+	ResetPeriod time.Duration
+	Actions     []FailureAction
+}
+
+// ParseFailureActions 解析 FailureActions 值:20 字节的头部(重置时间、两个字符串指针、操作数、操作指针),
+// 之后为每个操作 8 字节的类型与延迟(毫秒)
+func ParseFailureActions(data []byte) (*FailureActions, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("%w: FailureActions 长度为 %d", registry.ErrCorrupt, len(data))
+	}
+	result := &FailureActions{}
+	reset := binary.LittleEndian.Uint32(data[0:])
+	if reset == 0xFFFFFFFF {
+		result.ResetPeriod = -1
+	} else {
+		result.ResetPeriod = time.Duration(reset) * time.Second
+	}
+	count := int(binary.LittleEndian.Uint32(data[12:]))
+	if 20+count*8 > len(data) {
+		return nil, fmt.Errorf("%w: FailureActions 中有 %d 个操作,但只有 %d 字节", registry.ErrCorrupt, count, len(data))
+	}
+	for i := 0; i < count; i++ {
+		off := 20 + i*8
+		result.Actions = append(result.Actions, FailureAction{
+			Type:  ActionType(binary.LittleEndian.Uint32(data[off:])),
+			Delay: time.Duration(binary.LittleEndian.Uint32(data[off+4:])) * time.Millisecond,
+		})
+	}
+	return result, nil
+}
+
+// Service 为 Services 下的一个服务或驱动
+type Service struct {
+	ControlSet       string       `reg:"-"`
+	Name             string       `reg:",keyname"`
+	KeyLastWrite     time.Time    `reg:",timestamp"`
+	DisplayName      string       `reg:"DisplayName,optional"`
+	Description      string       `reg:"Description,optional"`
+	Type             ServiceType  `reg:"Type,optional"`
+	Start            StartType    `reg:"Start,optional"`
+	ErrorControl     ErrorControl `reg:"ErrorControl,optional"`
+	DelayedAutoStart bool         `reg:"DelayedAutostart,optional"`
+	ImagePath        string       `reg:"ImagePath,optional"`
+	ObjectName       string       `reg:"ObjectName,optional"`
+	Group            string       `reg:"Group,optional"`
+	Tag              uint32       `reg:"Tag,optional"`
+	DependOnService  []string     `reg:"DependOnService,optional"`
+	DependOnGroup    []string     `reg:"DependOnGroup,optional"`
+	// RequiredPrivileges 为服务进程需要的特权,如 SeImpersonatePrivilege
+	RequiredPrivileges []string        `reg:"RequiredPrivileges,optional"`
+	FailureCommand     string          `reg:"FailureCommand,optional"`
+	RawFailureActions  []byte          `reg:"FailureActions,optional"`
+	FailureActions     *FailureActions `reg:"-"`
+	// Parameters 子键中的 ServiceDll 与该子键的最后写入时间
+	Parameters *Parameters `reg:"Parameters,optional"`
+}
+
+// Parameters 为服务的 Parameters 子键
+type Parameters struct {
+	ServiceDll   string    `reg:"ServiceDll,optional"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+}
+
+// ServiceDll 返回 Parameters\ServiceDll,不存在时返回空字符串
+func (s *Service) ServiceDll() string {
+	if s.Parameters == nil {
+		return ""
+	}
+	return s.Parameters.ServiceDll
+}
+
+// Parse 解析 SYSTEM hive 中所有 ControlSet 下的服务
+func Parse(reg *registry.Registry) ([]*Service, error) {
+	sets := reg.ControlSets()
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%w: ControlSet", registry.ErrNotFound)
+	}
+	result := make([]*Service, 0)
+	var errs []error
+	for _, cs := range sets {
+		services, err := ParseControlSet(cs)
+		result = append(result, services...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// ParseControlSet 解析一个 ControlSet00N 键下的服务,单个值类型不符时其余字段仍会被填充
+func ParseControlSet(cs *registry.RegistryKey) ([]*Service, error) {
+	key := cs.SubKey("Services")
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s\\Services", registry.ErrNotFound, cs.Path())
+	}
+	result := make([]*Service, 0)
+	var errs []error
+	for _, sub := range key.Subkeys() {
+		svc := &Service{ControlSet: cs.Name()}
+		if err := sub.Unmarshal(svc); err != nil {
+			errs = append(errs, err)
+		}
+		if svc.RawFailureActions != nil {
+			actions, err := ParseFailureActions(svc.RawFailureActions)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sub.Path(), err))
+			}
+			svc.FailureActions = actions
+		}
+		result = append(result, svc)
+	}
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,126 @@
+// Package shellbags 解析 NTUSER.DAT 与 UsrClass.dat 中的 ShellBags(BagMRU),
+// 还原用户访问过的文件夹路径及相关时间
+package shellbags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// Locations 为 ShellBags 在 UsrClass.dat 和 NTUSER.DAT 中的位置
+var Locations = []string{
+	"Local Settings\\Software\\Microsoft\\Windows\\Shell\\BagMRU",
+	"Local Settings\\Software\\Microsoft\\Windows\\ShellNoRoam\\BagMRU",
+	"Software\\Microsoft\\Windows\\Shell\\BagMRU",
+	"Software\\Microsoft\\Windows\\ShellNoRoam\\BagMRU",
+	"Wow6432Node\\Local Settings\\Software\\Microsoft\\Windows\\Shell\\BagMRU",
+}
+
+// maxDepth 防止损坏的注册表形成过深的递归
+const maxDepth = 64
+
+// ShellBag 为 BagMRU 树中的一项
+type ShellBag struct {
+	// Path 为由根到当前项的 Shell Item 名称拼接而成的完整路径
+	Path string
+	// KeyPath 为对应的 BagMRU 子键路径,Value 为其在父键中的值名
+	KeyPath string
+	Value   string
+	// NodeSlot 指向 Bags\<NodeSlot> 中保存的视图设置,不存在时为 -1
+	NodeSlot int
+	// MRUPosition 为该项在父键 MRUListEx 中的位置,0 表示父键中最近访问的项
+	MRUPosition int
+	// ParentLastWrite 为父键的最后写入时间,通常对应 MRUPosition 为 0 的项最近一次被访问
+	ParentLastWrite time.Time
+	// LastWrite 为该项对应子键的最后写入时间
+	LastWrite time.Time
+	Item      *ShellItem
+}
+
+// Parse 在 hive 中查找所有已知位置并解析其中的 ShellBags
+func Parse(reg *registry.Registry) ([]*ShellBag, error) {
+	result := make([]*ShellBag, 0)
+	found := false
+	for _, location := range Locations {
+		key := reg.Open(location)
+		if key == nil {
+			continue
+		}
+		found = true
+		result = append(result, ParseKey(key)...)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: BagMRU", registry.ErrNotFound)
+	}
+	return result, nil
+}
+
+// ParseKey 从指定的 BagMRU 键开始递归解析 ShellBags
+func ParseKey(key *registry.RegistryKey) []*ShellBag {
+	result := make([]*ShellBag, 0)
+	walk(key, "", 0, &result)
+	return result
+}
+
+func walk(key *registry.RegistryKey, parentPath string, depth int, result *[]*ShellBag) {
+	if depth > maxDepth {
+		return
+	}
+	positions := make(map[string]int)
+	if b, err := key.GetBinaryValue("MRUListEx"); err == nil {
+		for i, n := range utils.ParseMRUListEx(b) {
+			positions[strconv.Itoa(int(n))] = i
+		}
+	}
+	for _, value := range key.Values() {
+		name := value.Name()
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+		data, err := value.AsBinary()
+		if err != nil {
+			continue
+		}
+		items := ParseItemIDList(data)
+		if len(items) == 0 {
+			continue
+		}
+		item := items[0]
+		bag := &ShellBag{
+			Path:            joinPath(parentPath, item.Name),
+			KeyPath:         key.Path() + "\\" + name,
+			Value:           name,
+			NodeSlot:        -1,
+			MRUPosition:     -1,
+			ParentLastWrite: key.Timestamp(),
+			Item:            item,
+		}
+		if pos, ok := positions[name]; ok {
+			bag.MRUPosition = pos
+		}
+		sub := key.SubKey(name)
+		if sub != nil {
+			bag.LastWrite = sub.Timestamp()
+			if slot, err := sub.GetInt32Value("NodeSlot"); err == nil {
+				bag.NodeSlot = int(slot)
+			}
+		}
+		*result = append(*result, bag)
+		if sub != nil {
+			walk(sub, bag.Path, depth+1, result)
+		}
+	}
+}
+
+// joinPath 用反斜杠拼接路径,避免盘符 "C:\" 之后出现重复的分隔符
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return strings.TrimRight(parent, "\\") + "\\" + name
+}
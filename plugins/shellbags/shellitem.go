@@ -0,0 +1,308 @@
+package shellbags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// ItemType 为 Shell Item 的类别
+type ItemType string
+
+const (
+	ItemRootFolder   ItemType = "Root Folder"
+	ItemVolume       ItemType = "Volume"
+	ItemFileEntry    ItemType = "File Entry"
+	ItemNetwork      ItemType = "Network Location"
+	ItemZipFolder    ItemType = "Compressed Folder"
+	ItemControlPanel ItemType = "Control Panel"
+	ItemUsersFiles   ItemType = "Users Files Folder"
+	ItemUnknown      ItemType = "Unknown"
+)
+
+// ShellItem 为 ItemIDList 中解析出的一个 Shell Item
+type ShellItem struct {
+	Type      ItemType
+	ClassType uint8
+	// Name 为用于拼接路径的名称,文件项优先使用扩展块中的长文件名
+	Name      string
+	ShortName string
+	GUID      string
+	// 以下字段只对文件项有意义,时间来自 FAT 格式的 DOS 时间(精度 2 秒,本地时间按 UTC 处理)
+	Size        uint32
+	Attributes  uint16
+	IsDirectory bool
+	Modified    time.Time
+	Created     time.Time
+	Accessed    time.Time
+	// MFTEntry / MFTSequence 来自 0xBEEF0004 扩展块中的 NTFS 文件引用
+	MFTEntry    uint64
+	MFTSequence uint16
+	Raw         []byte
+}
+
+// ParseItemIDList 解析 ItemIDList(PIDL),依次返回其中的 Shell Item
+func ParseItemIDList(data []byte) []*ShellItem {
+	result := make([]*ShellItem, 0)
+	pos := 0
+	for pos+2 <= len(data) {
+		size := int(binary.LittleEndian.Uint16(data[pos:]))
+		if size == 0 {
+			break
+		}
+		if size < 3 || pos+size > len(data) {
+			break
+		}
+		result = append(result, ParseShellItem(data[pos:pos+size]))
+		pos += size
+	}
+	return result
+}
+
+// ParseShellItem 解析单个 Shell Item,data 包含开头 2 字节的长度字段
+func ParseShellItem(data []byte) *ShellItem {
+	item := &ShellItem{Type: ItemUnknown, Raw: data}
+	if len(data) < 3 {
+		return item
+	}
+	item.ClassType = data[2]
+	switch {
+	case item.ClassType == 0x1F:
+		item.parseRootFolder()
+	case item.ClassType&0x70 == 0x20:
+		item.parseVolume()
+	case item.ClassType&0x70 == 0x30:
+		item.parseFileEntry()
+	case item.ClassType&0x70 == 0x40:
+		item.parseNetwork()
+	case item.ClassType == 0x52:
+		item.parseZipFolder()
+	case item.ClassType == 0x71:
+		item.parseControlPanel()
+	case item.ClassType == 0x01:
+		item.parseControlPanelCategory()
+	case item.ClassType == 0x74:
+		item.Type = ItemUsersFiles
+		item.parseExtensionBlock(4)
+	default:
+		// 未知类型的项如果带有扩展块,仍然可以取出长文件名
+		item.parseExtensionBlock(3)
+	}
+	if item.Name == "" {
+		item.Name = fmt.Sprintf("[Unknown 0x%02X]", item.ClassType)
+	}
+	return item
+}
+
+// guidAt 读取 offset 处的 GUID,格式为 {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}
+func guidAt(data []byte, offset int) string {
+	if offset+16 > len(data) {
+		return ""
+	}
+	return "{" + strings.ToUpper(registry.ReadGuid(data[offset:offset+16]).String()) + "}"
+}
+
+func guidName(guid string) string {
+	if name, ok := utils.KnownFolderName(guid); ok {
+		return name
+	}
+	return guid
+}
+
+func (s *ShellItem) parseRootFolder() {
+	s.Type = ItemRootFolder
+	s.GUID = guidAt(s.Raw, 4)
+	s.Name = guidName(s.GUID)
+}
+
+func (s *ShellItem) parseVolume() {
+	s.Type = ItemVolume
+	name := cString(s.Raw, 3)
+	if len(name) >= 2 && name[1] == ':' {
+		s.Name = name
+		return
+	}
+	// 某些卷项(如 Windows 10 中的库文件夹)保存的是 GUID
+	if s.GUID = guidAt(s.Raw, 4); s.GUID != "" {
+		s.Name = guidName(s.GUID)
+	}
+}
+
+func (s *ShellItem) parseFileEntry() {
+	s.Type = ItemFileEntry
+	data := s.Raw
+	if len(data) < 14 {
+		return
+	}
+	s.IsDirectory = s.ClassType&0x01 != 0
+	s.Size = binary.LittleEndian.Uint32(data[4:])
+	s.Modified = dosDateTime(binary.LittleEndian.Uint16(data[8:]), binary.LittleEndian.Uint16(data[10:]))
+	s.Attributes = binary.LittleEndian.Uint16(data[12:])
+	s.IsDirectory = s.IsDirectory || s.Attributes&0x10 != 0
+	var end int
+	if s.ClassType&0x04 != 0 {
+		s.ShortName, end = utf16String(data, 14)
+	} else {
+		s.ShortName = cString(data, 14)
+		end = 14 + len(s.ShortName) + 1
+	}
+	s.Name = s.ShortName
+	s.parseExtensionBlock(end)
+}
+
+// parseExtensionBlock 从 start 开始查找 0xBEEF0004 扩展块,读取创建/访问时间、MFT 引用和长文件名
+func (s *ShellItem) parseExtensionBlock(start int) {
+	data := s.Raw
+	if start < 0 || start > len(data) {
+		return
+	}
+	sig := bytes.Index(data[start:], []byte{0x04, 0x00, 0xEF, 0xBE})
+	if sig < 4 {
+		return
+	}
+	b := start + sig - 4
+	size := int(binary.LittleEndian.Uint16(data[b:]))
+	version := binary.LittleEndian.Uint16(data[b+2:])
+	end := min(b+size, len(data))
+	if b+18 > end {
+		return
+	}
+	s.Created = dosDateTime(binary.LittleEndian.Uint16(data[b+8:]), binary.LittleEndian.Uint16(data[b+10:]))
+	s.Accessed = dosDateTime(binary.LittleEndian.Uint16(data[b+12:]), binary.LittleEndian.Uint16(data[b+14:]))
+	off := b + 18
+	if version >= 7 {
+		if off+2+16 > end {
+			return
+		}
+		ref := binary.LittleEndian.Uint64(data[off+2:])
+		s.MFTEntry = ref & 0xFFFFFFFFFFFF
+		s.MFTSequence = uint16(ref >> 48)
+		off += 2 + 16
+	}
+	if version >= 3 {
+		off += 2
+	}
+	if version >= 9 {
+		off += 4
+	}
+	if version >= 8 {
+		off += 4
+	}
+	if version >= 3 && off < end {
+		if name, _ := utf16String(data[:end], off); name != "" {
+			s.Name = name
+		}
+	}
+}
+
+func (s *ShellItem) parseNetwork() {
+	s.Type = ItemNetwork
+	s.Name = cString(s.Raw, 5)
+}
+
+// parseZipFolder 解析压缩文件夹中的项,0x24 处为访问时间字符串,0x54 之后为 UTF-16 名称
+func (s *ShellItem) parseZipFolder() {
+	s.Type = ItemZipFolder
+	data := s.Raw
+	if len(data) < 0x5C {
+		return
+	}
+	if t, _ := utf16String(data[:0x24+40], 0x24); t != "" && t != "N/A" {
+		if parsed, err := time.Parse("01/02/2006  15:04:05", t); err == nil {
+			s.Accessed = parsed
+		} else if parsed, err := time.Parse("1/2/2006  15:04:05", t); err == nil {
+			s.Accessed = parsed
+		}
+	}
+	size1 := int(binary.LittleEndian.Uint32(data[0x54:])) * 2
+	size2 := int(binary.LittleEndian.Uint32(data[0x58:])) * 2
+	if 0x5C+size1+size2 > len(data) {
+		return
+	}
+	name := strings.TrimRight(utils.DecodeUTF16(data[0x5C:0x5C+size1]), "\x00")
+	if size2 > 0 {
+		name += "\\" + strings.TrimRight(utils.DecodeUTF16(data[0x5C+size1:0x5C+size1+size2]), "\x00")
+	}
+	s.Name = name
+}
+
+func (s *ShellItem) parseControlPanel() {
+	s.Type = ItemControlPanel
+	s.GUID = guidAt(s.Raw, 14)
+	if s.GUID != "" {
+		s.Name = guidName(s.GUID)
+	}
+}
+
+var controlPanelCategories = map[uint32]string{
+	0:  "All Control Panel Items",
+	1:  "Appearance and Personalization",
+	2:  "Hardware and Sound",
+	3:  "Network and Internet",
+	4:  "Sounds, Speech, and Audio Devices",
+	5:  "System and Security",
+	6:  "Clock, Language, and Region",
+	7:  "Ease of Access",
+	8:  "Programs",
+	9:  "User Accounts",
+	10: "Security Center",
+	11: "Mobile PC",
+}
+
+func (s *ShellItem) parseControlPanelCategory() {
+	if len(s.Raw) < 12 || binary.LittleEndian.Uint32(s.Raw[4:]) != 0x39DE2184 {
+		return
+	}
+	s.Type = ItemControlPanel
+	id := binary.LittleEndian.Uint32(s.Raw[8:])
+	if name, ok := controlPanelCategories[id]; ok {
+		s.Name = name
+	} else {
+		s.Name = fmt.Sprintf("Control Panel Category %d", id)
+	}
+}
+
+// dosDateTime 把 FAT 格式的日期和时间转换为 time.Time
+func dosDateTime(date, tm uint16) time.Time {
+	if date == 0 && tm == 0 {
+		return time.Time{}
+	}
+	month := int(date >> 5 & 0xF)
+	day := int(date & 0x1F)
+	if month < 1 || month > 12 || day < 1 {
+		return time.Time{}
+	}
+	return time.Date(1980+int(date>>9), time.Month(month), day, int(tm>>11), int(tm>>5&0x3F), int(tm&0x1F)*2, 0, time.UTC)
+}
+
+// cString 读取 offset 处以 \0 结尾的单字节字符串
+func cString(data []byte, offset int) string {
+	if offset >= len(data) {
+		return ""
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end == -1 {
+		end = len(data) - offset
+	}
+	return utils.DecodeWindows1252(data[offset : offset+end])
+}
+
+// utf16String 读取 offset 处以 \0\0 结尾的 UTF-16LE 字符串,并返回结尾之后的偏移
+func utf16String(data []byte, offset int) (string, int) {
+	end := offset
+	for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+		end += 2
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	if offset >= end {
+		return "", end + 2
+	}
+	return utils.DecodeUTF16(data[offset:end]), end + 2
+}
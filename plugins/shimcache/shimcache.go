@@ -0,0 +1,405 @@
+// Package shimcache 解析 SYSTEM hive 中的 AppCompatCache(ShimCache),
+// 支持 Windows XP 到 Windows 11 的各种格式
+package shimcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// 相对于 ControlSet 的路径,XP 使用 AppCompatibility 键
+var locations = []string{
+	"Control\\Session Manager\\AppCompatCache",
+	"Control\\Session Manager\\AppCompatibility",
+}
+
+const valueName = "AppCompatCache"
+
+// Format 为 AppCompatCache 数据的格式
+type Format string
+
+const (
+	FormatWinXP         Format = "Windows XP"
+	FormatWin2003       Format = "Windows 2003"
+	FormatVista         Format = "Windows Vista/2008"
+	FormatWin7          Format = "Windows 7/2008 R2"
+	FormatWin8          Format = "Windows 8/2012"
+	FormatWin81         Format = "Windows 8.1/2012 R2"
+	FormatWin10         Format = "Windows 10"
+	FormatWin10Creators Format = "Windows 10 Creators/Windows 11"
+)
+
+const (
+	magicXP             = 0xDEADBEEF
+	magicNT52           = 0xBADC0FFE // Windows 2003 / Vista
+	magicNT61           = 0xBADC0FEE // Windows 7
+	win8Header          = 0x80
+	win10Header         = 0x30
+	win10CreatorsHeader = 0x34
+
+	xpHeaderSize   = 0x190
+	xpEntrySize    = 0x228
+	win7HeaderSize = 0x80
+
+	// insertFlagExecuted 为 Vista/7/8 中 CSRSS 插入标志,表示程序很可能执行过
+	insertFlagExecuted = 0x2
+)
+
+var (
+	win8EntryMagic  = []byte("00ts")
+	win81EntryMagic = []byte("10ts")
+)
+
+// ErrUnknownFormat 无法识别 AppCompatCache 数据的格式
+var ErrUnknownFormat = errors.New("无法识别的 AppCompatCache 格式")
+
+// Entry 为 ShimCache 中的一条记录
+type Entry struct {
+	// Position 为记录在缓存中的位置,0 为最近插入的记录
+	Position     int
+	Path         string
+	LastModified time.Time
+	// LastUpdate 与 FileSize 只在 XP/2003 格式中存在
+	LastUpdate time.Time
+	FileSize   uint64
+	// InsertFlags 与 ShimFlags 只在 Vista 到 8.1 格式中存在
+	InsertFlags uint32
+	ShimFlags   uint32
+	// Executed 为插入标志,只在 Vista 到 8.1 格式中有意义
+	Executed bool
+	// Package 为 Windows 8.1 中的应用包名
+	Package string
+	Data    []byte
+}
+
+// Cache 为一个 ControlSet 中解析出的 ShimCache
+type Cache struct {
+	ControlSet   string
+	Format       Format
+	KeyLastWrite time.Time
+	Entries      []*Entry
+}
+
+// Parse 解析 SYSTEM hive 中所有 ControlSet 下的 ShimCache
+func Parse(reg *registry.Registry) ([]*Cache, error) {
+	result := make([]*Cache, 0)
+	var errs []error
+	for _, cs := range reg.ControlSets() {
+		for _, location := range locations {
+			key := cs.FindKey(location)
+			if key == nil {
+				continue
+			}
+			data, err := key.GetBinaryValue(valueName)
+			if err != nil {
+				if !errors.Is(err, registry.ErrNotFound) {
+					errs = append(errs, fmt.Errorf("%s: %w", key.Path(), err))
+				}
+				continue
+			}
+			format, entries, err := ParseData(data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key.Path(), err))
+				continue
+			}
+			result = append(result, &Cache{
+				ControlSet:   cs.Name(),
+				Format:       format,
+				KeyLastWrite: key.Timestamp(),
+				Entries:      entries,
+			})
+		}
+	}
+	if len(result) == 0 && len(errs) == 0 {
+		return nil, fmt.Errorf("%w: %s", registry.ErrNotFound, valueName)
+	}
+	return result, errors.Join(errs...)
+}
+
+// ParseData 根据头部签名识别格式并解析 AppCompatCache 值的数据
+func ParseData(data []byte) (Format, []*Entry, error) {
+	if len(data) < 4 {
+		return "", nil, ErrUnknownFormat
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	switch {
+	case magic == magicXP:
+		entries, err := parseXP(data)
+		return FormatWinXP, entries, err
+	case magic == magicNT52:
+		return parseNT52(data)
+	case magic == magicNT61:
+		entries, err := parseWin7(data)
+		return FormatWin7, entries, err
+	case magic == win8Header && len(data) >= win8Header+4:
+		sig := data[win8Header : win8Header+4]
+		if bytes.Equal(sig, win8EntryMagic) {
+			entries, err := parseWin8(data, false)
+			return FormatWin8, entries, err
+		}
+		if bytes.Equal(sig, win81EntryMagic) {
+			entries, err := parseWin8(data, true)
+			return FormatWin81, entries, err
+		}
+	case (magic == win10Header || magic == win10CreatorsHeader) && len(data) >= int(magic)+4:
+		if bytes.Equal(data[magic:magic+4], win81EntryMagic) {
+			format := FormatWin10
+			if magic == win10CreatorsHeader {
+				format = FormatWin10Creators
+			}
+			entries, err := parseWin10(data, int(magic))
+			return format, entries, err
+		}
+	}
+	return "", nil, fmt.Errorf("%w: 0x%08X", ErrUnknownFormat, magic)
+}
+
+// reader 按小端字节序读取数据,越界时记录错误并返回零值
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(off, n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if off < 0 || n < 0 || off+n > len(r.data) {
+		r.err = fmt.Errorf("数据越界: offset=%d length=%d size=%d", off, n, len(r.data))
+		return nil
+	}
+	return r.data[off : off+n]
+}
+func (r *reader) u16(off int) uint16 {
+	if b := r.bytes(off, 2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+func (r *reader) u32(off int) uint32 {
+	if b := r.bytes(off, 4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+func (r *reader) u64(off int) uint64 {
+	if b := r.bytes(off, 8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+func (r *reader) filetime(off int) time.Time {
+	if v := r.u64(off); v != 0 {
+		return registry.ParseWindowsTimestamp(int64(v))
+	}
+	return time.Time{}
+}
+func (r *reader) utf16(off, n int) string {
+	if b := r.bytes(off, n); b != nil {
+		s := utils.DecodeUTF16(b[:len(b)&^1])
+		if i := strings.IndexByte(s, 0); i != -1 {
+			s = s[:i]
+		}
+		return s
+	}
+	return ""
+}
+
+// capacity 返回 data 中 header 之后最多能容纳的 size 字节记录数与 count 中较小的一个,
+// 头部记录的数量不可信,不能直接作为容量分配内存
+func capacity(count int, data []byte, header, size int) int {
+	return min(count, max(len(data)-header, 0)/size)
+}
+
+// parseXP 解析 Windows XP 格式,每条记录为固定 0x228 字节
+func parseXP(data []byte) ([]*Entry, error) {
+	r := &reader{data: data}
+	count := int(r.u32(0x8))
+	result := make([]*Entry, 0, capacity(count, data, xpHeaderSize, xpEntrySize))
+	for i := 0; i < count; i++ {
+		off := xpHeaderSize + i*xpEntrySize
+		entry := &Entry{
+			Position:     i,
+			Path:         r.utf16(off, 0x208),
+			LastModified: r.filetime(off + 0x210),
+			FileSize:     r.u64(off + 0x218),
+			LastUpdate:   r.filetime(off + 0x220),
+		}
+		if r.err != nil {
+			return result, r.err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// is64bit 根据第一条记录判断 2003/Vista/7 的数据是否为 64 位布局,
+// 64 位布局中路径偏移之前有 4 字节的对齐填充
+func is64bit(r *reader, first int) bool {
+	return r.u32(first+4) == 0 && r.u32(first+8) != 0
+}
+
+// parseNT52 解析 Windows 2003 与 Vista 格式。两者签名相同,
+// 2003 在时间之后保存 8 字节文件大小,Vista 保存插入标志与 Shim 标志
+func parseNT52(data []byte) (Format, []*Entry, error) {
+	r := &reader{data: data}
+	count := int(r.u32(4))
+	x64 := is64bit(r, 8)
+	size := 24
+	if x64 {
+		size = 32
+	}
+	// 2003 的文件大小高 32 位通常为 0 且低 32 位较大,Vista 的标志位都较小
+	format := FormatVista
+	if count > 0 {
+		tail := 16
+		if x64 {
+			tail = 24
+		}
+		if r.u32(8+tail+4) == 0 && r.u32(8+tail) > 0xFFFF {
+			format = FormatWin2003
+		}
+	}
+	result := make([]*Entry, 0, capacity(count, data, 8, size))
+	for i := 0; i < count; i++ {
+		off := 8 + i*size
+		length := int(r.u16(off))
+		var pathOffset, rest int
+		if x64 {
+			pathOffset, rest = int(r.u64(off+8)), off+16
+		} else {
+			pathOffset, rest = int(r.u32(off+4)), off+8
+		}
+		entry := &Entry{
+			Position:     i,
+			Path:         r.utf16(pathOffset, length),
+			LastModified: r.filetime(rest),
+		}
+		if format == FormatWin2003 {
+			entry.FileSize = r.u64(rest + 8)
+		} else {
+			entry.InsertFlags = r.u32(rest + 8)
+			entry.ShimFlags = r.u32(rest + 12)
+			entry.Executed = entry.InsertFlags&insertFlagExecuted != 0
+		}
+		if r.err != nil {
+			return format, result, r.err
+		}
+		result = append(result, entry)
+	}
+	return format, result, nil
+}
+
+// parseWin7 解析 Windows 7 / 2008 R2 格式,头部为 0x80 字节
+func parseWin7(data []byte) ([]*Entry, error) {
+	r := &reader{data: data}
+	count := int(r.u32(4))
+	x64 := is64bit(r, win7HeaderSize)
+	size := 32
+	if x64 {
+		size = 48
+	}
+	result := make([]*Entry, 0, capacity(count, data, win7HeaderSize, size))
+	for i := 0; i < count; i++ {
+		off := win7HeaderSize + i*size
+		length := int(r.u16(off))
+		entry := &Entry{Position: i}
+		var pathOffset, blobSize, blobOffset int
+		if x64 {
+			pathOffset = int(r.u64(off + 8))
+			entry.LastModified = r.filetime(off + 16)
+			entry.InsertFlags = r.u32(off + 24)
+			entry.ShimFlags = r.u32(off + 28)
+			blobSize = int(r.u64(off + 32))
+			blobOffset = int(r.u64(off + 40))
+		} else {
+			pathOffset = int(r.u32(off + 4))
+			entry.LastModified = r.filetime(off + 8)
+			entry.InsertFlags = r.u32(off + 16)
+			entry.ShimFlags = r.u32(off + 20)
+			blobSize = int(r.u32(off + 24))
+			blobOffset = int(r.u32(off + 28))
+		}
+		entry.Path = r.utf16(pathOffset, length)
+		entry.Executed = entry.InsertFlags&insertFlagExecuted != 0
+		if blobSize > 0 {
+			entry.Data = r.bytes(blobOffset, blobSize)
+		}
+		if r.err != nil {
+			return result, r.err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// parseWin8 解析 Windows 8 / 8.1 格式,记录以 "00ts" / "10ts" 开头且长度可变
+func parseWin8(data []byte, win81 bool) ([]*Entry, error) {
+	r := &reader{data: data}
+	result := make([]*Entry, 0)
+	off := win8Header
+	for off+12 <= len(data) {
+		sig := data[off : off+4]
+		if !bytes.Equal(sig, win8EntryMagic) && !bytes.Equal(sig, win81EntryMagic) {
+			break
+		}
+		entrySize := int(r.u32(off + 8))
+		pos := off + 12
+		entry := &Entry{Position: len(result)}
+		pathLen := int(r.u16(pos))
+		entry.Path = r.utf16(pos+2, pathLen)
+		pos += 2 + pathLen
+		if win81 {
+			packageLen := int(r.u16(pos))
+			entry.Package = r.utf16(pos+2, packageLen)
+			pos += 2 + packageLen
+		}
+		entry.InsertFlags = r.u32(pos)
+		entry.ShimFlags = r.u32(pos + 4)
+		entry.LastModified = r.filetime(pos + 8)
+		blobSize := int(r.u32(pos + 16))
+		if blobSize > 0 {
+			entry.Data = r.bytes(pos+20, blobSize)
+		}
+		entry.Executed = entry.InsertFlags&insertFlagExecuted != 0
+		if r.err != nil {
+			return result, r.err
+		}
+		result = append(result, entry)
+		off += 12 + entrySize
+	}
+	return result, nil
+}
+
+// parseWin10 解析 Windows 10 / 11 格式,头部长度为 0x30 或 0x34,记录中不再包含插入标志
+func parseWin10(data []byte, header int) ([]*Entry, error) {
+	r := &reader{data: data}
+	result := make([]*Entry, 0)
+	off := header
+	for off+12 <= len(data) && bytes.Equal(data[off:off+4], win81EntryMagic) {
+		entrySize := int(r.u32(off + 8))
+		pos := off + 12
+		entry := &Entry{Position: len(result)}
+		pathLen := int(r.u16(pos))
+		entry.Path = r.utf16(pos+2, pathLen)
+		pos += 2 + pathLen
+		entry.LastModified = r.filetime(pos)
+		blobSize := int(r.u32(pos + 8))
+		if blobSize > 0 {
+			entry.Data = r.bytes(pos+12, blobSize)
+		}
+		if r.err != nil {
+			return result, r.err
+		}
+		result = append(result, entry)
+		off += 12 + entrySize
+	}
+	return result, nil
+}
@@ -0,0 +1,227 @@
+package shimcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	testPath     = `C:\Windows\System32\cmd.exe`
+	testPackage  = "Microsoft.App_8wekyb3d8bbwe"
+	testFiletime = 0x01D5E0B1A2B3C4D0
+	testFileSize = 0x5A000
+)
+
+var testBlob = []byte{1, 2, 3, 4, 5}
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+// buffer 为按小端字节序写入测试数据的缓冲区,写入越界时自动扩展
+type buffer []byte
+
+func (b *buffer) grow(off, n int) []byte {
+	if off+n > len(*b) {
+		*b = append(*b, make([]byte, off+n-len(*b))...)
+	}
+	return (*b)[off : off+n]
+}
+func (b *buffer) u16(off int, v uint16)  { binary.LittleEndian.PutUint16(b.grow(off, 2), v) }
+func (b *buffer) u32(off int, v uint32)  { binary.LittleEndian.PutUint32(b.grow(off, 4), v) }
+func (b *buffer) u64(off int, v uint64)  { binary.LittleEndian.PutUint64(b.grow(off, 8), v) }
+func (b *buffer) put(off int, v []byte)  { copy(b.grow(off, len(v)), v) }
+func (b *buffer) str(off int, s string)  { b.put(off, utf16le(s)) }
+func (b *buffer) append(v []byte) int    { off := len(*b); b.put(off, v); return off }
+func (b *buffer) appendStr(s string) int { return b.append(utf16le(s)) }
+func (b *buffer) appendU16(v uint16) int { return b.append(binary.LittleEndian.AppendUint16(nil, v)) }
+func (b *buffer) appendU32(v uint32) int { return b.append(binary.LittleEndian.AppendUint32(nil, v)) }
+func (b *buffer) appendU64(v uint64) int { return b.append(binary.LittleEndian.AppendUint64(nil, v)) }
+
+func buildXP() []byte {
+	var b buffer
+	b.u32(0, magicXP)
+	b.u32(0x8, 1)
+	off := xpHeaderSize
+	b.str(off, testPath)
+	b.u64(off+0x210, testFiletime)
+	b.u64(off+0x218, testFileSize)
+	b.u64(off+0x220, testFiletime)
+	b.grow(off, xpEntrySize)
+	return b
+}
+
+// buildNT52 生成 2003 / Vista 格式,路径保存在记录表之后
+func buildNT52(x64, win2003 bool) []byte {
+	var b buffer
+	b.u32(0, magicNT52)
+	b.u32(4, 1)
+	size, rest := 24, 8+8
+	if x64 {
+		size, rest = 32, 8+16
+	}
+	path := 8 + size
+	b.str(path, testPath)
+	b.u16(8, uint16(2*len(testPath)))
+	b.u16(10, uint16(2*len(testPath)+2))
+	if x64 {
+		b.u64(8+8, uint64(path))
+	} else {
+		b.u32(8+4, uint32(path))
+	}
+	b.u64(rest, testFiletime)
+	if win2003 {
+		b.u64(rest+8, testFileSize)
+	} else {
+		b.u32(rest+8, insertFlagExecuted)
+		b.u32(rest+12, 0)
+	}
+	return b
+}
+
+func buildWin7(x64 bool) []byte {
+	var b buffer
+	b.u32(0, magicNT61)
+	b.u32(4, 1)
+	off, size := win7HeaderSize, 32
+	if x64 {
+		size = 48
+	}
+	b.grow(off, size)
+	path := b.appendStr(testPath)
+	blob := b.append(testBlob)
+	b.u16(off, uint16(2*len(testPath)))
+	b.u16(off+2, uint16(2*len(testPath)+2))
+	if x64 {
+		b.u64(off+8, uint64(path))
+		b.u64(off+16, testFiletime)
+		b.u32(off+24, insertFlagExecuted)
+		b.u64(off+32, uint64(len(testBlob)))
+		b.u64(off+40, uint64(blob))
+	} else {
+		b.u32(off+4, uint32(path))
+		b.u64(off+8, testFiletime)
+		b.u32(off+16, insertFlagExecuted)
+		b.u32(off+24, uint32(len(testBlob)))
+		b.u32(off+28, uint32(blob))
+	}
+	return b
+}
+
+// buildWin8 生成 Windows 8 / 8.1 / 10 格式,header 为头部长度,记录以 sig 开头
+func buildWin8(header int, sig []byte, win81, win10 bool) []byte {
+	var b buffer
+	b.u32(0, uint32(header))
+	b.grow(0, header)
+	var entry buffer
+	entry.appendU16(uint16(2 * len(testPath)))
+	entry.appendStr(testPath)
+	if win81 {
+		entry.appendU16(uint16(2 * len(testPackage)))
+		entry.appendStr(testPackage)
+	}
+	if !win10 {
+		entry.appendU32(insertFlagExecuted)
+		entry.appendU32(0)
+	}
+	entry.appendU64(testFiletime)
+	entry.appendU32(uint32(len(testBlob)))
+	entry.append(testBlob)
+	b.append(sig)
+	b.appendU32(0)
+	b.appendU32(uint32(len(entry)))
+	b.append(entry)
+	return b
+}
+
+func TestParseData(t *testing.T) {
+	modified := registry.ParseWindowsTimestamp(testFiletime)
+	tests := []struct {
+		name   string
+		data   []byte
+		format Format
+		want   Entry
+	}{
+		{"xp", buildXP(), FormatWinXP, Entry{LastUpdate: modified, FileSize: testFileSize}},
+		{"2003", buildNT52(false, true), FormatWin2003, Entry{FileSize: testFileSize}},
+		{"2003 x64", buildNT52(true, true), FormatWin2003, Entry{FileSize: testFileSize}},
+		{"vista", buildNT52(false, false), FormatVista, Entry{InsertFlags: insertFlagExecuted, Executed: true}},
+		{"vista x64", buildNT52(true, false), FormatVista, Entry{InsertFlags: insertFlagExecuted, Executed: true}},
+		{"win7", buildWin7(false), FormatWin7, Entry{InsertFlags: insertFlagExecuted, Executed: true, Data: testBlob}},
+		{"win7 x64", buildWin7(true), FormatWin7, Entry{InsertFlags: insertFlagExecuted, Executed: true, Data: testBlob}},
+		{"win8", buildWin8(win8Header, win8EntryMagic, false, false), FormatWin8,
+			Entry{InsertFlags: insertFlagExecuted, Executed: true, Data: testBlob}},
+		{"win8.1", buildWin8(win8Header, win81EntryMagic, true, false), FormatWin81,
+			Entry{InsertFlags: insertFlagExecuted, Executed: true, Package: testPackage, Data: testBlob}},
+		{"win10", buildWin8(win10Header, win81EntryMagic, false, true), FormatWin10, Entry{Data: testBlob}},
+		{"win10 creators", buildWin8(win10CreatorsHeader, win81EntryMagic, false, true), FormatWin10Creators, Entry{Data: testBlob}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, entries, err := ParseData(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format {
+				t.Fatalf("格式为 %q,应为 %q", format, tt.format)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("解析出 %d 条记录,应为 1 条", len(entries))
+			}
+			got, want := entries[0], tt.want
+			if got.Path != testPath || !got.LastModified.Equal(modified) {
+				t.Fatalf("path=%q modified=%v", got.Path, got.LastModified)
+			}
+			if !got.LastUpdate.Equal(want.LastUpdate) || got.FileSize != want.FileSize ||
+				got.InsertFlags != want.InsertFlags || got.Executed != want.Executed ||
+				got.Package != want.Package || !bytes.Equal(got.Data, want.Data) {
+				t.Fatalf("记录为 %+v,应为 %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseDataBogusCount(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		off  int
+	}{
+		{"xp", buildXP(), 0x8},
+		{"2003", buildNT52(false, true), 4},
+		{"vista", buildNT52(false, false), 4},
+		{"win7", buildWin7(false), 4},
+		{"win7 x64", buildWin7(true), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 头部记录的数量远超数据中的记录,不能按它分配内存,解析完已有的记录后报告越界
+			binary.LittleEndian.PutUint32(tt.data[tt.off:], 0xFFFFFFFF)
+			_, entries, err := ParseData(tt.data)
+			if err == nil {
+				t.Fatal("应报告数据越界")
+			}
+			if len(entries) == 0 || entries[0].Path != testPath {
+				t.Fatalf("应保留越界前解析出的记录: %v", entries)
+			}
+		})
+	}
+}
+
+func TestParseDataUnknown(t *testing.T) {
+	for _, data := range [][]byte{nil, {1, 2, 3, 4}, binary.LittleEndian.AppendUint32(nil, win8Header)} {
+		if _, _, err := ParseData(data); !errors.Is(err, ErrUnknownFormat) {
+			t.Fatalf("%x: %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package software 从 SOFTWARE 与 NTUSER.DAT 中的 Uninstall、Installer\Products 键
+// 列出已安装的程序,并合并不同位置中重复的记录
+package software
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// Location 为一个已安装程序列表的位置
+type Location struct {
+	Name string
+	Path string
+	// Installer 表示该位置为 Windows Installer 的 Products 键,子键名为压缩格式的 GUID
+	Installer bool
+}
+
+// Locations 为 Parse 会查找的位置,SOFTWARE 与 NTUSER.DAT 中只会存在其中一部分
+var Locations = []Location{
+	{Name: "Uninstall", Path: "Microsoft\\Windows\\CurrentVersion\\Uninstall"},
+	{Name: "Uninstall (Wow6432Node)", Path: "Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall"},
+	{Name: "Installer\\Products", Path: "Classes\\Installer\\Products", Installer: true},
+	{Name: "User Uninstall", Path: "Software\\Microsoft\\Windows\\CurrentVersion\\Uninstall"},
+	{Name: "User Uninstall (Wow6432Node)", Path: "Software\\Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall"},
+	{Name: "User Installer\\Products", Path: "Software\\Microsoft\\Installer\\Products", Installer: true},
+}
+
+// Source 为程序记录所在的一个键
+type Source struct {
+	Location     string
+	KeyPath      string
+	KeyLastWrite time.Time
+}
+
+// Program 为一个已安装的程序,同一程序在多个位置出现时合并为一条记录
+type Program struct {
+	Name      string
+	Version   string
+	Publisher string
+	// ProductCode 为 Windows Installer 的产品 GUID,非 MSI 安装的程序为空
+	ProductCode          string
+	InstallDate          time.Time
+	InstallLocation      string
+	InstallSource        string
+	UninstallString      string
+	QuietUninstallString string
+	// EstimatedSize 单位为 KB
+	EstimatedSize   uint32
+	SystemComponent bool
+	// KeyLastWrite 为所有来源中最晚的键写入时间
+	KeyLastWrite time.Time
+	Sources      []Source
+}
+
+// uninstallKey 为 Uninstall 子键中的值
+type uninstallKey struct {
+	DisplayName          string `reg:"DisplayName,optional"`
+	DisplayVersion       string `reg:"DisplayVersion,optional"`
+	Publisher            string `reg:"Publisher,optional"`
+	InstallDate          string `reg:"InstallDate,optional"`
+	InstallLocation      string `reg:"InstallLocation,optional"`
+	InstallSource        string `reg:"InstallSource,optional"`
+	UninstallString      string `reg:"UninstallString,optional"`
+	QuietUninstallString string `reg:"QuietUninstallString,optional"`
+	EstimatedSize        uint32 `reg:"EstimatedSize,optional"`
+	SystemComponent      bool   `reg:"SystemComponent,optional"`
+	WindowsInstaller     bool   `reg:"WindowsInstaller,optional"`
+}
+
+// productKey 为 Installer\Products 子键中的值
+type productKey struct {
+	ProductName string `reg:"ProductName,optional"`
+	Version     uint32 `reg:"Version,optional"`
+	SourceList  struct {
+		LastUsedSource string `reg:"LastUsedSource,optional"`
+	} `reg:"SourceList,optional"`
+}
+
+// Parse 列出 hive 中所有已知位置的已安装程序,按名称排序
+func Parse(reg *registry.Registry) ([]*Program, error) {
+	var errs []error
+	programs := make([]*Program, 0)
+	found := false
+	for _, location := range Locations {
+		key := reg.Open(location.Path)
+		if key == nil {
+			continue
+		}
+		found = true
+		for _, sub := range key.Subkeys() {
+			var p *Program
+			var err error
+			if location.Installer {
+				p, err = parseProduct(sub)
+			} else {
+				p, err = parseUninstall(sub)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if p == nil {
+				continue
+			}
+			p.Sources = []Source{{Location: location.Name, KeyPath: sub.Path(), KeyLastWrite: sub.Timestamp()}}
+			p.KeyLastWrite = sub.Timestamp()
+			programs = append(programs, p)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: Uninstall / Installer\\Products", registry.ErrNotFound)
+	}
+	return Merge(programs), errors.Join(errs...)
+}
+
+func parseUninstall(key *registry.RegistryKey) (*Program, error) {
+	var u uninstallKey
+	err := key.Unmarshal(&u)
+	// 没有 DisplayName 的键通常是补丁或组件,不会出现在"程序和功能"中
+	if u.DisplayName == "" {
+		return nil, err
+	}
+	p := &Program{
+		Name:                 u.DisplayName,
+		Version:              u.DisplayVersion,
+		Publisher:            u.Publisher,
+		InstallDate:          parseInstallDate(u.InstallDate),
+		InstallLocation:      u.InstallLocation,
+		InstallSource:        u.InstallSource,
+		UninstallString:      u.UninstallString,
+		QuietUninstallString: u.QuietUninstallString,
+		EstimatedSize:        u.EstimatedSize,
+		SystemComponent:      u.SystemComponent,
+	}
+	if name := key.Name(); isGUID(name) {
+		p.ProductCode = strings.ToUpper(name)
+	}
+	return p, err
+}
+
+func parseProduct(key *registry.RegistryKey) (*Program, error) {
+	var product productKey
+	err := key.Unmarshal(&product)
+	if product.ProductName == "" {
+		return nil, err
+	}
+	p := &Program{
+		Name:          product.ProductName,
+		InstallSource: product.SourceList.LastUsedSource,
+	}
+	// LastUsedSource 的格式为 "类型;编号;路径"
+	if parts := strings.SplitN(p.InstallSource, ";", 3); len(parts) == 3 {
+		p.InstallSource = parts[2]
+	}
+	if product.Version != 0 {
+		p.Version = fmt.Sprintf("%d.%d.%d", product.Version>>24, product.Version>>16&0xFF, product.Version&0xFFFF)
+	}
+	if code, ok := UnpackGUID(key.Name()); ok {
+		p.ProductCode = code
+	}
+	return p, err
+}
+
+// Merge 合并产品 GUID 相同、或名称与版本都相同的记录,前面记录中的非空字段优先
+func Merge(programs []*Program) []*Program {
+	result := make([]*Program, 0, len(programs))
+	index := make(map[string]*Program)
+	for _, p := range programs {
+		keys := []string{"name:" + strings.ToLower(p.Name) + "|" + p.Version}
+		if p.ProductCode != "" {
+			keys = append(keys, "code:"+p.ProductCode)
+		}
+		var existing *Program
+		for _, k := range keys {
+			if e, ok := index[k]; ok {
+				existing = e
+				break
+			}
+		}
+		if existing == nil {
+			existing = &Program{}
+			*existing = *p
+			existing.Sources = append([]Source(nil), p.Sources...)
+			result = append(result, existing)
+		} else {
+			existing.merge(p)
+		}
+		for _, k := range keys {
+			index[k] = existing
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+	return result
+}
+
+func (p *Program) merge(other *Program) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&p.Version, other.Version)
+	fill(&p.Publisher, other.Publisher)
+	fill(&p.ProductCode, other.ProductCode)
+	fill(&p.InstallLocation, other.InstallLocation)
+	fill(&p.InstallSource, other.InstallSource)
+	fill(&p.UninstallString, other.UninstallString)
+	fill(&p.QuietUninstallString, other.QuietUninstallString)
+	if p.InstallDate.IsZero() {
+		p.InstallDate = other.InstallDate
+	}
+	if p.EstimatedSize == 0 {
+		p.EstimatedSize = other.EstimatedSize
+	}
+	p.SystemComponent = p.SystemComponent || other.SystemComponent
+	if other.KeyLastWrite.After(p.KeyLastWrite) {
+		p.KeyLastWrite = other.KeyLastWrite
+	}
+	p.Sources = append(p.Sources, other.Sources...)
+}
+
+// parseInstallDate 解析 "YYYYMMDD" 格式的安装日期,无法解析时返回零值
+func parseInstallDate(s string) time.Time {
+	t, err := time.Parse("20060102", strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func isGUID(s string) bool {
+	return len(s) == 38 && s[0] == '{' && s[37] == '}' && s[9] == '-' && s[14] == '-' && s[19] == '-' && s[24] == '-'
+}
+
+// UnpackGUID 把 Windows Installer 使用的 32 位压缩 GUID 还原为 {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX},
+// 前三段整体逆序,后八个字节每个字节内两个十六进制字符互换
+func UnpackGUID(packed string) (string, bool) {
+	if len(packed) != 32 {
+		return "", false
+	}
+	for _, c := range packed {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return "", false
+		}
+	}
+	reverse := func(s string) string {
+		b := []byte(s)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return string(b)
+	}
+	swap := func(s string) string {
+		b := []byte(s)
+		for i := 0; i+1 < len(b); i += 2 {
+			b[i], b[i+1] = b[i+1], b[i]
+		}
+		return string(b)
+	}
+	p := strings.ToUpper(packed)
+	return fmt.Sprintf("{%s-%s-%s-%s-%s}",
+		reverse(p[0:8]), reverse(p[8:12]), reverse(p[12:16]), swap(p[16:20]), swap(p[20:32])), true
+}
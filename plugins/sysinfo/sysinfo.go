@@ -0,0 +1,120 @@
+// Package sysinfo 从 SYSTEM 与 SOFTWARE 中汇总主机的基本信息:
+// 系统版本、安装时间、计算机名、时区、最后关机时间与域成员关系
+package sysinfo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+const (
+	currentVersionLocation = "Microsoft\\Windows NT\\CurrentVersion"
+	winlogonLocation       = "Microsoft\\Windows NT\\CurrentVersion\\Winlogon"
+	timeZonesLocation      = "Microsoft\\Windows NT\\CurrentVersion\\Time Zones"
+)
+
+// OSVersion 为 SOFTWARE\Microsoft\Windows NT\CurrentVersion 中的版本信息
+type OSVersion struct {
+	ProductName    string `reg:"ProductName,optional"`
+	EditionID      string `reg:"EditionID,optional"`
+	DisplayVersion string `reg:"DisplayVersion,optional"`
+	ReleaseID      string `reg:"ReleaseId,optional"`
+	CurrentVersion string `reg:"CurrentVersion,optional"`
+	MajorVersion   uint32 `reg:"CurrentMajorVersionNumber,optional"`
+	MinorVersion   uint32 `reg:"CurrentMinorVersionNumber,optional"`
+	CurrentBuild   string `reg:"CurrentBuild,optional"`
+	// UBR 为累积更新的修订号,完整版本号为 CurrentBuild.UBR
+	UBR                    uint32 `reg:"UBR,optional"`
+	BuildLab               string `reg:"BuildLabEx,optional"`
+	ProductID              string `reg:"ProductId,optional"`
+	RegisteredOwner        string `reg:"RegisteredOwner,optional"`
+	RegisteredOrganization string `reg:"RegisteredOrganization,optional"`
+	SystemRoot             string `reg:"SystemRoot,optional"`
+	// InstallDate 为 Unix 秒数,InstallTime 为 FILETIME,功能更新后两者都会被重置
+	InstallDate  time.Time `reg:"InstallDate,optional,unix"`
+	InstallTime  time.Time `reg:"InstallTime,optional,filetime"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+}
+
+// Build 返回 "CurrentBuild.UBR" 形式的完整版本号
+func (v *OSVersion) Build() string {
+	if v.UBR == 0 {
+		return v.CurrentBuild
+	}
+	return fmt.Sprintf("%s.%d", v.CurrentBuild, v.UBR)
+}
+
+// SystemProfile 为主机的基本信息
+type SystemProfile struct {
+	OS *OSVersion
+	// ControlSet 为读取 SYSTEM 信息时使用的 ControlSet
+	ControlSet   string
+	ComputerName string
+	Hostname     string
+	// Domain 来自 Tcpip\Parameters 中的 Domain / NV Domain,为主 DNS 后缀,与域成员关系无关;
+	// DefaultDomainName 为 Winlogon 中最后登录使用的域,
+	// CachePrimaryDomain 为 Winlogon 中记录的主机所属的主域
+	Domain             string
+	DefaultDomainName  string
+	CachePrimaryDomain string
+	// PartOfDomain 表示主机已加入域:Winlogon 中的主域不为空且与计算机名不同。
+	// 缺少 CachePrimaryDomain 时,在已知计算机名的情况下取 DefaultDomainName,工作组中的主机以本机名登录,两者相同
+	PartOfDomain bool
+	TimeZone     *TimeZone
+	// ShutdownTime 为 Control\Windows\ShutdownTime 中记录的最后一次正常关机时间
+	ShutdownTime time.Time
+}
+
+// Parse 从 SYSTEM 与 SOFTWARE 中汇总主机信息,两者都可以为 nil,缺少的部分保持零值
+func Parse(system, software *registry.Registry) (*SystemProfile, error) {
+	profile := &SystemProfile{}
+	var errs []error
+	found := false
+	if key := software.Open(currentVersionLocation); key != nil {
+		found = true
+		profile.OS = &OSVersion{}
+		errs = append(errs, key.Unmarshal(profile.OS))
+		winlogon := software.Open(winlogonLocation)
+		profile.DefaultDomainName, _ = winlogon.GetStringValue("DefaultDomainName")
+		profile.CachePrimaryDomain, _ = winlogon.GetStringValue("CachePrimaryDomain")
+	}
+	if cs := system.CurrentControlSet(); cs != nil {
+		found = true
+		profile.ControlSet = cs.Name()
+		profile.ComputerName, _ = cs.FindKey("Control\\ComputerName\\ComputerName").GetStringValue("ComputerName")
+		tcpip := cs.FindKey("Services\\Tcpip\\Parameters")
+		profile.Hostname, _ = tcpip.GetStringValue("Hostname")
+		if domain, err := tcpip.GetStringValue("Domain"); err == nil && domain != "" {
+			profile.Domain = domain
+		} else if domain, err := tcpip.GetStringValue("NV Domain"); err == nil {
+			profile.Domain = domain
+		}
+		if t, err := cs.FindKey("Control\\Windows").GetTime("ShutdownTime"); err == nil {
+			profile.ShutdownTime = t
+		}
+		if key := cs.FindKey("Control\\TimeZoneInformation"); key != nil {
+			tz, err := ParseTimeZone(key)
+			errs = append(errs, err)
+			profile.TimeZone = tz
+			// SOFTWARE 中存在该时区的定义时,解析其 TZI 填入 tz.TZI
+			if tz != nil && tz.KeyName != "" {
+				if tzi, err := software.Open(timeZonesLocation + "\\" + tz.KeyName).GetBinaryValue("TZI"); err == nil {
+					tz.TZI, _ = ParseTZI(tzi)
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: CurrentVersion / ControlSet", registry.ErrNotFound)
+	}
+	primary := profile.CachePrimaryDomain
+	if primary == "" && profile.ComputerName != "" {
+		primary = profile.DefaultDomainName
+	}
+	profile.PartOfDomain = primary != "" && !strings.EqualFold(primary, profile.ComputerName)
+	return profile, errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package sysinfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+)
+
+// TransitionRule 为夏令时切换规则,对应 SYSTEMTIME 形式的 StandardDate / DaylightDate。
+// Year 为 0 时表示每年在 Month 月第 Week 个 DayOfWeek(Week 为 5 表示最后一个)切换
+type TransitionRule struct {
+	Year      int
+	Month     time.Month
+	DayOfWeek time.Weekday
+	// Week 在 Year 为 0 时为第几周,否则为日期
+	Week   int
+	Hour   int
+	Minute int
+	Second int
+}
+
+func (t *TransitionRule) String() string {
+	if t.Year != 0 {
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", t.Year, t.Month, t.Week, t.Hour, t.Minute, t.Second)
+	}
+	week := fmt.Sprintf("week %d", t.Week)
+	if t.Week == 5 {
+		week = "last"
+	}
+	return fmt.Sprintf("%s %s %s %02d:%02d", t.Month, week, t.DayOfWeek, t.Hour, t.Minute)
+}
+
+// parseTransitionRule 解析 16 字节的 SYSTEMTIME 形式的切换规则,月份为 0 表示不使用夏令时
+func parseTransitionRule(data []byte) (*TransitionRule, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("%w: 切换规则需要 16 字节,实际为 %d 字节", registry.ErrCorrupt, len(data))
+	}
+	field := func(i int) int {
+		return int(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	if field(1) == 0 {
+		return nil, nil
+	}
+	if field(1) > 12 || field(2) > 6 {
+		return nil, fmt.Errorf("%w: 无效的切换规则", registry.ErrCorrupt)
+	}
+	return &TransitionRule{
+		Year:      field(0),
+		Month:     time.Month(field(1)),
+		DayOfWeek: time.Weekday(field(2)),
+		Week:      field(3),
+		Hour:      field(4),
+		Minute:    field(5),
+		Second:    field(6),
+	}, nil
+}
+
+// TZI 为 44 字节的 REG_TZI_FORMAT 结构,偏差单位为分钟,UTC = 本地时间 + 偏差
+type TZI struct {
+	Bias          time.Duration
+	StandardBias  time.Duration
+	DaylightBias  time.Duration
+	StandardStart *TransitionRule
+	DaylightStart *TransitionRule
+}
+
+// ParseTZI 解析 Time Zones\<名称>\TZI 值
+func ParseTZI(data []byte) (*TZI, error) {
+	if len(data) < 44 {
+		return nil, fmt.Errorf("%w: TZI 需要 44 字节,实际为 %d 字节", registry.ErrCorrupt, len(data))
+	}
+	minutes := func(off int) time.Duration {
+		return time.Duration(int32(binary.LittleEndian.Uint32(data[off:]))) * time.Minute
+	}
+	result := &TZI{
+		Bias:         minutes(0),
+		StandardBias: minutes(4),
+		DaylightBias: minutes(8),
+	}
+	var err error
+	if result.StandardStart, err = parseTransitionRule(data[12:28]); err != nil {
+		return result, err
+	}
+	result.DaylightStart, err = parseTransitionRule(data[28:44])
+	return result, err
+}
+
+// TimeZone 为 Control\TimeZoneInformation 中的时区设置
+type TimeZone struct {
+	KeyName      string `reg:"TimeZoneKeyName,optional"`
+	StandardName string `reg:"StandardName,optional"`
+	DaylightName string `reg:"DaylightName,optional"`
+	// 以下偏差单位为分钟,UTC = 本地时间 + 偏差
+	BiasMinutes         int32 `reg:"Bias,optional"`
+	StandardBiasMinutes int32 `reg:"StandardBias,optional"`
+	DaylightBiasMinutes int32 `reg:"DaylightBias,optional"`
+	ActiveBiasMinutes   int32 `reg:"ActiveTimeBias,optional"`
+	// DynamicDaylightTimeDisabled 为 true 时表示关闭了"自动调整夏令时"
+	DynamicDaylightTimeDisabled bool            `reg:"DynamicDaylightTimeDisabled,optional"`
+	RawStandardStart            []byte          `reg:"StandardStart,optional"`
+	RawDaylightStart            []byte          `reg:"DaylightStart,optional"`
+	StandardStart               *TransitionRule `reg:"-"`
+	DaylightStart               *TransitionRule `reg:"-"`
+	// TZI 为 SOFTWARE 中该时区的定义,SOFTWARE 不可用时为 nil
+	TZI          *TZI      `reg:"-"`
+	KeyLastWrite time.Time `reg:",timestamp"`
+}
+
+// UTCOffset 返回标准时间相对 UTC 的偏移,如 UTC+8 返回 8h
+func (tz *TimeZone) UTCOffset() time.Duration {
+	return -time.Duration(tz.BiasMinutes) * time.Minute
+}
+
+// ParseTimeZone 解析 Control\TimeZoneInformation 键
+func ParseTimeZone(key *registry.RegistryKey) (*TimeZone, error) {
+	tz := &TimeZone{}
+	errs := []error{key.Unmarshal(tz)}
+	var err error
+	if tz.RawStandardStart != nil {
+		tz.StandardStart, err = parseTransitionRule(tz.RawStandardStart)
+		errs = append(errs, err)
+	}
+	if tz.RawDaylightStart != nil {
+		tz.DaylightStart, err = parseTransitionRule(tz.RawDaylightStart)
+		errs = append(errs, err)
+	}
+	return tz, errors.Join(errs...)
+}
@@ -0,0 +1,371 @@
+// Package usb 关联 SYSTEM、SOFTWARE 与各用户 NTUSER.DAT 中的记录,
+// 还原 USB 与移动存储设备的使用历史
+package usb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// 设备属性中保存时间的键,位于设备实例的 Properties 子键下
+const (
+	propertySet      = "{83da6326-97a6-4088-9453-a1923f573b29}"
+	propInstallDate  = "0064"
+	propFirstInstall = "0065"
+	propLastArrival  = "0066"
+	propLastRemoval  = "0067"
+)
+
+// 磁盘与卷设备接口类
+const (
+	diskInterface   = "{53f56307-b6bf-11d0-94f2-00a0c91efb8b}"
+	volumeInterface = "{53f5630d-b6bf-11d0-94f2-00a0c91efb8b}"
+)
+
+const (
+	wpdLocation     = "Microsoft\\Windows Portable Devices\\Devices"
+	emdLocation     = "Microsoft\\Windows NT\\CurrentVersion\\EMDMgmt"
+	mountPoints2    = "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\MountPoints2"
+	mountedDevices  = "MountedDevices"
+	dosDevicePrefix = "\\DosDevices\\"
+	volumePrefix    = "\\??\\Volume"
+)
+
+// Hives 为关联设备记录所需的 hive,除 System 外都可以为空
+type Hives struct {
+	System   *registry.Registry
+	Software *registry.Registry
+	// Users 为用户名到其 NTUSER.DAT 的映射
+	Users map[string]*registry.Registry
+}
+
+// UserMount 为某个用户挂载过设备卷的记录
+type UserMount struct {
+	User string
+	// KeyLastWrite 为 MountPoints2\{卷 GUID} 键的最后写入时间,通常是该用户最后一次使用该卷的时间
+	KeyLastWrite time.Time
+}
+
+// Device 为一个 USB 设备
+type Device struct {
+	// Class 为 USBSTOR 中的设备类型,如 Disk、CdRom,只在 Enum\USB 中出现的设备为 USB
+	Class    string
+	Vendor   string
+	Product  string
+	Revision string
+	// InstanceID 为设备实例键名,Serial 为去掉 "&N" 后缀的序列号。
+	// 序列号第二个字符为 '&' 时表示设备没有序列号,由 Windows 生成
+	InstanceID     string
+	Serial         string
+	VID            string
+	PID            string
+	FriendlyName   string
+	ParentIDPrefix string
+	ContainerID    string
+	DriveLetter    string
+	VolumeGUID     string
+	// VolumeName 与 VolumeSerial 来自 Windows Portable Devices 和 EMDMgmt
+	VolumeName   string
+	VolumeSerial string
+	Users        []UserMount
+	// 以下时间来自设备属性 {83da6326-...} 中的 0064 / 0065 / 0066 / 0067
+	InstallDate  time.Time
+	FirstInstall time.Time
+	LastArrival  time.Time
+	LastRemoval  time.Time
+	// KeyLastWrite 为 USBSTOR(或 USB)实例键的最后写入时间
+	KeyLastWrite         time.Time
+	USBKeyLastWrite      time.Time
+	DeviceClassLastWrite time.Time
+}
+
+// matches 判断 PnP 设备路径 s 中是否包含该设备的实例 ID 或 ParentIdPrefix
+func (d *Device) matches(s string) bool {
+	s = strings.ToUpper(s)
+	for _, token := range []string{d.InstanceID, d.ParentIDPrefix} {
+		if token == "" {
+			continue
+		}
+		token = strings.ToUpper(token)
+		if strings.Contains(s, "#"+token+"#") || strings.Contains(s, "#"+token+"&") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse 以 SYSTEM 中 Enum\USBSTOR 与 Enum\USB 的设备为基础,关联其他位置的记录
+func Parse(hives Hives) ([]*Device, error) {
+	if hives.System == nil {
+		return nil, fmt.Errorf("%w: SYSTEM", registry.ErrNotFound)
+	}
+	cs := hives.System.CurrentControlSet()
+	if cs == nil {
+		return nil, fmt.Errorf("%w: ControlSet", registry.ErrNotFound)
+	}
+	devices := parseUSBSTOR(cs.FindKey("Enum\\USBSTOR"))
+	devices = parseUSB(cs.FindKey("Enum\\USB"), devices)
+	if len(devices) == 0 {
+		return devices, nil
+	}
+	parseMountedDevices(hives.System.Open(mountedDevices), devices)
+	parseDeviceClasses(cs.FindKey("Control\\DeviceClasses"), devices)
+	if hives.Software != nil {
+		parseWPD(hives.Software.Open(wpdLocation), devices)
+		parseEMDMgmt(hives.Software.Open(emdLocation), devices)
+	}
+	users := make([]string, 0, len(hives.Users))
+	for user := range hives.Users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		parseMountPoints2(user, hives.Users[user].Open(mountPoints2), devices)
+	}
+	return devices, nil
+}
+
+func parseUSBSTOR(key *registry.RegistryKey) []*Device {
+	result := make([]*Device, 0)
+	for _, class := range key.Subkeys() {
+		kind, vendor, product, revision := splitDeviceID(class.Name())
+		for _, instance := range class.Subkeys() {
+			d := &Device{
+				Class:        kind,
+				Vendor:       vendor,
+				Product:      product,
+				Revision:     revision,
+				InstanceID:   instance.Name(),
+				Serial:       stripInstanceSuffix(instance.Name()),
+				KeyLastWrite: instance.Timestamp(),
+			}
+			readInstance(instance, d)
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// parseUSB 用 Enum\USB 中的实例补充 VID / PID,未对应到 USBSTOR 的设备作为单独的设备返回
+func parseUSB(key *registry.RegistryKey, devices []*Device) []*Device {
+	for _, vidpid := range key.Subkeys() {
+		vid, pid := splitVIDPID(vidpid.Name())
+		for _, instance := range vidpid.Subkeys() {
+			var d *Device
+			for _, existing := range devices {
+				if existing.VID == "" && strings.EqualFold(existing.Serial, instance.Name()) {
+					d = existing
+					break
+				}
+			}
+			if d == nil {
+				d = &Device{Class: "USB", InstanceID: instance.Name(), Serial: instance.Name(), KeyLastWrite: instance.Timestamp()}
+				readInstance(instance, d)
+				devices = append(devices, d)
+			} else {
+				// USB 实例中的时间只在 USBSTOR 中缺失时使用
+				usb := &Device{}
+				readInstance(instance, usb)
+				fillTime(&d.InstallDate, usb.InstallDate)
+				fillTime(&d.FirstInstall, usb.FirstInstall)
+				fillTime(&d.LastArrival, usb.LastArrival)
+				fillTime(&d.LastRemoval, usb.LastRemoval)
+				if d.ContainerID == "" {
+					d.ContainerID = usb.ContainerID
+				}
+			}
+			d.VID, d.PID = vid, pid
+			d.USBKeyLastWrite = instance.Timestamp()
+		}
+	}
+	return devices
+}
+
+func fillTime(dst *time.Time, src time.Time) {
+	if dst.IsZero() {
+		*dst = src
+	}
+}
+
+// readInstance 读取设备实例键中的名称、ParentIdPrefix、ContainerID 与属性时间
+func readInstance(instance *registry.RegistryKey, d *Device) {
+	if name, err := instance.GetStringValue("FriendlyName"); err == nil {
+		d.FriendlyName = name
+	} else if desc, err := instance.GetStringValue("DeviceDesc"); err == nil && d.FriendlyName == "" {
+		// DeviceDesc 通常为 "@usb.inf,%usb.devicedesc%;USB Mass Storage Device" 形式
+		if i := strings.LastIndex(desc, ";"); i != -1 {
+			desc = desc[i+1:]
+		}
+		d.FriendlyName = desc
+	}
+	if prefix, err := instance.GetStringValue("ParentIdPrefix"); err == nil {
+		d.ParentIDPrefix = prefix
+	}
+	if container, err := instance.GetStringValue("ContainerID"); err == nil {
+		d.ContainerID = container
+	}
+	props := instance.FindKey("Properties\\" + propertySet)
+	d.InstallDate = propertyTime(props, propInstallDate)
+	d.FirstInstall = propertyTime(props, propFirstInstall)
+	d.LastArrival = propertyTime(props, propLastArrival)
+	d.LastRemoval = propertyTime(props, propLastRemoval)
+}
+
+// propertyTime 读取设备属性中的 FILETIME。Windows 8 之后为 {属性集}\0064 的默认值,
+// Windows 7 中为 {属性集}\00000064\00000000 的 Data 值
+func propertyTime(props *registry.RegistryKey, id string) time.Time {
+	if props == nil {
+		return time.Time{}
+	}
+	if key := props.SubKey(id); key != nil {
+		if t, err := key.GetTime("(default)"); err == nil {
+			return t
+		}
+	}
+	if key := props.FindKey("0000" + id + "\\00000000"); key != nil {
+		if t, err := key.GetTime("Data"); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseMountedDevices 根据 MountedDevices 中的设备路径找出盘符和卷 GUID
+func parseMountedDevices(key *registry.RegistryKey, devices []*Device) {
+	for _, value := range key.Values() {
+		data, err := value.AsBinary()
+		if err != nil || len(data) <= 12 {
+			// 12 字节的数据为固定磁盘的签名与分区偏移
+			continue
+		}
+		path := utils.DecodeUTF16(data[:len(data)&^1])
+		name := value.Name()
+		for _, d := range devices {
+			if !d.matches(path) {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(name, dosDevicePrefix):
+				d.DriveLetter = strings.TrimPrefix(name, dosDevicePrefix)
+			case strings.HasPrefix(name, volumePrefix):
+				d.VolumeGUID = strings.TrimPrefix(name, volumePrefix)
+			}
+		}
+	}
+}
+
+func parseDeviceClasses(key *registry.RegistryKey, devices []*Device) {
+	for _, iface := range []string{diskInterface, volumeInterface} {
+		for _, sub := range key.SubKey(iface).Subkeys() {
+			for _, d := range devices {
+				if d.matches(sub.Name()) && sub.Timestamp().After(d.DeviceClassLastWrite) {
+					d.DeviceClassLastWrite = sub.Timestamp()
+				}
+			}
+		}
+	}
+}
+
+// parseWPD 从 Windows Portable Devices 中取得卷标,FriendlyName 为 "E:\" 形式时作为盘符
+func parseWPD(key *registry.RegistryKey, devices []*Device) {
+	for _, sub := range key.Subkeys() {
+		name, err := sub.GetStringValue("FriendlyName")
+		if err != nil || name == "" {
+			continue
+		}
+		for _, d := range devices {
+			if !d.matches(sub.Name()) {
+				continue
+			}
+			if len(name) == 3 && strings.HasSuffix(name, ":\\") {
+				if d.DriveLetter == "" {
+					d.DriveLetter = name[:2]
+				}
+			} else {
+				d.VolumeName = name
+			}
+		}
+	}
+}
+
+// parseEMDMgmt 从 ReadyBoost 的 EMDMgmt 键名中取得卷标和卷序列号,
+// 键名形如 "_??_USBSTOR#...#{53f56307-...}卷标_十进制序列号"
+func parseEMDMgmt(key *registry.RegistryKey, devices []*Device) {
+	for _, sub := range key.Subkeys() {
+		name := sub.Name()
+		for _, d := range devices {
+			if !d.matches(name) {
+				continue
+			}
+			tail := name[strings.LastIndex(name, "}")+1:]
+			i := strings.LastIndex(tail, "_")
+			if i == -1 {
+				continue
+			}
+			if label := tail[:i]; label != "" && d.VolumeName == "" {
+				d.VolumeName = label
+			}
+			if serial, err := strconv.ParseUint(tail[i+1:], 10, 32); err == nil {
+				d.VolumeSerial = fmt.Sprintf("%04X-%04X", serial>>16, serial&0xFFFF)
+			}
+		}
+	}
+}
+
+func parseMountPoints2(user string, key *registry.RegistryKey, devices []*Device) {
+	for _, sub := range key.Subkeys() {
+		for _, d := range devices {
+			if d.VolumeGUID != "" && strings.EqualFold(sub.Name(), d.VolumeGUID) {
+				d.Users = append(d.Users, UserMount{User: user, KeyLastWrite: sub.Timestamp()})
+			}
+		}
+	}
+}
+
+// splitDeviceID 拆分 "Disk&Ven_SanDisk&Prod_Cruzer&Rev_1.26" 形式的设备 ID
+func splitDeviceID(id string) (kind, vendor, product, revision string) {
+	parts := strings.Split(id, "&")
+	kind = parts[0]
+	for _, part := range parts[1:] {
+		switch {
+		case hasPrefixFold(part, "Ven_"):
+			vendor = part[4:]
+		case hasPrefixFold(part, "Prod_"):
+			product = part[5:]
+		case hasPrefixFold(part, "Rev_"):
+			revision = part[4:]
+		}
+	}
+	return
+}
+
+// splitVIDPID 拆分 "VID_0781&PID_5567" 形式的键名
+func splitVIDPID(name string) (vid, pid string) {
+	for _, part := range strings.Split(name, "&") {
+		switch {
+		case hasPrefixFold(part, "VID_"):
+			vid = strings.ToUpper(part[4:])
+		case hasPrefixFold(part, "PID_"):
+			pid = strings.ToUpper(part[4:])
+		}
+	}
+	return
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// stripInstanceSuffix 去掉 USBSTOR 实例 ID 结尾的 "&N"
+func stripInstanceSuffix(id string) string {
+	if i := strings.LastIndex(id, "&"); i > 0 && i == len(id)-2 {
+		return id[:i]
+	}
+	return id
+}
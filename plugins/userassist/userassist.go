@@ -0,0 +1,127 @@
+// Package userassist 解析 NTUSER.DAT 中的 UserAssist 记录,
+// 得到程序运行次数、焦点次数、焦点时间和最后运行时间
+package userassist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OblivionTime/go-registry/registry"
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// Location 为 UserAssist 在 NTUSER.DAT 中的位置,其下每个 GUID 子键的 Count 子键保存记录
+const Location = "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\UserAssist"
+
+// GUIDs 为常见的 UserAssist GUID 及其含义
+var GUIDs = map[string]string{
+	"{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}": "Executable File Execution",
+	"{F4E57C4B-2036-45F0-A9AB-443BCFE33D9F}": "Shortcut File Execution",
+	"{75048700-EF1F-11D0-9888-006097DEACF9}": "Active Desktop",
+	"{5E6AB780-7743-11CF-A12B-00AA004AE837}": "Internet Toolbar",
+}
+
+const (
+	win7EntrySize = 72
+	xpEntrySize   = 16
+)
+
+// Entry 为 UserAssist 中的一条记录
+type Entry struct {
+	// GUID 为记录所在的 UserAssist 子键
+	GUID string
+	// Name 为 ROT13 解码后的原始值名,Path 为解析 Known Folder GUID 之后的程序路径
+	Name string
+	Path string
+	// Session 只在 Windows XP 格式中有意义
+	Session    uint32
+	RunCount   uint32
+	FocusCount uint32
+	FocusTime  time.Duration
+	// LastExecuted 为最后一次运行时间,从未记录时为零值
+	LastExecuted time.Time
+	// KeyLastWrite 为 Count 子键的最后写入时间
+	KeyLastWrite time.Time
+}
+
+// Parse 解析 NTUSER.DAT 中所有 UserAssist GUID 下的记录
+func Parse(reg *registry.Registry) ([]*Entry, error) {
+	root := reg.Open(Location)
+	if root == nil {
+		return nil, fmt.Errorf("%w: %s", registry.ErrNotFound, Location)
+	}
+	result := make([]*Entry, 0)
+	for _, guid := range root.Subkeys() {
+		count := guid.SubKey("Count")
+		if count == nil {
+			continue
+		}
+		result = append(result, ParseKey(count)...)
+	}
+	return result, nil
+}
+
+// ParseKey 解析 UserAssist\{GUID}\Count 键下的记录
+func ParseKey(count *registry.RegistryKey) []*Entry {
+	result := make([]*Entry, 0)
+	guid := ""
+	if parent := strings.Split(count.Path(), "\\"); len(parent) >= 2 {
+		guid = strings.ToUpper(parent[len(parent)-2])
+	}
+	for _, value := range count.Values() {
+		data, err := value.AsBinary()
+		if err != nil {
+			continue
+		}
+		name := Rot13(value.Name())
+		entry := &Entry{
+			GUID:         guid,
+			Name:         name,
+			Path:         utils.ResolveKnownFolderPath(strings.TrimPrefix(name, "UEME_RUNPATH:")),
+			KeyLastWrite: count.Timestamp(),
+		}
+		switch len(data) {
+		case win7EntrySize:
+			entry.Session = binary.LittleEndian.Uint32(data[0:])
+			entry.RunCount = binary.LittleEndian.Uint32(data[4:])
+			entry.FocusCount = binary.LittleEndian.Uint32(data[8:])
+			entry.FocusTime = time.Duration(binary.LittleEndian.Uint32(data[12:])) * time.Millisecond
+			entry.LastExecuted = filetime(binary.LittleEndian.Uint64(data[60:]))
+		case xpEntrySize:
+			entry.Session = binary.LittleEndian.Uint32(data[0:])
+			// XP 中运行次数从 5 开始计数
+			entry.RunCount = binary.LittleEndian.Uint32(data[4:])
+			if entry.RunCount >= 5 {
+				entry.RunCount -= 5
+			}
+			entry.LastExecuted = filetime(binary.LittleEndian.Uint64(data[8:]))
+		default:
+			// UEME_CTLSESSION 等其他格式的值
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func filetime(qword uint64) time.Time {
+	if qword == 0 {
+		return time.Time{}
+	}
+	return registry.ParseWindowsTimestamp(int64(qword))
+}
+
+// Rot13 对值名做 ROT13 解码,只变换 ASCII 字母
+func Rot13(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+13)%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+13)%26
+		}
+		return r
+	}, s)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/OblivionTime/go-registry/utils"
@@ -80,18 +81,15 @@ func ParseAppDataCompositeValue(itemType int, data []byte, dataSize int) interfa
 		if len(data) < 2 {
 			return nil
 		}
-		// 这里简单假设 data 是 UTF-16LE 编码
-		value = string(data[:2])
+		value = utils.DecodeUTF16(data[:2])
 	case RegBoolean:
 		if len(data) < 1 {
 			return nil
 		}
 		value = data[0] != 0
 	case RegUnicodeString:
-		// 这里简单假设 data 是 UTF-16LE 编码
-		value = string(data)
+		value = strings.TrimRight(utils.DecodeUTF16(data[:len(data)&^1]), "\x00")
 	case RegCompositeValue:
-		// 假设 ParseAppDataCompositeStream 函数已实现
 		value = ParseAppDataCompositeStream(data)
 	case RegDateTimeOffset:
 		if len(data) < 8 {
@@ -104,12 +102,29 @@ func ParseAppDataCompositeValue(itemType int, data []byte, dataSize int) interfa
 		if len(data) < 8 {
 			return nil
 		}
-		var val uint64
+		var val int64
 		binary.Read(bytes.NewReader(data[:8]), binary.LittleEndian, &val)
 		value = time.Duration(val*100) * time.Nanosecond
 	case RegGUID:
-		// 假设 ReadGuid 函数已实现
 		value = ReadGuid(data)
+	case RegPoint:
+		f := readFloat32s(data, 2)
+		if f == nil {
+			return nil
+		}
+		value = AppDataPoint{X: f[0], Y: f[1]}
+	case RegSize:
+		f := readFloat32s(data, 2)
+		if f == nil {
+			return nil
+		}
+		value = AppDataSize{Width: f[0], Height: f[1]}
+	case RegRect:
+		f := readFloat32s(data, 4)
+		if f == nil {
+			return nil
+		}
+		value = AppDataRect{X: f[0], Y: f[1], Width: f[2], Height: f[3]}
 	case RegBytesArray:
 		if len(data) < dataSize {
 			return nil
@@ -196,8 +211,7 @@ func ParseAppDataCompositeValue(itemType int, data []byte, dataSize int) interfa
 		}
 		value = result
 	case RegUnicodeCharArray:
-		// 这里简单假设 data 是 UTF-16LE 编码
-		value = string(data)
+		value = utils.DecodeUTF16(data[:len(data)&^1])
 	case RegBooleanArray:
 		if len(data) < dataSize {
 			return nil
@@ -208,7 +222,6 @@ func ParseAppDataCompositeValue(itemType int, data []byte, dataSize int) interfa
 		}
 		value = result
 	case RegUnicodeStringArray:
-		// 假设 ReadUnicodeStringArray 函数已实现
 		value = ReadUnicodeStringArray(data)
 	default:
 		fmt.Printf("UNKNOWN TYPE FOUND 0x%X data=%v \nPlease report to developers!\n", itemType, data)
@@ -254,33 +267,33 @@ func ParseAppDataCompositeStream(buf []byte) map[string]interface{} {
 	compositeData := make(map[string]interface{})
 	bufLen := len(buf)
 	pos := 0
-	itemPos := 0
 
-	for pos < bufLen {
-		var itemByteLen, itemType, itemNameLen uint32
-		// 从 buf 中按小端字节序解包出 itemByteLen, itemType, itemNameLen
-		err := binary.Read(bytes.NewReader(buf[pos:pos+12]), binary.LittleEndian, &[]interface{}{&itemByteLen, &itemType, &itemNameLen})
-		if err != nil {
-			fmt.Printf("解包数据时出错: %v\n", err)
-			break
-		}
-		itemPos = pos
+	for pos+12 <= bufLen {
+		// 每一项依次为 itemByteLen, itemType, itemNameLen 三个小端 uint32
+		itemByteLen := int(binary.LittleEndian.Uint32(buf[pos:]))
+		itemType := int(binary.LittleEndian.Uint32(buf[pos+4:]))
+		itemNameLen := int(binary.LittleEndian.Uint32(buf[pos+8:]))
+		itemPos := pos
 		pos += 12
 
-		// 提取并解码 itemName
-		itemNameBytes := buf[pos : pos+int(itemNameLen)*2]
-		itemName := string(itemNameBytes) // 这里简单假设是 UTF-16LE 编码，可按需调整
-		pos += (int(itemNameLen) + 1) * 2
+		// 名称为 UTF-16LE 编码,以 \0 结尾
+		nameEnd := pos + itemNameLen*2
+		dataSize := itemByteLen - 12 - (itemNameLen+1)*2
+		if itemByteLen <= 0 || nameEnd > bufLen || dataSize < 0 || nameEnd+2+dataSize > bufLen {
+			// 长度错误时停止解析,只返回之前已解析的项
+			break
+		}
+		itemName := utils.DecodeUTF16(buf[pos:nameEnd])
+		pos = nameEnd + 2
 
-		// 计算数据大小
-		dataSize := int(itemByteLen) - 12 - (int(itemNameLen)+1)*2
 		data := buf[pos : pos+dataSize]
+		if itemType < 0x100 {
+			// 复合数据中的类型可能不带 0x100 前缀
+			itemType |= 0x100
+		}
+		compositeData[itemName] = ParseAppDataCompositeValue(itemType, data, dataSize)
 
-		// 调用 ParseAppDataCompositeValue 解析数据
-		value := ParseAppDataCompositeValue(int(itemType), data, dataSize)
-		compositeData[itemName] = value
-
-		pos = itemPos + int(itemByteLen)
+		pos = itemPos + itemByteLen
 		// 对齐到 8 字节边界
 		if pos%8 != 0 {
 			pos += 8 - (pos % 8)
@@ -289,38 +302,86 @@ func ParseAppDataCompositeStream(buf []byte) map[string]interface{} {
 	return compositeData
 }
 
-// ReadUnicodeStringArray 从字节缓冲区读取 Unicode 字符串数组
+// ReadUnicodeStringArray 从字节缓冲区读取 Unicode 字符串数组,
+// 每一项为 4 字节的字节长度加上 UTF-16LE 编码的字符串
 func ReadUnicodeStringArray(buf []byte) []string {
-	var strings []string
+	var result []string
 	bufLen := len(buf)
 	pos := 0
 
-	for pos < bufLen {
-		var itemByteLen uint32
-		// 从 buf 中按小端字节序解包出 itemByteLen
-		err := binary.Read(bytes.NewReader(buf[pos:pos+4]), binary.LittleEndian, &itemByteLen)
-		if err != nil {
-			fmt.Printf("解包字符串长度时出错: %v\n", err)
+	for pos+4 <= bufLen {
+		itemByteLen := int(binary.LittleEndian.Uint32(buf[pos:]))
+		pos += 4
+		if pos+itemByteLen > bufLen {
+			// 长度错误时停止解析,只返回之前已解析的字符串
 			break
 		}
-		pos += 4
 
-		// 提取字符串数据
-		stringData := buf[pos : pos+int(itemByteLen)]
-		// 将 UTF-16 数据转换为 UTF-8 字符串
-		var runes []byte
-		for i := 0; i < len(stringData); i += 2 {
-			r := binary.LittleEndian.Uint16(stringData[i : i+2])
-			runes = append(runes, byte(r))
-		}
-		// 去除末尾的空字符
-		for len(runes) > 0 && runes[len(runes)-1] == 0 {
-			runes = runes[:len(runes)-1]
-		}
-		utf8Str := utils.DecodeUTF16(runes)
-		strings = append(strings, utf8Str)
+		// 将 UTF-16 数据转换为 UTF-8 字符串,并去除末尾的空字符
+		stringData := buf[pos : pos+itemByteLen&^1]
+		result = append(result, strings.TrimRight(utils.DecodeUTF16(stringData), "\x00"))
 
-		pos += int(itemByteLen)
+		pos += itemByteLen
 	}
-	return strings
+	return result
+}
+
+// readFloat32s 读取 count 个小端 float32,数据不足时返回 nil
+func readFloat32s(data []byte, count int) []float32 {
+	if len(data) < count*4 {
+		return nil
+	}
+	result := make([]float32, count)
+	binary.Read(bytes.NewReader(data[:count*4]), binary.LittleEndian, result)
+	return result
+}
+
+// AppDataPoint 对应 Windows.Foundation.Point
+type AppDataPoint struct {
+	X, Y float32
+}
+
+// AppDataSize 对应 Windows.Foundation.Size
+type AppDataSize struct {
+	Width, Height float32
+}
+
+// AppDataRect 对应 Windows.Foundation.Rect
+type AppDataRect struct {
+	X, Y, Width, Height float32
+}
+
+// AppDataSetting 为 settings.dat 中的一个值及其修改时间
+type AppDataSetting struct {
+	Path      string
+	Name      string
+	Type      string
+	Value     interface{}
+	Timestamp time.Time
+}
+
+// AppDataSettings 递归读取键及其子键下所有 settings.dat 类型的值
+func (r *RegistryKey) AppDataSettings() []*AppDataSetting {
+	result := make([]*AppDataSetting, 0)
+	for _, v := range r.Values() {
+		t, ok := v.Timestamp()
+		if !ok {
+			continue
+		}
+		data, err := v.decoded()
+		if err != nil {
+			data = nil
+		}
+		result = append(result, &AppDataSetting{
+			Path:      r.Path(),
+			Name:      v.Name(),
+			Type:      v.Value_type(),
+			Value:     data,
+			Timestamp: t,
+		})
+	}
+	for _, k := range r.Subkeys() {
+		result = append(result, k.AppDataSettings()...)
+	}
+	return result
 }
@@ -0,0 +1,501 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/OblivionTime/go-registry/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound 指定的注册表项不存在
+	ErrNotFound = errors.New("未找到指定的注册表项")
+	// ErrTypeMismatch 注册表项的类型与请求的类型不符
+	ErrTypeMismatch = errors.New("注册表项类型不匹配")
+	// ErrCorrupt 注册表项的数据无法解析
+	ErrCorrupt = errors.New("注册表项数据已损坏")
+)
+
+// getValue 按名称查找值并用 as 转换为指定类型,值列表损坏导致的 panic 会被转换为 ErrCorrupt
+func getValue[T any](r *RegistryKey, name string, as func(*RegistryValue) (T, error)) (result T, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			var zero T
+			result, err = zero, fmt.Errorf("%w: %s: %v", ErrCorrupt, name, p)
+		}
+	}()
+	value := r.Value(name)
+	if value == nil {
+		return result, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return as(value)
+}
+
+// GetStringValue 获取字符串类型的值
+func (r *RegistryKey) GetStringValue(name string) (string, error) {
+	return getValue(r, name, (*RegistryValue).AsString)
+}
+
+// GetStrings 获取字符串数组类型的值,单个字符串会作为只有一个元素的数组返回
+func (r *RegistryKey) GetStrings(name string) ([]string, error) {
+	return getValue(r, name, (*RegistryValue).AsStrings)
+}
+
+// GetBinaryValue 获取字节数组类型的值
+func (r *RegistryKey) GetBinaryValue(name string) ([]byte, error) {
+	return getValue(r, name, (*RegistryValue).AsBinary)
+}
+
+// GetInt32Value 获取 32 位及以下整数类型的值
+func (r *RegistryKey) GetInt32Value(name string) (uint32, error) {
+	return getValue(r, name, (*RegistryValue).AsInt32)
+}
+
+// GetInt64Value 获取整数类型的值
+func (r *RegistryKey) GetInt64Value(name string) (uint64, error) {
+	return getValue(r, name, (*RegistryValue).AsInt64)
+}
+
+// GetInt32s 获取 32 位及以下整数数组类型的值
+func (r *RegistryKey) GetInt32s(name string) ([]uint32, error) {
+	return getValue(r, name, (*RegistryValue).AsInt32s)
+}
+
+// GetInt64s 获取整数数组类型的值
+func (r *RegistryKey) GetInt64s(name string) ([]uint64, error) {
+	return getValue(r, name, (*RegistryValue).AsInt64s)
+}
+
+// GetFloat64 获取浮点类型的值
+func (r *RegistryKey) GetFloat64(name string) (float64, error) {
+	return getValue(r, name, (*RegistryValue).AsFloat64)
+}
+
+// GetFloat64s 获取浮点数组类型的值
+func (r *RegistryKey) GetFloat64s(name string) ([]float64, error) {
+	return getValue(r, name, (*RegistryValue).AsFloat64s)
+}
+
+// GetBool 获取布尔类型的值,整数类型的值非 0 即为 true
+func (r *RegistryKey) GetBool(name string) (bool, error) {
+	return getValue(r, name, (*RegistryValue).AsBool)
+}
+
+// GetBools 获取布尔数组类型的值
+func (r *RegistryKey) GetBools(name string) ([]bool, error) {
+	return getValue(r, name, (*RegistryValue).AsBools)
+}
+
+// GetTime 获取时间类型的值,REG_QWORD 和 8 字节的 REG_BINARY 按 FILETIME 解析
+func (r *RegistryKey) GetTime(name string) (time.Time, error) {
+	return getValue(r, name, (*RegistryValue).AsTime)
+}
+
+// GetSystemTime 获取以 16 字节 SYSTEMTIME 结构保存的 REG_BINARY 时间
+func (r *RegistryKey) GetSystemTime(name string) (time.Time, error) {
+	return getValue(r, name, (*RegistryValue).AsSystemTime)
+}
+
+// GetDuration 获取时间间隔类型的值
+func (r *RegistryKey) GetDuration(name string) (time.Duration, error) {
+	return getValue(r, name, (*RegistryValue).AsDuration)
+}
+
+// GetGUID 获取 GUID 类型的值,字符串和 16 字节的 REG_BINARY 也会按 GUID 解析
+func (r *RegistryKey) GetGUID(name string) (uuid.UUID, error) {
+	return getValue(r, name, (*RegistryValue).AsGUID)
+}
+
+// GetComposite 获取 settings.dat 中复合类型的值
+func (r *RegistryKey) GetComposite(name string) (map[string]interface{}, error) {
+	return getValue(r, name, (*RegistryValue).AsComposite)
+}
+
+// GetResourceList 获取 REG_RESOURCE_LIST 类型的值
+func (r *RegistryKey) GetResourceList(name string) (*ResourceList, error) {
+	return getValue(r, name, (*RegistryValue).AsResourceList)
+}
+
+// GetFullResourceDescriptor 获取 REG_FULL_RESOURCE_DESCRIPTOR 类型的值
+func (r *RegistryKey) GetFullResourceDescriptor(name string) (*FullResourceDescriptor, error) {
+	return getValue(r, name, (*RegistryValue).AsFullResourceDescriptor)
+}
+
+// GetResourceRequirementsList 获取 REG_RESOURCE_REQUIREMENTS_LIST 类型的值
+func (r *RegistryKey) GetResourceRequirementsList(name string) (*ResourceRequirementsList, error) {
+	return getValue(r, name, (*RegistryValue).AsResourceRequirementsList)
+}
+
+// decoded 解析值的数据,数据损坏导致的 panic 会被转换为 ErrCorrupt
+func (r *RegistryValue) decoded() (value interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			value = nil
+			err = fmt.Errorf("%w: %s: %v", ErrCorrupt, r.Name(), p)
+		}
+	}()
+	return r.Value(0), nil
+}
+
+func (r *RegistryValue) mismatch(want string) error {
+	return fmt.Errorf("%w: 指定的注册表项的类型为:%s,而不是%s类型", ErrTypeMismatch, r.Value_type(), want)
+}
+
+// decodedOf 在值的类型属于 types 时返回解析后的数据
+func (r *RegistryValue) decodedOf(want string, types ...[]int) (interface{}, error) {
+	data_type := r.Value_type_ori()
+	for _, t := range types {
+		if slices.Contains(t, data_type) {
+			return r.decoded()
+		}
+	}
+	return nil, r.mismatch(want)
+}
+
+// AsString 将值转换为字符串
+func (r *RegistryValue) AsString() (string, error) {
+	v, err := r.decodedOf("字符串", stringTypes)
+	if err != nil {
+		return "", err
+	}
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		// REG_LINK 保存的是不以 \0 结尾的 UTF-16 字符串
+		return utils.DecodeUTF16(s), nil
+	}
+	return "", r.mismatch("字符串")
+}
+
+// AsStrings 将值转换为字符串数组
+func (r *RegistryValue) AsStrings() ([]string, error) {
+	if slices.Contains(stringTypes, r.Value_type_ori()) {
+		s, err := r.AsString()
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+	v, err := r.decodedOf("字符串数组", stringArrayTypes)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.([]string)
+	if !ok {
+		return nil, r.mismatch("字符串数组")
+	}
+	// REG_MULTI_SZ 以两个 \0 结尾,去掉拆分后末尾的空字符串
+	for len(s) > 0 && s[len(s)-1] == "" {
+		s = s[:len(s)-1]
+	}
+	return s, nil
+}
+
+// AsBinary 将值转换为字节数组
+func (r *RegistryValue) AsBinary() ([]byte, error) {
+	v, err := r.decodedOf("字节数组", byteArrayTypes)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, r.mismatch("字节数组")
+	}
+	return b, nil
+}
+
+// AsInt32 将值转换为 32 位无符号整数,有符号整数按补码转换
+func (r *RegistryValue) AsInt32() (uint32, error) {
+	v, err := r.decodedOf("int32", int32Types)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case uint8:
+		return uint32(n), nil
+	case int16:
+		return uint32(n), nil
+	case uint16:
+		return uint32(n), nil
+	case int32:
+		return uint32(n), nil
+	case uint32:
+		return n, nil
+	}
+	return 0, r.mismatch("int32")
+}
+
+// AsInt64 将值转换为 64 位无符号整数,32 位及以下整数也可以转换
+func (r *RegistryValue) AsInt64() (uint64, error) {
+	if slices.Contains(int32Types, r.Value_type_ori()) {
+		n, err := r.AsInt32()
+		return uint64(n), err
+	}
+	v, err := r.decodedOf("int64", int64Types)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case int64:
+		return uint64(n), nil
+	case uint64:
+		return n, nil
+	}
+	return 0, r.mismatch("int64")
+}
+
+// AsInt32s 将值转换为 32 位无符号整数数组
+func (r *RegistryValue) AsInt32s() ([]uint32, error) {
+	v, err := r.decodedOf("int32数组", int32ArrayTypes)
+	if err != nil {
+		return nil, err
+	}
+	switch n := v.(type) {
+	case []int16:
+		return convertSlice[int16, uint32](n), nil
+	case []uint16:
+		return convertSlice[uint16, uint32](n), nil
+	case []int32:
+		return convertSlice[int32, uint32](n), nil
+	case []uint32:
+		return n, nil
+	}
+	return nil, r.mismatch("int32数组")
+}
+
+// AsInt64s 将值转换为 64 位无符号整数数组,32 位及以下整数数组也可以转换
+func (r *RegistryValue) AsInt64s() ([]uint64, error) {
+	if slices.Contains(int32ArrayTypes, r.Value_type_ori()) {
+		n, err := r.AsInt32s()
+		if err != nil {
+			return nil, err
+		}
+		return convertSlice[uint32, uint64](n), nil
+	}
+	v, err := r.decodedOf("int64数组", int64ArrayTypes)
+	if err != nil {
+		return nil, err
+	}
+	switch n := v.(type) {
+	case []int64:
+		return convertSlice[int64, uint64](n), nil
+	case []uint64:
+		return n, nil
+	}
+	return nil, r.mismatch("int64数组")
+}
+
+func convertSlice[From, To uint64 | int64 | uint32 | int32 | uint16 | int16 | float32 | float64](s []From) []To {
+	result := make([]To, len(s))
+	for i, v := range s {
+		result[i] = To(v)
+	}
+	return result
+}
+
+// AsFloat64 将值转换为浮点数
+func (r *RegistryValue) AsFloat64() (float64, error) {
+	v, err := r.decodedOf("浮点", floatTypes)
+	if err != nil {
+		return 0, err
+	}
+	switch f := v.(type) {
+	case float32:
+		return float64(f), nil
+	case float64:
+		return f, nil
+	}
+	return 0, r.mismatch("浮点")
+}
+
+// AsFloat64s 将值转换为浮点数组
+func (r *RegistryValue) AsFloat64s() ([]float64, error) {
+	v, err := r.decodedOf("浮点数组", floatArrayTypes)
+	if err != nil {
+		return nil, err
+	}
+	switch f := v.(type) {
+	case []float32:
+		return convertSlice[float32, float64](f), nil
+	case []float64:
+		return f, nil
+	}
+	return nil, r.mismatch("浮点数组")
+}
+
+// AsBool 将值转换为布尔值,整数类型的值非 0 即为 true
+func (r *RegistryValue) AsBool() (bool, error) {
+	data_type := r.Value_type_ori()
+	if slices.Contains(int32Types, data_type) || slices.Contains(int64Types, data_type) {
+		n, err := r.AsInt64()
+		return n != 0, err
+	}
+	v, err := r.decodedOf("布尔", []int{RegBoolean})
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, r.mismatch("布尔")
+	}
+	return b, nil
+}
+
+// AsBools 将值转换为布尔数组
+func (r *RegistryValue) AsBools() ([]bool, error) {
+	v, err := r.decodedOf("布尔数组", []int{RegBooleanArray})
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.([]bool)
+	if !ok {
+		return nil, r.mismatch("布尔数组")
+	}
+	return b, nil
+}
+
+// AsTime 将值转换为时间,REG_QWORD 和 8 字节的 REG_BINARY 按 FILETIME 解析
+func (r *RegistryValue) AsTime() (time.Time, error) {
+	switch r.Value_type_ori() {
+	case RegQWord:
+		n, err := r.AsInt64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return ParseWindowsTimestamp(int64(n)), nil
+	case RegBin:
+		b, err := r.AsBinary()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(b) != 8 {
+			return time.Time{}, r.mismatch("时间")
+		}
+		return ParseWindowsTimestamp(int64(utils.UnpackUint64LittleEndian(b))), nil
+	}
+	v, err := r.decodedOf("时间", timeTypes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		return time.Time{}, r.mismatch("时间")
+	}
+	return t, nil
+}
+
+// AsSystemTime 将 16 字节的 REG_BINARY 按 SYSTEMTIME 结构转换为时间
+func (r *RegistryValue) AsSystemTime() (time.Time, error) {
+	b, err := r.AsBinary()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(b) != 16 {
+		return time.Time{}, r.mismatch("SYSTEMTIME")
+	}
+	return ParseSystemTime(b)
+}
+
+// AsDuration 将值转换为时间间隔
+func (r *RegistryValue) AsDuration() (time.Duration, error) {
+	v, err := r.decodedOf("时间间隔", []int{RegTimeSpan})
+	if err != nil {
+		return 0, err
+	}
+	d, ok := v.(time.Duration)
+	if !ok {
+		return 0, r.mismatch("时间间隔")
+	}
+	return d, nil
+}
+
+// AsGUID 将值转换为 GUID,字符串和 16 字节的 REG_BINARY 也会按 GUID 解析
+func (r *RegistryValue) AsGUID() (uuid.UUID, error) {
+	data_type := r.Value_type_ori()
+	switch {
+	case slices.Contains(stringTypes, data_type):
+		s, err := r.AsString()
+		if err != nil {
+			return uuid.Nil, err
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("%w: %v", ErrTypeMismatch, err)
+		}
+		return id, nil
+	case data_type == RegBin:
+		b, err := r.AsBinary()
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if len(b) != 16 {
+			return uuid.Nil, r.mismatch("GUID")
+		}
+		return ReadGuid(b), nil
+	}
+	v, err := r.decodedOf("GUID", []int{RegGUID})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, ok := v.(uuid.UUID)
+	if !ok {
+		return uuid.Nil, r.mismatch("GUID")
+	}
+	return id, nil
+}
+
+// AsComposite 将 settings.dat 中的复合值转换为名称到值的映射
+func (r *RegistryValue) AsComposite() (map[string]interface{}, error) {
+	v, err := r.decodedOf("复合", []int{RegCompositeValue})
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, r.mismatch("复合")
+	}
+	return m, nil
+}
+
+// AsResourceList 将值转换为 REG_RESOURCE_LIST
+func (r *RegistryValue) AsResourceList() (*ResourceList, error) {
+	v, err := r.decodedOf("RegResourceList", []int{RegResourceList})
+	if err != nil {
+		return nil, err
+	}
+	l, ok := v.(*ResourceList)
+	if !ok {
+		return nil, fmt.Errorf("%w: 无法解析 RegResourceList", ErrCorrupt)
+	}
+	return l, nil
+}
+
+// AsFullResourceDescriptor 将值转换为 REG_FULL_RESOURCE_DESCRIPTOR
+func (r *RegistryValue) AsFullResourceDescriptor() (*FullResourceDescriptor, error) {
+	v, err := r.decodedOf("RegFullResourceDescriptor", []int{RegFullResourceDescriptor})
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(*FullResourceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%w: 无法解析 RegFullResourceDescriptor", ErrCorrupt)
+	}
+	return d, nil
+}
+
+// AsResourceRequirementsList 将值转换为 REG_RESOURCE_REQUIREMENTS_LIST
+func (r *RegistryValue) AsResourceRequirementsList() (*ResourceRequirementsList, error) {
+	v, err := r.decodedOf("RegResourceRequirementsList", []int{RegResourceRequirementsList})
+	if err != nil {
+		return nil, err
+	}
+	l, ok := v.(*ResourceRequirementsList)
+	if !ok {
+		return nil, fmt.Errorf("%w: 无法解析 RegResourceRequirementsList", ErrCorrupt)
+	}
+	return l, nil
+}
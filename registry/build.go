@@ -0,0 +1,228 @@
+package registry
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// buildKey 为合成 hive 时的一个键,用于把 Win9x、Win3.1 等其他格式的注册表转换为 regf,
+// 转换后即可通过 RegistryKey / RegistryValue 以相同的方式访问
+type buildKey struct {
+	name      string
+	timestamp time.Time
+	values    []buildValue
+	subkeys   []*buildKey
+}
+
+type buildValue struct {
+	// name 为空时为默认值
+	name string
+	typ  uint32
+	data []byte
+}
+
+func (k *buildKey) add(name string) *buildKey {
+	sub := &buildKey{name: name}
+	k.subkeys = append(k.subkeys, sub)
+	return sub
+}
+
+// hiveBuilder 把所有 cell 写入同一个 hbin,hbin 的大小在最后按 4K 对齐
+type hiveBuilder struct {
+	bin []byte
+	sk  uint32
+}
+
+// buildHive 生成以 root 为根键的完整 hive,fileName 写入 base block 中的文件名字段
+func buildHive(root *buildKey, fileName string) []byte {
+	b := &hiveBuilder{bin: make([]byte, hbinHeaderLen)}
+	copy(b.bin, "hbin")
+	b.sk = b.security(countKeys(root))
+	rootOffset := b.key(root, 0xFFFFFFFF)
+
+	size := (len(b.bin) + 4 + hbinAlignment - 1) / hbinAlignment * hbinAlignment
+	if rest := size - len(b.bin); rest > 0 {
+		free := make([]byte, rest)
+		binary.LittleEndian.PutUint32(free, uint32(rest))
+		b.bin = append(b.bin, free...)
+	}
+	binary.LittleEndian.PutUint32(b.bin[8:], uint32(size))
+
+	buf := make([]byte, baseBlockSize, baseBlockSize+len(b.bin))
+	writeBaseBlock(buf)
+	name := utf16.Encode([]rune(fileName))
+	for i := 0; i < len(name) && i < 31; i++ {
+		binary.LittleEndian.PutUint16(buf[0x30+2*i:], name[i])
+	}
+	buf = append(buf, b.bin...)
+	patchBaseBlock(buf, rootOffset)
+	return buf
+}
+
+func countKeys(k *buildKey) uint32 {
+	n := uint32(1)
+	for _, sub := range k.subkeys {
+		n += countKeys(sub)
+	}
+	return n
+}
+
+// alloc 分配一个至少能容纳 size 字节数据的 cell,返回 cell 的偏移与数据部分
+func (b *hiveBuilder) alloc(size int) (uint32, []byte) {
+	offset := uint32(len(b.bin))
+	cell := alignCell(size + 4)
+	b.bin = append(b.bin, make([]byte, cell)...)
+	binary.LittleEndian.PutUint32(b.bin[offset:], uint32(int32(-cell)))
+	return offset, b.bin[offset+4 : int(offset)+cell]
+}
+
+// security 写入所有键共用的 sk cell,安全描述符为空的自相对格式
+func (b *hiveBuilder) security(refs uint32) uint32 {
+	offset, sk := b.alloc(0x14 + 20)
+	copy(sk, "sk")
+	binary.LittleEndian.PutUint32(sk[4:], offset)
+	binary.LittleEndian.PutUint32(sk[8:], offset)
+	binary.LittleEndian.PutUint32(sk[0xC:], refs)
+	binary.LittleEndian.PutUint32(sk[0x10:], 20)
+	sk[0x14] = 1
+	binary.LittleEndian.PutUint16(sk[0x16:], 0x8000)
+	return offset
+}
+
+// encodeName 返回名称的存储形式,只包含 ASCII 字符时按单字节存储
+func encodeName(name string) ([]byte, bool) {
+	ascii := true
+	for _, r := range name {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return []byte(name), true
+	}
+	return encodeUTF16(name, false), false
+}
+
+// encodeUTF16 把字符串编码为 UTF-16LE,terminate 为 true 时追加结尾的 NUL
+func encodeUTF16(s string, terminate bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if terminate {
+		units = append(units, 0)
+	}
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+// nameHash 为 lh 列表使用的名称哈希
+func nameHash(name string) uint32 {
+	var h uint32
+	for _, r := range name {
+		h = h*37 + uint32(unicode.ToUpper(r))
+	}
+	return h
+}
+
+func (b *hiveBuilder) key(k *buildKey, parent uint32) uint32 {
+	name, ascii := encodeName(k.name)
+	offset, _ := b.alloc(0x4C + len(name))
+	flags := uint16(0)
+	if ascii {
+		flags |= nkFlagCompName
+	}
+	if parent == 0xFFFFFFFF {
+		flags |= nkFlagHiveEntry
+	}
+	subkeys := slices.Clone(k.subkeys)
+	slices.SortStableFunc(subkeys, func(x, y *buildKey) int {
+		return strings.Compare(strings.ToUpper(x.name), strings.ToUpper(y.name))
+	})
+
+	var maxName, maxValueName, maxData int
+	children := make([]uint32, len(subkeys))
+	for i, sub := range subkeys {
+		children[i] = b.key(sub, offset)
+		maxName = max(maxName, len(encodeUTF16(sub.name, false)))
+	}
+	list := uint32(0xFFFFFFFF)
+	if len(children) > 0 {
+		var lh []byte
+		list, lh = b.alloc(4 + 8*len(children))
+		copy(lh, "lh")
+		binary.LittleEndian.PutUint16(lh[2:], uint16(len(children)))
+		for i, child := range children {
+			binary.LittleEndian.PutUint32(lh[4+8*i:], child)
+			binary.LittleEndian.PutUint32(lh[8+8*i:], nameHash(subkeys[i].name))
+		}
+	}
+	values := uint32(0xFFFFFFFF)
+	if len(k.values) > 0 {
+		vks := make([]uint32, len(k.values))
+		for i, v := range k.values {
+			vks[i] = b.value(v)
+			maxValueName = max(maxValueName, len(encodeUTF16(v.name, false)))
+			maxData = max(maxData, len(v.data))
+		}
+		var l []byte
+		values, l = b.alloc(4 * len(vks))
+		for i, vk := range vks {
+			binary.LittleEndian.PutUint32(l[4*i:], vk)
+		}
+	}
+
+	// 子键与值写入后 b.bin 可能已重新分配,因此最后再填写 nk
+	nk := b.bin[offset+4:]
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], flags)
+	if ticks := (k.timestamp.Unix()+11644473600)*10000000 + int64(k.timestamp.Nanosecond())/100; ticks > 0 {
+		binary.LittleEndian.PutUint64(nk[4:], uint64(ticks))
+	}
+	binary.LittleEndian.PutUint32(nk[0x10:], parent)
+	binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(children)))
+	binary.LittleEndian.PutUint32(nk[0x1C:], list)
+	binary.LittleEndian.PutUint32(nk[0x20:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x24:], uint32(len(k.values)))
+	binary.LittleEndian.PutUint32(nk[0x28:], values)
+	binary.LittleEndian.PutUint32(nk[0x2C:], b.sk)
+	binary.LittleEndian.PutUint32(nk[0x30:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x34:], uint32(maxName))
+	binary.LittleEndian.PutUint32(nk[0x3C:], uint32(maxValueName))
+	binary.LittleEndian.PutUint32(nk[0x40:], uint32(maxData))
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	copy(nk[0x4C:], name)
+	return offset
+}
+
+// value 写入 vk cell,不超过 4 字节的数据直接存放在 vk 中
+func (b *hiveBuilder) value(v buildValue) uint32 {
+	name, ascii := encodeName(v.name)
+	offset, _ := b.alloc(0x14 + len(name))
+	length := uint32(len(v.data))
+	dataOffset := uint32(0)
+	if len(v.data) <= 4 {
+		dataOffset = binary.LittleEndian.Uint32(append(slices.Clone(v.data), 0, 0, 0, 0))
+		length |= 0x80000000
+	} else {
+		var cell []byte
+		dataOffset, cell = b.alloc(len(v.data))
+		copy(cell, v.data)
+	}
+	vk := b.bin[offset+4:]
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[2:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[4:], length)
+	binary.LittleEndian.PutUint32(vk[8:], dataOffset)
+	binary.LittleEndian.PutUint32(vk[0xC:], v.typ)
+	if ascii {
+		binary.LittleEndian.PutUint16(vk[0x10:], 1)
+	}
+	copy(vk[0x14:], name)
+	return offset
+}
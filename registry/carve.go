@@ -0,0 +1,494 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+)
+
+const (
+	baseBlockSize = 0x1000
+	hbinAlignment = 0x1000
+	hbinHeaderLen = 0x20
+	// carveStep 为扫描签名的步长,磁盘镜像中的分区不一定按 4K 对齐,因此按扇区扫描
+	carveStep = 512
+	// carveChunk 为每次从输入中读取的数据量
+	carveChunk = 4 << 20
+	// maxCarvedHive 为 hbin 相对偏移的上限,超过时认为该 hbin 已损坏
+	maxCarvedHive = 1 << 31
+	// carveSlack 为一个 hive 中最多用空 hbin 填充的长度,包括缺失的 hbin 与 base block 中
+	// 声明的大小超出已恢复 hbin 的部分。相对偏移与声明的大小都不可信,不能按它们分配内存
+	carveSlack = 1 << 20
+	// maxListEntries 为一个 lf 列表中的最大项数,更多的孤立键分到多个 lf 中并由 ri 引用
+	maxListEntries = 0xFFFF
+	// carvedRootName 为合成的根键名称
+	carvedRootName = "[carved]"
+
+	nkFlagHiveEntry = 0x0004
+	nkFlagCompName  = 0x0020
+)
+
+// CarvedBin 为雕复得到的一个 hbin
+type CarvedBin struct {
+	// Offset 为 hbin 在输入数据中的位置
+	Offset int64
+	// HiveOffset 为 hbin 头部记录的相对第一个 hbin 的偏移
+	HiveOffset uint32
+	Size       uint32
+}
+
+// CarvedRange 为 hive 中相对第一个 hbin 的一段范围 [Start, End)
+type CarvedRange struct {
+	Start uint32
+	End   uint32
+}
+
+// CarvedHive 为从原始数据中恢复的一个 hive 或 hive 片段
+type CarvedHive struct {
+	// Offset 为 base block 在输入中的位置,没有 base block 时为第一个 hbin 的位置
+	Offset int64
+	// BaseBlock 为 false 时 base block 是合成的
+	BaseBlock bool
+	// FileName 为 base block 中记录的文件名(通常为路径的最后 31 个字符)
+	FileName string
+	Bins     []CarvedBin
+	// Missing 为缺失的 hbin 范围,已用只包含一个空闲 cell 的 hbin 填充,指向其中的引用会被忽略
+	Missing []CarvedRange
+	// Shift 为组装时从各 hbin 相对偏移中减去的长度。没有 base block 的片段之前缺失的部分超过 carveSlack 时
+	// 不再填充,而是把片段移到开头,此时片段中的指针都偏离了 Shift,其中的键只能通过 Orphans 访问
+	Shift uint32
+	// SyntheticRoot 为 true 时片段中没有根键,根键为合成的 "[carved]",其子键为 Orphans
+	SyntheticRoot bool
+	// Orphans 为父键不在片段中的键,即缺失 hbin 导致与根键断开的子树
+	Orphans []*RegistryKey
+	// Registry 为重新组装后的 hive,可以像普通 hive 一样访问
+	Registry *Registry
+}
+
+// carveRun 为输入中连续存放且 HiveOffset 连续的若干 hbin
+type carveRun []CarvedBin
+
+func (r carveRun) start() uint32 { return r[0].HiveOffset }
+func (r carveRun) end() uint32 {
+	last := r[len(r)-1]
+	return last.HiveOffset + last.Size
+}
+
+// carveParts 为属于同一个 hive 的 base block 与若干 carveRun,
+// shift 为组装时减去的相对偏移,missing 为组装时需要填充的长度
+type carveParts struct {
+	base       []byte
+	baseOffset int64
+	runs       []carveRun
+	shift      uint32
+	missing    uint32
+}
+
+func (p *carveParts) end() uint32 {
+	return p.runs[len(p.runs)-1].end()
+}
+
+// inPlace 判断 run 是否与 hive 的最后一段在输入中的位移相同,即两者之间的 hbin 在原位损坏,
+// 且填充两者之间的部分后缺失的总长度不超过 carveSlack
+func (p *carveParts) inPlace(run carveRun) bool {
+	last := p.runs[len(p.runs)-1]
+	return run.start() > last.end() && p.missing+(run.start()-last.end()) <= carveSlack &&
+		run[0].Offset-last[0].Offset == int64(run.start())-int64(last.start())
+}
+
+// Carve 在内存中的原始数据(如未分配空间或内存镜像)中雕复 hive,见 CarveReader
+func Carve(data []byte) []*CarvedHive {
+	hives, _ := CarveReader(bytes.NewReader(data), int64(len(data)))
+	return hives
+}
+
+// CarveReader 扫描任意数据中的 "regf" base block 与 "hbin" 签名,按 hbin 头部记录的相对偏移
+// 把连续的 hbin 组装为 hive。输入中不连续但相对偏移首尾相接的片段(如文件碎片)会合并到同一个 hive,
+// 缺失的 hbin 用空的 hbin 填充,没有 base block 时合成一个,因此每个片段都可以通过 Registry 访问
+func CarveReader(r io.ReaderAt, size int64) ([]*CarvedHive, error) {
+	bases, bins, err := carveScan(r, size)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*carveParts, 0)
+	var run carveRun
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		parts = carveAttach(parts, bases, run)
+		run = nil
+	}
+	for _, bin := range bins {
+		if len(run) > 0 {
+			last := run[len(run)-1]
+			if bin.Offset != last.Offset+int64(last.Size) || bin.HiveOffset != last.HiveOffset+last.Size {
+				flush()
+			}
+		}
+		run = append(run, bin)
+	}
+	flush()
+	result := make([]*CarvedHive, 0, len(parts))
+	for _, p := range parts {
+		hive, err := carveAssemble(r, p, size)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, hive)
+	}
+	return result, nil
+}
+
+// carveScan 按扇区扫描签名,返回 base block(按所在位置索引)与按位置排序的 hbin
+func carveScan(r io.ReaderAt, size int64) (map[int64][]byte, []CarvedBin, error) {
+	bases := make(map[int64][]byte)
+	bins := make([]CarvedBin, 0)
+	chunk := make([]byte, carveChunk)
+	header := make([]byte, hbinHeaderLen)
+	next := int64(0)
+	for start := int64(0); start < size; start += carveChunk {
+		n, err := r.ReadAt(chunk, start)
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		for i := 0; i+4 <= n; i += carveStep {
+			pos := start + int64(i)
+			if pos < next {
+				continue
+			}
+			switch string(chunk[i : i+4]) {
+			case "regf":
+				base := make([]byte, baseBlockSize)
+				if m, _ := r.ReadAt(base, pos); m == baseBlockSize && validBaseBlock(base) {
+					bases[pos] = base
+				}
+			case "hbin":
+				if m, _ := r.ReadAt(header, pos); m != hbinHeaderLen {
+					continue
+				}
+				bin := CarvedBin{
+					Offset:     pos,
+					HiveOffset: binary.LittleEndian.Uint32(header[4:]),
+					Size:       binary.LittleEndian.Uint32(header[8:]),
+				}
+				if !validCarvedBin(bin, size) {
+					continue
+				}
+				bins = append(bins, bin)
+				// hbin 之间不会重叠,跳过其中的数据
+				next = pos + int64(bin.Size)
+			}
+		}
+	}
+	return bases, bins, nil
+}
+
+func validBaseBlock(base []byte) bool {
+	major := binary.LittleEndian.Uint32(base[0x14:])
+	length := binary.LittleEndian.Uint32(base[0x28:])
+	return major == 1 && length%hbinAlignment == 0
+}
+
+func validCarvedBin(bin CarvedBin, size int64) bool {
+	return bin.Size >= hbinAlignment && bin.Size%hbinAlignment == 0 &&
+		bin.HiveOffset%hbinAlignment == 0 && uint64(bin.HiveOffset)+uint64(bin.Size) <= maxCarvedHive &&
+		bin.Offset+int64(bin.Size) <= size
+}
+
+// carveAttach 把 run 加入所属的 hive:相对偏移为 0 时开始一个新的 hive,并关联紧邻其前的 base block;
+// 否则接到最近一个结尾与之相接或位移相同的 hive 之后,都不满足时作为一个新的片段。
+// 新片段之前缺失的部分超过 carveSlack 时,组装时把片段移到开头
+func carveAttach(parts []*carveParts, bases map[int64][]byte, run carveRun) []*carveParts {
+	if run.start() != 0 {
+		for i := len(parts) - 1; i >= 0; i-- {
+			if parts[i].end() == run.start() || parts[i].inPlace(run) {
+				parts[i].missing += run.start() - parts[i].end()
+				parts[i].runs = append(parts[i].runs, run)
+				return parts
+			}
+		}
+	}
+	p := &carveParts{baseOffset: run[0].Offset, runs: []carveRun{run}, missing: run.start()}
+	if p.missing > carveSlack {
+		p.shift, p.missing = run.start(), 0
+	}
+	if run.start() == 0 {
+		if base, ok := bases[run[0].Offset-baseBlockSize]; ok {
+			p.base = base
+			p.baseOffset = run[0].Offset - baseBlockSize
+		}
+	}
+	return append(parts, p)
+}
+
+// carveAssemble 按相对偏移把各个 hbin 放回原位,填充缺失部分并确定根键。
+// base block 中声明的大小超出最后一个 hbin 时,连同缺失的 hbin 最多补齐 carveSlack 且不超过输入的大小 size,
+// 因此组装结果的大小不超过已恢复的 hbin 加上 carveSlack
+func carveAssemble(r io.ReaderAt, p *carveParts, size int64) (*CarvedHive, error) {
+	hive := &CarvedHive{Offset: p.baseOffset, BaseBlock: p.base != nil, Shift: p.shift}
+	length := p.end() - p.shift
+	if p.base != nil {
+		slack := uint32(min(carveSlack, size))
+		slack -= min(p.missing, slack)
+		if declared := binary.LittleEndian.Uint32(p.base[0x28:]); declared > length && declared%hbinAlignment == 0 {
+			length = min(declared, length+slack/hbinAlignment*hbinAlignment)
+		}
+		hive.FileName = decodeBaseBlockName(p.base[0x30:0x70])
+	}
+	buf := make([]byte, baseBlockSize+int(length))
+	if p.base != nil {
+		copy(buf, p.base)
+	}
+	covered := uint32(0)
+	for _, run := range p.runs {
+		if start := run.start() - p.shift; start > covered {
+			hive.Missing = append(hive.Missing, CarvedRange{covered, start})
+		}
+		for _, bin := range run {
+			off := baseBlockSize + int(bin.HiveOffset-p.shift)
+			if _, err := r.ReadAt(buf[off:off+int(bin.Size)], bin.Offset); err != nil && err != io.EOF {
+				return nil, err
+			}
+			// 移到开头的片段需要同时修改 hbin 头部记录的相对偏移
+			binary.LittleEndian.PutUint32(buf[off+4:], bin.HiveOffset-p.shift)
+			hive.Bins = append(hive.Bins, bin)
+		}
+		covered = run.end() - p.shift
+	}
+	if length > covered {
+		hive.Missing = append(hive.Missing, CarvedRange{covered, length})
+	}
+	for _, m := range hive.Missing {
+		fillEmptyBin(buf, m.Start, m.End)
+	}
+
+	root, orphans := carveFindKeys(buf, p.shift)
+	if p.base != nil {
+		if off := binary.LittleEndian.Uint32(buf[0x24:]); isAllocatedCell(buf, off, "nk") {
+			root = int64(off)
+		}
+	}
+	if root < 0 {
+		hive.SyntheticRoot = true
+		buf, root = appendCarvedRoot(buf, orphans)
+	}
+	if p.base == nil {
+		writeBaseBlock(buf)
+	}
+	patchBaseBlock(buf, uint32(root))
+	hive.Registry = NewRegistryFromBytes(buf)
+	first := hive.Registry.Regf.Hbins()
+	for _, off := range orphans {
+		nk := NewNKRecord(buf, baseBlockSize+int(off)+4, &first.RegistryBlock)
+		hive.Orphans = append(hive.Orphans, NewRegistryKey(nk))
+	}
+	return hive, nil
+}
+
+func decodeBaseBlockName(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// fillEmptyBin 在 [start, end) 写入一个只包含一个空闲 cell 的 hbin
+func fillEmptyBin(buf []byte, start, end uint32) {
+	b := buf[baseBlockSize+int(start) : baseBlockSize+int(end)]
+	copy(b, "hbin")
+	binary.LittleEndian.PutUint32(b[4:], start)
+	binary.LittleEndian.PutUint32(b[8:], end-start)
+	binary.LittleEndian.PutUint32(b[hbinHeaderLen:], end-start-hbinHeaderLen)
+}
+
+// forEachCell 依次访问所有 hbin 中的 cell,offset 为相对第一个 hbin 的偏移,
+// 遇到无法解析的 hbin 头部时按 4K 跳过,遇到无效的 cell 大小时跳过该 hbin 的剩余部分
+func forEachCell(buf []byte, fn func(offset uint32, size int, allocated bool)) {
+	for pos := baseBlockSize; pos+hbinHeaderLen <= len(buf); {
+		size := int(binary.LittleEndian.Uint32(buf[pos+8:]))
+		if string(buf[pos:pos+4]) != "hbin" || size < hbinAlignment || pos+size > len(buf) {
+			pos += hbinAlignment
+			continue
+		}
+		for cell := pos + hbinHeaderLen; cell+4 <= pos+size; {
+			raw := int32(binary.LittleEndian.Uint32(buf[cell:]))
+			n := int(raw)
+			if n < 0 {
+				n = -n
+			}
+			if n < 8 || n%8 != 0 || cell+n > pos+size {
+				break
+			}
+			fn(uint32(cell-baseBlockSize), n, raw < 0)
+			cell += n
+		}
+		pos += size
+	}
+}
+
+// isAllocatedCell 判断相对偏移 offset 处是否为已分配的、标识为 id 的 cell
+func isAllocatedCell(buf []byte, offset uint32, id string) bool {
+	pos := baseBlockSize + int(offset)
+	if offset == 0xFFFFFFFF || pos+8 > len(buf) {
+		return false
+	}
+	return int32(binary.LittleEndian.Uint32(buf[pos:])) < 0 && string(buf[pos+4:pos+6]) == id
+}
+
+// carveFindKeys 查找带有 KEY_HIVE_ENTRY 标志的根键与父键不是有效 nk 记录的孤立键,找不到根键时返回 -1。
+// shift 为组装时减去的相对偏移,按它换算父键指针;shift 不为 0 时根键中的指针都已失效,也作为孤立键
+func carveFindKeys(buf []byte, shift uint32) (int64, []uint32) {
+	root := int64(-1)
+	orphans := make([]uint32, 0)
+	forEachCell(buf, func(offset uint32, size int, allocated bool) {
+		pos := baseBlockSize + int(offset)
+		if !allocated || size < 0x50 || string(buf[pos+4:pos+6]) != "nk" {
+			return
+		}
+		flags := binary.LittleEndian.Uint16(buf[pos+6:])
+		if flags&nkFlagHiveEntry != 0 && shift == 0 {
+			if root < 0 {
+				root = int64(offset)
+			}
+			return
+		}
+		parent := binary.LittleEndian.Uint32(buf[pos+4+0x10:])
+		if parent == 0xFFFFFFFF || parent < shift || !isAllocatedCell(buf, parent-shift, "nk") {
+			orphans = append(orphans, offset)
+		}
+	})
+	return root, orphans
+}
+
+// appendCarvedRoot 在末尾追加一个 hbin,其中为名为 "[carved]" 的根键及指向各孤立键的 lf 列表,
+// 孤立键超过 maxListEntries 个时分到多个 lf 中,由一个 ri 列表引用
+func appendCarvedRoot(buf []byte, orphans []uint32) ([]byte, int64) {
+	start := uint32(len(buf) - baseBlockSize)
+	lists := make([][]uint32, 0)
+	for rest := orphans; len(rest) > 0; {
+		n := min(len(rest), maxListEntries)
+		lists = append(lists, rest[:n])
+		rest = rest[n:]
+	}
+	nkSize := alignCell(4 + 0x4C + len(carvedRootName))
+	cells := hbinHeaderLen + nkSize
+	for _, list := range lists {
+		cells += alignCell(4 + 4 + 8*len(list))
+	}
+	if len(lists) > 1 {
+		cells += alignCell(4 + 4 + 4*len(lists))
+	}
+	binSize := (cells + hbinAlignment - 1) / hbinAlignment * hbinAlignment
+	buf = append(buf, make([]byte, binSize)...)
+	bin := buf[baseBlockSize+int(start):]
+	copy(bin, "hbin")
+	binary.LittleEndian.PutUint32(bin[4:], start)
+	binary.LittleEndian.PutUint32(bin[8:], uint32(binSize))
+
+	// used 为 hbin 中已写入的长度,alloc 返回新 cell 的相对偏移与数据部分
+	used := hbinHeaderLen
+	alloc := func(size int) (uint32, []byte) {
+		size = alignCell(4 + size)
+		cell := bin[used : used+size]
+		binary.LittleEndian.PutUint32(cell, uint32(int32(-size)))
+		off := start + uint32(used)
+		used += size
+		return off, cell[4:]
+	}
+
+	nkOff, nk := alloc(0x4C + len(carvedRootName))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], nkFlagHiveEntry|nkFlagCompName)
+	binary.LittleEndian.PutUint32(nk[0x10:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(orphans)))
+	binary.LittleEndian.PutUint32(nk[0x1C:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x20:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x28:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x2C:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x30:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(carvedRootName)))
+	copy(nk[0x4C:], carvedRootName)
+
+	lfOffs := make([]uint32, 0, len(lists))
+	for _, list := range lists {
+		lfOff, lf := alloc(4 + 8*len(list))
+		copy(lf, "lf")
+		binary.LittleEndian.PutUint16(lf[2:], uint16(len(list)))
+		for i, off := range list {
+			binary.LittleEndian.PutUint32(lf[4+8*i:], off)
+			// 名称提示为键名的前 4 个字节,Keys 不使用它
+			pos := baseBlockSize + int(off) + 4
+			nameLen := min(int(binary.LittleEndian.Uint16(buf[pos+0x48:])), 4)
+			copy(lf[8+8*i:8+8*i+4], buf[pos+0x4C:pos+0x4C+nameLen])
+		}
+		lfOffs = append(lfOffs, lfOff)
+	}
+	switch len(lfOffs) {
+	case 0:
+	case 1:
+		binary.LittleEndian.PutUint32(nk[0x1C:], lfOffs[0])
+	default:
+		riOff, ri := alloc(4 + 4*len(lfOffs))
+		copy(ri, "ri")
+		binary.LittleEndian.PutUint16(ri[2:], uint16(len(lfOffs)))
+		for i, off := range lfOffs {
+			binary.LittleEndian.PutUint32(ri[4+4*i:], off)
+		}
+		binary.LittleEndian.PutUint32(nk[0x1C:], riOff)
+	}
+	if rest := binSize - used; rest > 0 {
+		binary.LittleEndian.PutUint32(bin[used:], uint32(rest))
+	}
+	return buf, int64(nkOff)
+}
+
+func alignCell(n int) int {
+	return (n + 7) &^ 7
+}
+
+// writeBaseBlock 写入合成的 base block,根键与大小由 patchBaseBlock 填写
+func writeBaseBlock(buf []byte) {
+	base := buf[:baseBlockSize]
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[0x04:], 1)
+	binary.LittleEndian.PutUint32(base[0x08:], 1)
+	binary.LittleEndian.PutUint32(base[0x14:], 1)
+	binary.LittleEndian.PutUint32(base[0x18:], 5)
+	binary.LittleEndian.PutUint32(base[0x20:], 1)
+	binary.LittleEndian.PutUint32(base[0x2C:], 1)
+}
+
+// patchBaseBlock 在根键偏移或 hive 大小与组装结果不符时修改 base block 并重新计算校验和
+func patchBaseBlock(buf []byte, root uint32) {
+	base := buf[:baseBlockSize]
+	length := uint32(len(buf) - baseBlockSize)
+	if binary.LittleEndian.Uint32(base[0x24:]) == root && binary.LittleEndian.Uint32(base[0x28:]) == length &&
+		binary.LittleEndian.Uint32(base[0x1FC:]) != 0 {
+		return
+	}
+	binary.LittleEndian.PutUint32(base[0x24:], root)
+	binary.LittleEndian.PutUint32(base[0x28:], length)
+	binary.LittleEndian.PutUint32(base[0x1FC:], baseBlockChecksum(base))
+}
+
+// baseBlockChecksum 计算 base block 前 508 字节按 DWORD 异或的校验和
+func baseBlockChecksum(base []byte) uint32 {
+	var sum uint32
+	for i := 0; i < 0x1FC; i += 4 {
+		sum ^= binary.LittleEndian.Uint32(base[i:])
+	}
+	switch sum {
+	case 0xFFFFFFFF:
+		return 0xFFFFFFFE
+	case 0:
+		return 1
+	}
+	return sum
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func carveTestHive() []byte {
+	root := &buildKey{name: "ROOT"}
+	for i := 0; i < 3; i++ {
+		k := root.add(fmt.Sprintf("Key%d", i))
+		k.values = append(k.values, buildValue{name: "val", typ: RegSZ, data: encodeUTF16(fmt.Sprint(i), true)})
+	}
+	return buildHive(root, "SOFTWARE")
+}
+
+// orphanBin 生成一个相对偏移为 hiveOffset 的 hbin,其中为 n 个父键不存在的 nk
+func orphanBin(hiveOffset uint32, n int) []byte {
+	bin := make([]byte, hbinHeaderLen)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("k%d", i)
+		size := alignCell(4 + 0x4C + len(name))
+		cell := make([]byte, size)
+		binary.LittleEndian.PutUint32(cell, uint32(int32(-size)))
+		nk := cell[4:]
+		copy(nk, "nk")
+		binary.LittleEndian.PutUint16(nk[2:], nkFlagCompName)
+		binary.LittleEndian.PutUint32(nk[0x10:], 0xFFFFFFFF)
+		binary.LittleEndian.PutUint32(nk[0x1C:], 0xFFFFFFFF)
+		binary.LittleEndian.PutUint32(nk[0x28:], 0xFFFFFFFF)
+		binary.LittleEndian.PutUint32(nk[0x2C:], 0xFFFFFFFF)
+		binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+		copy(nk[0x4C:], name)
+		bin = append(bin, cell...)
+	}
+	size := (len(bin) + 8 + hbinAlignment - 1) / hbinAlignment * hbinAlignment
+	free := make([]byte, size-len(bin))
+	binary.LittleEndian.PutUint32(free, uint32(len(free)))
+	bin = append(bin, free...)
+	copy(bin, "hbin")
+	binary.LittleEndian.PutUint32(bin[4:], hiveOffset)
+	binary.LittleEndian.PutUint32(bin[8:], uint32(size))
+	return bin
+}
+
+func TestCarveEmbeddedHive(t *testing.T) {
+	hive := carveTestHive()
+	data := append(append(bytes.Repeat([]byte{0xAA}, 3*carveStep), hive...), bytes.Repeat([]byte{0x55}, carveStep)...)
+	hives := Carve(data)
+	if len(hives) != 1 {
+		t.Fatalf("Carve 返回 %d 个 hive,应为 1 个", len(hives))
+	}
+	h := hives[0]
+	if h.Offset != 3*carveStep || !h.BaseBlock || h.FileName != "SOFTWARE" || h.SyntheticRoot || len(h.Missing) != 0 {
+		t.Fatalf("结果不符: offset=%#x base=%v name=%q synthetic=%v missing=%v", h.Offset, h.BaseBlock, h.FileName, h.SyntheticRoot, h.Missing)
+	}
+	if !bytes.Equal(h.Registry.Buffers, hive) {
+		t.Fatal("重新组装的 hive 与原始数据不同")
+	}
+	s, err := h.Registry.Open("Key2").GetStringValue("val")
+	if err != nil || s != "2" {
+		t.Fatalf("Key2\\val = %q, %v", s, err)
+	}
+}
+
+func TestCarveDeclaredLengthCapped(t *testing.T) {
+	hive := carveTestHive()
+	// 伪造 base block 中的 hive 大小,组装时不能按它分配内存
+	binary.LittleEndian.PutUint32(hive[0x28:], 0x7FFFF000)
+	binary.LittleEndian.PutUint32(hive[0x1FC:], baseBlockChecksum(hive))
+	hives := Carve(hive)
+	if len(hives) != 1 {
+		t.Fatalf("Carve 返回 %d 个 hive,应为 1 个", len(hives))
+	}
+	if got, limit := len(hives[0].Registry.Buffers), 2*len(hive); got > limit {
+		t.Fatalf("组装后的 hive 为 %d 字节,超过 %d 字节", got, limit)
+	}
+	if hives[0].Registry.Root().SubKey("Key0") == nil {
+		t.Fatal("找不到 Key0")
+	}
+}
+
+func TestCarveLargeHiveOffset(t *testing.T) {
+	// 孤立的 hbin 记录的相对偏移接近上限,组装时不能填充之前缺失的部分
+	const offset = 0x7FFF0000
+	bin := orphanBin(offset, 3)
+	hives := Carve(bin)
+	if len(hives) != 1 {
+		t.Fatalf("Carve 返回 %d 个 hive,应为 1 个", len(hives))
+	}
+	h := hives[0]
+	if got, limit := len(h.Registry.Buffers), baseBlockSize+len(bin)+carveSlack; got > limit {
+		t.Fatalf("组装后的 hive 为 %d 字节,超过 %d 字节", got, limit)
+	}
+	if h.Shift != offset || len(h.Missing) != 0 || !h.SyntheticRoot || len(h.Orphans) != 3 {
+		t.Fatalf("shift=%#x missing=%v synthetic=%v orphans=%d", h.Shift, h.Missing, h.SyntheticRoot, len(h.Orphans))
+	}
+	if len(h.Bins) != 1 || h.Bins[0].HiveOffset != offset {
+		t.Fatalf("Bins = %v", h.Bins)
+	}
+	if name := h.Registry.Root().Subkeys()[2].Name(); name != "k2" {
+		t.Fatalf("最后一个子键为 %q", name)
+	}
+}
+
+func TestCarveOrphans(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		list  string
+	}{
+		{"lf", 3, "lf"},
+		{"ri", maxListEntries + 10, "ri"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 相对偏移为 0 的 hbin 缺失,片段中的键都与根键断开
+			hives := Carve(orphanBin(hbinAlignment, tt.count))
+			if len(hives) != 1 {
+				t.Fatalf("Carve 返回 %d 个 hive,应为 1 个", len(hives))
+			}
+			h := hives[0]
+			if h.BaseBlock || !h.SyntheticRoot || len(h.Orphans) != tt.count {
+				t.Fatalf("base=%v synthetic=%v orphans=%d", h.BaseBlock, h.SyntheticRoot, len(h.Orphans))
+			}
+			if len(h.Missing) != 1 || h.Missing[0] != (CarvedRange{0, hbinAlignment}) {
+				t.Fatalf("Missing = %v", h.Missing)
+			}
+			root := h.Registry.Root()
+			if root.Name() != carvedRootName {
+				t.Fatalf("根键为 %q", root.Name())
+			}
+			if list := string(root.Nkrecord.Subkey_List().UnpackString(0, 2)); list != tt.list {
+				t.Fatalf("子键列表为 %q,应为 %q", list, tt.list)
+			}
+			subkeys := root.Subkeys()
+			if len(subkeys) != tt.count {
+				t.Fatalf("根键有 %d 个子键,应为 %d 个", len(subkeys), tt.count)
+			}
+			if last := fmt.Sprintf("k%d", tt.count-1); subkeys[tt.count-1].Name() != last {
+				t.Fatalf("最后一个子键为 %q,应为 %q", subkeys[tt.count-1].Name(), last)
+			}
+		})
+	}
+}
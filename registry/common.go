@@ -36,6 +36,9 @@ const (
 	RegUnk111             = 0x111
 	RegUnk112             = 0x112
 	RegUnk113             = 0x113
+	RegPoint              = RegUnk111 // Windows.Foundation.Point
+	RegSize               = RegUnk112 // Windows.Foundation.Size
+	RegRect               = RegUnk113 // Windows.Foundation.Rect
 	RegBytesArray         = 0x114
 	RegInt16Array         = 0x115
 	RegUint16Array        = 0x116
@@ -66,24 +69,40 @@ var tt = []int{RegUint8, RegInt16, RegUint16, RegInt32, RegUint32,
 var stringTypes = []int{
 	RegSZ,
 	RegExpandSZ,
-	RegMultiSZ,
+	RegLink,
 	RegUnicodeChar,
 	RegUnicodeString,
 	RegUnicodeCharArray,
+}
+
+// 字符串数组类型切片
+var stringArrayTypes = []int{
+	RegMultiSZ,
 	RegUnicodeStringArray,
 }
 
 // 字节数组类型切片
 var byteArrayTypes = []int{
 	RegBin,
+	RegNone,
 	RegBytesArray,
 }
 
-// 32 位整数类型切片
+// 32 位及以下整数类型切片
 var int32Types = []int{
+	RegUint8,
+	RegInt16,
+	RegUint16,
 	RegInt32,
 	RegUint32,
 	RegDWord,
+	RegBigEndian,
+}
+
+// 32 位及以下整数数组类型切片
+var int32ArrayTypes = []int{
+	RegInt16Array,
+	RegUint16Array,
 	RegInt32Array,
 	RegUInt32Array,
 }
@@ -93,6 +112,28 @@ var int64Types = []int{
 	RegInt64,
 	RegUint64,
 	RegQWord,
+}
+
+// 64 位整数数组类型切片
+var int64ArrayTypes = []int{
 	RegInt64Array,
 	RegUInt64Array,
 }
+
+// 浮点类型切片
+var floatTypes = []int{
+	RegFloat,
+	RegDouble,
+}
+
+// 浮点数组类型切片
+var floatArrayTypes = []int{
+	RegFloatArray,
+	RegDoubleArray,
+}
+
+// 时间类型切片
+var timeTypes = []int{
+	RegFileTime,
+	RegDateTimeOffset,
+}
@@ -0,0 +1,32 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ControlSets 返回 SYSTEM hive 中所有的 ControlSet00N 键
+func (r *Registry) ControlSets() []*RegistryKey {
+	result := make([]*RegistryKey, 0)
+	for _, k := range r.Root().Subkeys() {
+		name := k.Name()
+		if len(name) > len("ControlSet") && strings.EqualFold(name[:len("ControlSet")], "ControlSet") {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// CurrentControlSet 根据 Select\Current 返回系统当前使用的 ControlSet,
+// 没有 Select 键时返回第一个 ControlSet,都不存在时返回 nil
+func (r *Registry) CurrentControlSet() *RegistryKey {
+	if current, err := r.Open("Select").GetInt32Value("Current"); err == nil {
+		if k := r.Open(fmt.Sprintf("ControlSet%03d", current)); k != nil {
+			return k
+		}
+	}
+	if sets := r.ControlSets(); len(sets) > 0 {
+		return sets[0]
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ErrUnknownFormat 表示数据不是可识别的注册表文件格式
+var ErrUnknownFormat = errors.New("无法识别的注册表文件格式")
+
+const (
+	cregHeaderSize = 0x20
+	rgknEntrySize  = 0x1C
+	rgdbHeaderSize = 0x20
+	// rgdbKeyHeaderSize 为 RGDB 中键记录的头部大小,其后为键名与各个值
+	rgdbKeyHeaderSize  = 0x14
+	rgdbValueHeaderLen = 0xC
+	cregNone           = 0xFFFFFFFF
+	// legacyRootName 为原始格式中根键没有名称时使用的名称
+	legacyRootName = "ROOT"
+)
+
+// NewCREGRegistry 读取 Windows 95/98/ME 的 USER.DAT / SYSTEM.DAT(CREG 格式),
+// 转换为 regf 后返回,键与值可以像 NT hive 一样访问。9x 的字符串为 ANSI 编码,
+// 按 Windows-1252 解码后转换为 UTF-16,其他类型的数据保持不变;9x 的键没有最后写入时间。
+// 部分键或值损坏时仍返回可用的 Registry,同时返回合并后的错误
+func NewCREGRegistry(buf []byte) (*Registry, error) {
+	return NewCREGRegistryWithEncoding(buf, charmap.Windows1252)
+}
+
+// NewCREGRegistryWithEncoding 与 NewCREGRegistry 相同,但按系统的 ANSI 代码页 enc 解码字符串,
+// 如简体中文系统使用 simplifiedchinese.GBK,enc 为 nil 时使用 Windows-1252
+func NewCREGRegistryWithEncoding(buf []byte, enc encoding.Encoding) (*Registry, error) {
+	if enc == nil {
+		enc = charmap.Windows1252
+	}
+	root, err := parseCREG(buf, enc)
+	if root == nil {
+		return nil, err
+	}
+	return NewRegistryFromBytes(buildHive(root, "")), err
+}
+
+// decodeANSI 按代码页 enc 解码 ANSI 字符串,无法解码时返回空字符串
+func decodeANSI(enc encoding.Encoding, b []byte) string {
+	decoded, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
+
+func parseCREG(buf []byte, enc encoding.Encoding) (*buildKey, error) {
+	if len(buf) < cregHeaderSize+0x20 || string(buf[:4]) != "CREG" || string(buf[cregHeaderSize:cregHeaderSize+4]) != "RGKN" {
+		return nil, fmt.Errorf("%w: 缺少 CREG/RGKN 签名", ErrUnknownFormat)
+	}
+	rgkn := buf[cregHeaderSize:]
+	if size := int(binary.LittleEndian.Uint32(rgkn[4:])); size < len(rgkn) {
+		rgkn = rgkn[:size]
+	}
+	records, errs := parseRGDB(buf)
+
+	var build func(offset uint32, parent *buildKey) *buildKey
+	visited := make(map[uint32]bool)
+	// 兄弟键按 next 链表迭代访问,子键递归访问
+	build = func(offset uint32, parent *buildKey) *buildKey {
+		var first *buildKey
+		for ; offset != cregNone; offset = binary.LittleEndian.Uint32(rgkn[offset+0x14:]) {
+			if uint64(offset)+rgknEntrySize > uint64(len(rgkn)) {
+				errs = append(errs, fmt.Errorf("%w: RGKN 键偏移 %#x 超出范围", ErrCorrupt, offset))
+				break
+			}
+			if visited[offset] {
+				errs = append(errs, fmt.Errorf("%w: RGKN 键偏移 %#x 重复出现", ErrCorrupt, offset))
+				break
+			}
+			visited[offset] = true
+			entry := rgkn[offset : offset+rgknEntrySize]
+			id := uint32(binary.LittleEndian.Uint16(entry[0x1A:]))<<16 | uint32(binary.LittleEndian.Uint16(entry[0x18:]))
+			key := &buildKey{}
+			if record, ok := records[id]; ok {
+				if err := parseRGDBKey(record, key, enc); err != nil {
+					errs = append(errs, fmt.Errorf("RGKN 键偏移 %#x: %w", offset, err))
+				}
+			} else if parent != nil {
+				key.name = fmt.Sprintf("[%#x]", offset)
+				errs = append(errs, fmt.Errorf("%w: RGKN 键偏移 %#x 的数据记录不存在", ErrCorrupt, offset))
+			}
+			if parent != nil {
+				parent.subkeys = append(parent.subkeys, key)
+			}
+			if first == nil {
+				first = key
+			}
+			if child := binary.LittleEndian.Uint32(entry[0x10:]); child != cregNone {
+				build(child, key)
+			}
+			if parent == nil {
+				// 根键没有兄弟键
+				break
+			}
+		}
+		return first
+	}
+	root := build(binary.LittleEndian.Uint32(rgkn[8:]), nil)
+	if root == nil {
+		return nil, errors.Join(append(errs, fmt.Errorf("%w: 找不到根键", ErrCorrupt))...)
+	}
+	if root.name == "" {
+		root.name = legacyRootName
+	}
+	return root, errors.Join(errs...)
+}
+
+// parseRGDB 读取所有 RGDB 块中的键记录,键为块号与键号的组合
+func parseRGDB(buf []byte) (map[uint32][]byte, []error) {
+	var errs []error
+	records := make(map[uint32][]byte)
+	pos := int(binary.LittleEndian.Uint32(buf[8:]))
+	blocks := int(binary.LittleEndian.Uint16(buf[0x10:]))
+	for i := 0; i < blocks; i++ {
+		if pos < 0 || pos+rgdbHeaderSize > len(buf) || string(buf[pos:pos+4]) != "RGDB" {
+			errs = append(errs, fmt.Errorf("%w: 第 %d 个 RGDB 块的位置 %#x 无效", ErrCorrupt, i, pos))
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(buf[pos+4:]))
+		if size < rgdbHeaderSize || pos+size > len(buf) {
+			errs = append(errs, fmt.Errorf("%w: 第 %d 个 RGDB 块的大小 %#x 无效", ErrCorrupt, i, size))
+			size = len(buf) - pos
+		}
+		block := buf[pos : pos+size]
+		for off := rgdbHeaderSize; off+rgdbKeyHeaderSize <= len(block); {
+			next := int(binary.LittleEndian.Uint32(block[off:]))
+			if next < rgdbKeyHeaderSize || off+next > len(block) {
+				break
+			}
+			record := block[off : off+next]
+			if used := int(binary.LittleEndian.Uint32(record[8:])); used >= rgdbKeyHeaderSize && used < next {
+				record = record[:used]
+			}
+			id := uint32(binary.LittleEndian.Uint16(record[6:]))<<16 | uint32(binary.LittleEndian.Uint16(record[4:]))
+			if binary.LittleEndian.Uint16(record[4:]) != 0xFFFF {
+				records[id] = record
+			}
+			off += next
+		}
+		pos += size
+	}
+	return records, errs
+}
+
+// parseRGDBKey 解析 RGDB 中的一个键记录:键名与其后的各个值
+func parseRGDBKey(record []byte, key *buildKey, enc encoding.Encoding) error {
+	nameLength := int(binary.LittleEndian.Uint16(record[0xC:]))
+	count := int(binary.LittleEndian.Uint16(record[0xE:]))
+	if rgdbKeyHeaderSize+nameLength > len(record) {
+		return fmt.Errorf("%w: 键名长度 %d 超出记录范围", ErrCorrupt, nameLength)
+	}
+	key.name = decodeANSI(enc, record[rgdbKeyHeaderSize:rgdbKeyHeaderSize+nameLength])
+	off := rgdbKeyHeaderSize + nameLength
+	for i := 0; i < count; i++ {
+		if off+rgdbValueHeaderLen > len(record) {
+			return fmt.Errorf("%w: 键 %s 的第 %d 个值超出记录范围", ErrCorrupt, key.name, i)
+		}
+		typ := binary.LittleEndian.Uint32(record[off:])
+		nameLength := int(binary.LittleEndian.Uint16(record[off+8:]))
+		dataLength := int(binary.LittleEndian.Uint16(record[off+0xA:]))
+		start := off + rgdbValueHeaderLen
+		if start+nameLength+dataLength > len(record) {
+			return fmt.Errorf("%w: 键 %s 的第 %d 个值超出记录范围", ErrCorrupt, key.name, i)
+		}
+		key.values = append(key.values, buildValue{
+			name: decodeANSI(enc, record[start:start+nameLength]),
+			typ:  typ,
+			data: convertANSIData(typ, record[start+nameLength:start+nameLength+dataLength], enc),
+		})
+		off = start + nameLength + dataLength
+	}
+	return nil
+}
+
+// convertANSIData 把按代码页 enc 编码的字符串数据转换为 NT 使用的 UTF-16LE,其他类型原样返回
+func convertANSIData(typ uint32, data []byte, enc encoding.Encoding) []byte {
+	switch int(typ) {
+	case RegSZ, RegExpandSZ:
+		return encodeUTF16(decodeANSI(enc, bytes.TrimRight(data, "\x00")), true)
+	case RegMultiSZ:
+		if len(data) == 0 {
+			return data
+		}
+		var out []byte
+		for _, s := range strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00") {
+			out = append(out, encodeUTF16(decodeANSI(enc, []byte(s)), true)...)
+		}
+		return append(out, 0, 0)
+	}
+	return data
+}
@@ -0,0 +1,195 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// cregKey 为生成 CREG 测试数据时的一个键,名称与字符串数据为 ANSI 编码
+type cregKey struct {
+	name    string
+	values  []buildValue
+	subkeys []*cregKey
+}
+
+// cregFile 为生成的 CREG 文件及各键在 RGKN 中的偏移(按路径索引,根键为空字符串)
+type cregFile struct {
+	buf     []byte
+	offsets map[string]uint32
+}
+
+// buildCREG 生成只有一个 RGDB 块的 CREG 文件,RGKN 中的键按深度优先的顺序排列
+func buildCREG(root *cregKey) *cregFile {
+	f := &cregFile{offsets: make(map[string]uint32)}
+	rgkn := make([]byte, 0x20)
+	rgdb := make([]byte, rgdbHeaderSize)
+	var add func(k *cregKey, path string) uint32
+	add = func(k *cregKey, path string) uint32 {
+		offset := uint32(len(rgkn))
+		f.offsets[path] = offset
+		entry := make([]byte, rgknEntrySize)
+		id := uint16(len(f.offsets) - 1)
+		binary.LittleEndian.PutUint32(entry[0x10:], cregNone)
+		binary.LittleEndian.PutUint32(entry[0x14:], cregNone)
+		binary.LittleEndian.PutUint16(entry[0x18:], id)
+		rgkn = append(rgkn, entry...)
+
+		record := make([]byte, rgdbKeyHeaderSize, 0x100)
+		binary.LittleEndian.PutUint16(record[4:], id)
+		binary.LittleEndian.PutUint16(record[0xC:], uint16(len(k.name)))
+		binary.LittleEndian.PutUint16(record[0xE:], uint16(len(k.values)))
+		record = append(record, k.name...)
+		for _, v := range k.values {
+			header := make([]byte, rgdbValueHeaderLen)
+			binary.LittleEndian.PutUint32(header, v.typ)
+			binary.LittleEndian.PutUint16(header[8:], uint16(len(v.name)))
+			binary.LittleEndian.PutUint16(header[0xA:], uint16(len(v.data)))
+			record = append(append(append(record, header...), v.name...), v.data...)
+		}
+		binary.LittleEndian.PutUint32(record[0:], uint32(len(record)))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(record)))
+		rgdb = append(rgdb, record...)
+
+		prev := uint32(cregNone)
+		for _, sub := range k.subkeys {
+			child := add(sub, strings.TrimPrefix(path+`\`+sub.name, `\`))
+			if prev == cregNone {
+				binary.LittleEndian.PutUint32(rgkn[offset+0x10:], child)
+			} else {
+				binary.LittleEndian.PutUint32(rgkn[prev+0x14:], child)
+			}
+			prev = child
+		}
+		return offset
+	}
+	rootOffset := add(root, "")
+	binary.LittleEndian.PutUint32(rgkn[8:], rootOffset)
+	copy(rgkn, "RGKN")
+	binary.LittleEndian.PutUint32(rgkn[4:], uint32(len(rgkn)))
+	copy(rgdb, "RGDB")
+	binary.LittleEndian.PutUint32(rgdb[4:], uint32(len(rgdb)))
+
+	header := make([]byte, cregHeaderSize)
+	copy(header, "CREG")
+	binary.LittleEndian.PutUint32(header[8:], uint32(cregHeaderSize+len(rgkn)))
+	binary.LittleEndian.PutUint16(header[0x10:], 1)
+	f.buf = slices.Concat(header, rgkn, rgdb)
+	return f
+}
+
+// rgkn 返回 RGKN 中 path 处键的 entry
+func (f *cregFile) rgkn(path string) []byte {
+	return f.buf[cregHeaderSize+f.offsets[path]:]
+}
+
+func cregTestFile() *cregFile {
+	return buildCREG(&cregKey{subkeys: []*cregKey{
+		{name: "Software", subkeys: []*cregKey{
+			{name: "Microsoft", subkeys: []*cregKey{
+				{name: "Windows", values: []buildValue{
+					{name: "SystemRoot", typ: RegSZ, data: []byte("C:\\WINDOWS\x00")},
+					{name: "Build", typ: RegDWord, data: []byte{0xFE, 0x08, 0, 0}},
+					{name: "Blob", typ: RegBin, data: []byte{1, 2, 3}},
+					{name: "Paths", typ: RegMultiSZ, data: []byte("A:\\\x00B:\\\x00\x00")},
+				}},
+			}},
+			{name: "Caf\xe9", values: []buildValue{{typ: RegSZ, data: []byte("d\xe9faut")}}},
+		}},
+		{name: "Control Panel"},
+		{name: "\xd6\xd0\xce\xc4"},
+	}})
+}
+
+func TestCREG(t *testing.T) {
+	reg, err := NewCREGRegistry(cregTestFile().buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := reg.Root()
+	if root.Name() != legacyRootName {
+		t.Fatalf("根键为 %q", root.Name())
+	}
+	if got := subkeyNames(root); !slices.Equal(got, []string{"Control Panel", "Software", "ÖÐÎÄ"}) {
+		t.Fatalf("根键的子键为 %v", got)
+	}
+	if got := subkeyNames(reg.Open("Software")); !slices.Equal(got, []string{"Café", "Microsoft"}) {
+		t.Fatalf("Software 的子键为 %v", got)
+	}
+	windows := reg.Open(`Software\Microsoft\Windows`)
+	if s, err := windows.GetStringValue("SystemRoot"); err != nil || s != `C:\WINDOWS` {
+		t.Errorf("SystemRoot = %q, %v", s, err)
+	}
+	if n, err := windows.GetInt32Value("Build"); err != nil || n != 2302 {
+		t.Errorf("Build = %d, %v", n, err)
+	}
+	if b, err := windows.GetBinaryValue("Blob"); err != nil || !slices.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("Blob = %v, %v", b, err)
+	}
+	if ss, err := windows.GetStrings("Paths"); err != nil || !slices.Equal(ss, []string{`A:\`, `B:\`}) {
+		t.Errorf("Paths = %q, %v", ss, err)
+	}
+	if s, err := reg.Open(`Software\Café`).GetStringValue("(default)"); err != nil || s != "défaut" {
+		t.Errorf("默认值 = %q, %v", s, err)
+	}
+	if auto := NewRegistryFromBytes(cregTestFile().buf); auto.Open(`Software\Microsoft\Windows`) == nil {
+		t.Error("NewRegistryFromBytes 没有识别 CREG 格式")
+	}
+}
+
+func TestCREGEncoding(t *testing.T) {
+	reg, err := NewCREGRegistryWithEncoding(cregTestFile().buf, simplifiedchinese.GBK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Open("中文") == nil {
+		t.Fatalf("按 GBK 解码后找不到键,子键为 %v", subkeyNames(reg.Root()))
+	}
+}
+
+func TestCREGCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(f *cregFile)
+		message string
+		// keep 为损坏后仍然可以访问的键
+		keep string
+	}{
+		{"next offset", func(f *cregFile) {
+			binary.LittleEndian.PutUint32(f.rgkn("Software")[0x14:], 0x7FFFFFF0)
+		}, "超出范围", `Software\Microsoft\Windows`},
+		{"child offset", func(f *cregFile) {
+			binary.LittleEndian.PutUint32(f.rgkn(`Software\Microsoft`)[0x10:], uint32(len(f.buf)))
+		}, "超出范围", `Software\Café`},
+		{"sibling cycle", func(f *cregFile) {
+			binary.LittleEndian.PutUint32(f.rgkn("Control Panel")[0x14:], f.offsets["Software"])
+		}, "重复出现", `Software\Microsoft\Windows`},
+		{"child cycle", func(f *cregFile) {
+			binary.LittleEndian.PutUint32(f.rgkn(`Software\Microsoft\Windows`)[0x10:], f.offsets["Software"])
+		}, "重复出现", "Control Panel"},
+		{"missing record", func(f *cregFile) {
+			binary.LittleEndian.PutUint16(f.rgkn("Control Panel")[0x18:], 0x100)
+		}, "数据记录不存在", `Software\Microsoft\Windows`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := cregTestFile()
+			tt.corrupt(f)
+			reg, err := NewCREGRegistry(f.buf)
+			if !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("返回 %v,应为包含 %q 的 ErrCorrupt", err, tt.message)
+			}
+			if reg == nil || reg.Open(tt.keep) == nil {
+				t.Fatalf("损坏后找不到 %s", tt.keep)
+			}
+		})
+	}
+
+	if _, err := NewCREGRegistry([]byte("CREG")); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("过短的数据返回 %v", err)
+	}
+}
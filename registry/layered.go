@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LayerSemantics 为 Windows 10 分层 hive(应用容器、Windows 沙盒使用的差分 hive)中键的语义,
+// 决定合成视图时下层 hive 中同一路径的键与值是否可见
+type LayerSemantics int
+
+const (
+	// LayerMerge 为普通的键,值与子键与下层合并,同名的值以上层为准
+	LayerMerge LayerSemantics = iota
+	// LayerTombstone 为删除标记,该键及其子树在合成视图中不存在
+	LayerTombstone
+	// LayerSupersedeLocal 表示只取本层的值,子键仍与下层合并
+	LayerSupersedeLocal
+	// LayerSupersedeTree 表示该键及其整个子树都只取本层,下层的同名键被完全替换
+	LayerSupersedeTree
+)
+
+// vkFlagTombstone 为 vk 的标志位,表示该值为删除标记
+const vkFlagTombstone = 0x0002
+
+func (s LayerSemantics) String() string {
+	switch s {
+	case LayerMerge:
+		return "Merge"
+	case LayerTombstone:
+		return "Tombstone"
+	case LayerSupersedeLocal:
+		return "SupersedeLocal"
+	case LayerSupersedeTree:
+		return "SupersedeTree"
+	}
+	return fmt.Sprintf("LayerSemantics(%d)", int(s))
+}
+
+// LayerSemantics 返回键的分层语义,非分层 hive 中的键均为 LayerMerge
+func (r *RegistryKey) LayerSemantics() LayerSemantics {
+	return LayerSemantics(r.Nkrecord.Layer_semantics())
+}
+
+// InheritClass 表示分层键的类名继承自下层 hive
+func (r *RegistryKey) InheritClass() bool {
+	return r.Nkrecord.Inherit_class()
+}
+
+// IsTombstone 表示该值为分层 hive 中的删除标记
+func (r *RegistryValue) IsTombstone() bool {
+	return r.Vkrecord.Is_tombstone()
+}
+
+// NewLayeredRegistry 把 layers 按从下到上的顺序叠加,第一个为基础 hive,之后为各层差分 hive,
+// 返回合成后的视图。同一路径的键从上往下合并,遇到删除标记或 LayerSupersedeTree 时不再取更下层的内容;
+// 同名的值以上层为准,值的删除标记会隐藏下层的同名值,LayerSupersedeLocal 与 LayerSupersedeTree
+// 的键不继承下层的值。键的最后写入时间取最上层,合成视图中不再包含删除标记,也不保留类名。
+// 根键同样遵循这些语义,最上层的根键为删除标记时返回 ErrNotFound
+func NewLayeredRegistry(layers ...*Registry) (*Registry, error) {
+	roots := make([]layerKey, 0, len(layers))
+	for i, r := range layers {
+		if root := r.Root(); root != nil && root.Nkrecord != nil {
+			roots = append(roots, layerKey{layer: i, key: root})
+		}
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("%w: 没有可叠加的 hive", ErrNotFound)
+	}
+	m := &layerMerger{visiting: make(map[layerOffset]bool)}
+	root := m.merge(roots)
+	if root == nil {
+		return nil, fmt.Errorf("%w: 根键被删除标记隐藏", ErrNotFound)
+	}
+	return NewRegistryFromBytes(buildHive(root, "")), nil
+}
+
+// layerKey 为某一层中位于同一路径的键
+type layerKey struct {
+	layer int
+	key   *RegistryKey
+}
+
+type layerOffset struct {
+	layer  int
+	offset int
+}
+
+type layerMerger struct {
+	// visiting 记录当前路径上已经访问的键,防止损坏的 hive 中子键列表构成环
+	visiting map[layerOffset]bool
+}
+
+// merge 合并同一路径在各层中的键,keys 按从下到上排列,键被删除标记隐藏时返回 nil
+func (m *layerMerger) merge(keys []layerKey) *buildKey {
+	// 从最上层往下找出可见的各层
+	visible := make([]layerKey, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		semantics := keys[i].key.LayerSemantics()
+		if semantics == LayerTombstone {
+			break
+		}
+		visible = append([]layerKey{keys[i]}, visible...)
+		if semantics == LayerSupersedeTree {
+			break
+		}
+	}
+	if len(visible) == 0 {
+		return nil
+	}
+	for _, k := range visible {
+		id := layerOffset{k.layer, k.key.Nkrecord.Offset}
+		if m.visiting[id] {
+			return nil
+		}
+		m.visiting[id] = true
+		defer delete(m.visiting, id)
+	}
+
+	top := visible[len(visible)-1].key
+	result := &buildKey{name: top.Name(), timestamp: top.Timestamp()}
+
+	// 值从下往上覆盖
+	index := make(map[string]int)
+	for _, k := range visible {
+		if s := k.key.LayerSemantics(); s == LayerSupersedeLocal || s == LayerSupersedeTree {
+			result.values = result.values[:0]
+			clear(index)
+		}
+		for _, v := range k.key.Values() {
+			name := ""
+			if v.Vkrecord.Has_name() {
+				name = v.Vkrecord.Name()
+			}
+			upper := strings.ToUpper(name)
+			i, exists := index[upper]
+			if v.IsTombstone() {
+				if exists {
+					result.values = append(result.values[:i], result.values[i+1:]...)
+					delete(index, upper)
+					for n, j := range index {
+						if j > i {
+							index[n] = j - 1
+						}
+					}
+				}
+				continue
+			}
+			value := buildValue{name: name, typ: v.Value_type_raw(), data: rawValueData(v)}
+			if exists {
+				result.values[i] = value
+			} else {
+				index[upper] = len(result.values)
+				result.values = append(result.values, value)
+			}
+		}
+	}
+
+	// 子键按名称分组后递归合并,顺序为各名称第一次出现的顺序
+	names := make([]string, 0)
+	children := make(map[string][]layerKey)
+	for _, k := range visible {
+		for _, sub := range k.key.Subkeys() {
+			upper := strings.ToUpper(sub.Name())
+			if _, ok := children[upper]; !ok {
+				names = append(names, upper)
+			}
+			children[upper] = append(children[upper], layerKey{layer: k.layer, key: sub})
+		}
+	}
+	for _, name := range names {
+		if sub := m.merge(children[name]); sub != nil {
+			result.subkeys = append(result.subkeys, sub)
+		}
+	}
+	return result
+}
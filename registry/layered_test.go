@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func stringValue(name, s string) buildValue {
+	return buildValue{name: name, typ: RegSZ, data: encodeUTF16(s, true)}
+}
+
+// setLayer 修改 path 处键的分层语义,path 为空时为根键
+func setLayer(r *Registry, path string, s LayerSemantics) {
+	k := r.Root()
+	if path != "" {
+		k = r.Open(path)
+	}
+	r.Buffers[k.Nkrecord.Offset+0xD] = byte(s)
+}
+
+// setTombstone 把 path 处键中名为 name 的值标记为删除
+func setTombstone(r *Registry, path, name string) {
+	v := r.Open(path).Value(name)
+	r.Buffers[v.Vkrecord.Offset+0x10] |= vkFlagTombstone
+}
+
+// layeredTestHives 返回从下到上的三层 hive
+func layeredTestHives() []*Registry {
+	base := &buildKey{name: "ROOT"}
+	sw := base.add("Software")
+	app := sw.add("App")
+	app.values = []buildValue{stringValue("a", "base-a"), stringValue("b", "base-b"), stringValue("c", "base-c")}
+	app.add("Settings").values = []buildValue{stringValue("x", "1")}
+	sw.add("Old").add("Sub")
+	local := sw.add("Local")
+	local.values = []buildValue{stringValue("l", "base")}
+	local.add("Child")
+	tree := sw.add("Tree")
+	tree.values = []buildValue{stringValue("t", "base"), stringValue("lower", "base")}
+	tree.add("Lower")
+	base.add("Keep")
+
+	middle := &buildKey{name: "ROOT"}
+	sw = middle.add("Software")
+	app = sw.add("App")
+	app.values = []buildValue{stringValue("b", "middle-b"), stringValue("c", "")}
+	sw.add("Old")
+	sw.add("Local").values = []buildValue{stringValue("u", "middle")}
+	tree = sw.add("Tree")
+	tree.values = []buildValue{stringValue("t", "middle")}
+	tree.add("Upper")
+
+	top := &buildKey{name: "ROOT"}
+	sw = top.add("Software")
+	sw.add("App").values = []buildValue{stringValue("a", "")}
+	sw.add("Old").values = []buildValue{stringValue("o", "top")}
+
+	layers := []*Registry{
+		NewRegistryFromBytes(buildHive(base, "BASE")),
+		NewRegistryFromBytes(buildHive(middle, "MIDDLE")),
+		NewRegistryFromBytes(buildHive(top, "TOP")),
+	}
+	setTombstone(layers[1], `Software\App`, "c")
+	setLayer(layers[1], `Software\Old`, LayerTombstone)
+	setLayer(layers[1], `Software\Local`, LayerSupersedeLocal)
+	setLayer(layers[1], `Software\Tree`, LayerSupersedeTree)
+	setTombstone(layers[2], `Software\App`, "a")
+	return layers
+}
+
+// subkeyNames 返回排序后的子键名,合成的 hive 中子键按名称排序
+func subkeyNames(k *RegistryKey) []string {
+	names := make([]string, 0)
+	for _, sub := range k.Subkeys() {
+		names = append(names, sub.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func valueNames(k *RegistryKey) []string {
+	names := make([]string, 0)
+	for _, v := range k.Values() {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+func TestLayerSemantics(t *testing.T) {
+	layers := layeredTestHives()
+	tests := []struct {
+		path string
+		want LayerSemantics
+	}{
+		{`Software\App`, LayerMerge},
+		{`Software\Old`, LayerTombstone},
+		{`Software\Local`, LayerSupersedeLocal},
+		{`Software\Tree`, LayerSupersedeTree},
+	}
+	for _, tt := range tests {
+		if got := layers[1].Open(tt.path).LayerSemantics(); got != tt.want {
+			t.Errorf("%s 的分层语义为 %v,应为 %v", tt.path, got, tt.want)
+		}
+	}
+	if !layers[1].Open(`Software\App`).Value("c").IsTombstone() || layers[1].Open(`Software\App`).Value("b").IsTombstone() {
+		t.Error("值的删除标记解析错误")
+	}
+}
+
+func TestLayeredRegistry(t *testing.T) {
+	layers := layeredTestHives()
+	tests := []struct {
+		name    string
+		layers  []*Registry
+		path    string
+		values  []string
+		subkeys []string
+	}{
+		{"base only", layers[:1], `Software`, nil, []string{"App", "Local", "Old", "Tree"}},
+		{"tombstone key", layers[:2], `Software`, nil, []string{"App", "Local", "Tree"}},
+		{"value tombstone", layers[:2], `Software\App`, []string{"a", "b"}, []string{"Settings"}},
+		{"supersede local", layers[:2], `Software\Local`, []string{"u"}, []string{"Child"}},
+		{"supersede tree", layers[:2], `Software\Tree`, []string{"t"}, []string{"Upper"}},
+		{"above tombstone", layers, `Software\Old`, []string{"o"}, []string{}},
+		{"top value tombstone", layers, `Software\App`, []string{"b"}, []string{"Settings"}},
+		{"root", layers, ``, nil, []string{"Keep", "Software"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := NewLayeredRegistry(tt.layers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := merged.Root()
+			if tt.path != "" {
+				k = merged.Open(tt.path)
+			}
+			if k == nil {
+				t.Fatalf("找不到 %s", tt.path)
+			}
+			if got := subkeyNames(k); !slices.Equal(got, tt.subkeys) {
+				t.Fatalf("子键为 %v,应为 %v", got, tt.subkeys)
+			}
+			if got := valueNames(k); tt.values != nil && !slices.Equal(got, tt.values) {
+				t.Fatalf("值为 %v,应为 %v", got, tt.values)
+			}
+		})
+	}
+
+	merged, err := NewLayeredRegistry(layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{`Software\App\b`: "middle-b", `Software\Tree\t`: "middle", `Software\Old\o`: "top"} {
+		dir, name := path[:len(path)-2], path[len(path)-1:]
+		if got, err := merged.Open(dir).GetStringValue(name); err != nil || got != want {
+			t.Errorf("%s = %q, %v,应为 %q", path, got, err, want)
+		}
+	}
+	if merged.Open(`Software\Old\Sub`) != nil || merged.Open(`Software\Tree\Lower`) != nil {
+		t.Error("删除标记或 SupersedeTree 之下的子键仍然可见")
+	}
+	if merged.Open(`Software\App\Settings`).Value("x") == nil {
+		t.Error("合并后缺少下层的子键的值")
+	}
+}
+
+func TestLayeredRegistryTombstonedRoot(t *testing.T) {
+	layers := layeredTestHives()
+	setLayer(layers[2], "", LayerTombstone)
+	if _, err := NewLayeredRegistry(layers...); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("返回 %v,应为 ErrNotFound", err)
+	}
+
+	// 中间层的根键为删除标记时隐藏该层及以下各层,只保留最上层
+	layers = layeredTestHives()
+	setLayer(layers[1], "", LayerTombstone)
+	merged, err := NewLayeredRegistry(layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subkeyNames(merged.Root()); !slices.Equal(got, []string{"Software"}) {
+		t.Fatalf("根键的子键为 %v", got)
+	}
+	if got := subkeyNames(merged.Open("Software")); !slices.Equal(got, []string{"App", "Old"}) {
+		t.Fatalf("Software 的子键为 %v", got)
+	}
+	if _, err := NewLayeredRegistry(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("没有 hive 时返回 %v", err)
+	}
+}
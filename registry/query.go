@@ -0,0 +1,382 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrQuerySyntax 查询表达式语法错误
+var ErrQuerySyntax = errors.New("查询表达式语法错误")
+
+// Match 为查询的一个结果,查询带有值选择器时 Value 为匹配的值,否则为 nil
+type Match struct {
+	// Hive 为 MatchHives 中 hive 的挂载路径,单个 hive 查询时为空
+	Hive string
+	// Path 为键相对于查询起点的路径,带有挂载路径时以其开头
+	Path  string
+	Key   *RegistryKey
+	Value *RegistryValue
+}
+
+// querySegment 为查询中以反斜杠分隔的一段
+type querySegment struct {
+	// pattern 为转换为小写的匹配模式
+	pattern   string
+	literal   bool
+	recursive bool
+}
+
+func (s *querySegment) match(name string) bool {
+	if s.recursive {
+		return true
+	}
+	name = strings.ToLower(name)
+	if s.literal {
+		return s.pattern == name
+	}
+	return globMatch(s.pattern, name)
+}
+
+// Query 为编译后的路径查询,可以在多个键或 hive 上重复使用
+type Query struct {
+	segments []querySegment
+	// value 为值选择器,没有 @ 时为 nil
+	value *querySegment
+}
+
+// CompileQuery 编译路径查询表达式。路径以反斜杠分隔,每段不区分大小写,支持:
+//
+//	语法     含义
+//	*        匹配任意个字符
+//	?        匹配一个字符
+//	[abc]    匹配括号中的一个字符,支持 a-z 形式的范围,[!abc] 或 [^abc] 表示取反
+//	**       单独作为一段时匹配零个或多个键
+//	@name    值选择器,匹配键下名称符合模式的值,@ 或 @(default) 为默认值
+//
+// 字符类之外的第一个 @ 之后的内容都属于值选择器(值名可以包含反斜杠),键名中的 @ 需要写作 [@]。
+// 如 HKU\*\Software\Microsoft\Windows\CurrentVersion\Run\* 或 ControlSet001\Services\*@ImagePath
+func CompileQuery(expr string) (*Query, error) {
+	q := &Query{}
+	path, value, hasValue := cutValue(expr)
+	for _, part := range strings.Split(path, "\\") {
+		if part == "" {
+			continue
+		}
+		seg, err := compileSegment(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, expr)
+		}
+		// 连续的 ** 与单个 ** 等价
+		if seg.recursive && len(q.segments) > 0 && q.segments[len(q.segments)-1].recursive {
+			continue
+		}
+		q.segments = append(q.segments, seg)
+	}
+	if hasValue {
+		if value == "(default)" {
+			value = ""
+		}
+		seg, err := compileSegment(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, expr)
+		}
+		seg.recursive = false
+		q.value = &seg
+	}
+	return q, nil
+}
+
+// cutValue 在字符类之外的第一个 @ 处把表达式分为路径与值选择器,[@] 中的 @ 属于键名
+func cutValue(expr string) (path, value string, found bool) {
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '[':
+			if end := classEnd(expr, i); end >= 0 {
+				i = end
+			}
+		case '@':
+			return expr[:i], expr[i+1:], true
+		}
+	}
+	return expr, "", false
+}
+
+func compileSegment(part string) (querySegment, error) {
+	if part == "**" {
+		return querySegment{pattern: part, recursive: true}, nil
+	}
+	if !strings.ContainsAny(part, "*?[") {
+		return querySegment{pattern: strings.ToLower(part), literal: true}, nil
+	}
+	pattern := strings.ToLower(part)
+	// 提前检查字符类是否闭合,匹配时就不需要再处理语法错误
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '[' {
+			continue
+		}
+		end := classEnd(pattern, i)
+		if end < 0 {
+			return querySegment{}, fmt.Errorf("%w: 字符类 %q 未闭合", ErrQuerySyntax, pattern[i:])
+		}
+		i = end
+	}
+	return querySegment{pattern: pattern}, nil
+}
+
+// classEnd 返回从 start 处的 [ 开始的字符类的结束 ] 的位置,未闭合时返回 -1。
+// 紧跟在 [、[! 或 [^ 之后的 ] 作为普通字符
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchClass 判断 r 是否属于字符类 class(不含两端的括号)
+func matchClass(class string, r rune) bool {
+	negate := false
+	if class != "" && (class[0] == '!' || class[0] == '^') {
+		negate = true
+		class = class[1:]
+	}
+	matched := false
+	for class != "" {
+		lo, size := utf8.DecodeRuneInString(class)
+		class = class[size:]
+		hi := lo
+		if len(class) > 1 && class[0] == '-' {
+			hi, size = utf8.DecodeRuneInString(class[1:])
+			class = class[1+size:]
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return matched != negate
+}
+
+// globMatch 用 *、? 与字符类匹配整个名称,遇到 * 时记录回溯位置
+func globMatch(pattern, name string) bool {
+	p, n := 0, 0
+	starP, starN := -1, 0
+	for n < len(name) {
+		r, size := utf8.DecodeRuneInString(name[n:])
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starN = p, n
+				p++
+				continue
+			case '?':
+				p++
+				n += size
+				continue
+			case '[':
+				end := classEnd(pattern, p)
+				if matchClass(pattern[p+1:end], r) {
+					p = end + 1
+					n += size
+					continue
+				}
+			default:
+				pr, psize := utf8.DecodeRuneInString(pattern[p:])
+				if pr == r {
+					p += psize
+					n += size
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// 让上一个 * 多匹配一个字符后重试
+		_, size = utf8.DecodeRuneInString(name[starN:])
+		starN += size
+		p, n = starP+1, starN
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// closure 返回状态集合加上跳过 ** 后可以到达的状态
+func (q *Query) closure(states []int) []int {
+	seen := make(map[int]bool)
+	result := make([]int, 0, len(states))
+	var add func(i int)
+	add = func(i int) {
+		if seen[i] {
+			return
+		}
+		seen[i] = true
+		result = append(result, i)
+		if i < len(q.segments) && q.segments[i].recursive {
+			add(i + 1)
+		}
+	}
+	for _, i := range states {
+		add(i)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// step 返回各状态消耗名称为 name 的一级键之后的状态
+func (q *Query) step(states []int, name string) []int {
+	next := make([]int, 0, len(states))
+	for _, i := range states {
+		if i >= len(q.segments) {
+			continue
+		}
+		seg := &q.segments[i]
+		if seg.recursive {
+			next = append(next, i)
+		} else if seg.match(name) {
+			next = append(next, i+1)
+		}
+	}
+	return q.closure(next)
+}
+
+// literals 在所有待匹配的段都是普通名称时返回这些名称,用于直接按名称查找子键而不必遍历
+func (q *Query) literals(states []int) ([]string, bool) {
+	names := make([]string, 0, len(states))
+	for _, i := range states {
+		if i >= len(q.segments) {
+			continue
+		}
+		seg := &q.segments[i]
+		if !seg.literal {
+			return nil, false
+		}
+		if !slices.Contains(names, seg.pattern) {
+			names = append(names, seg.pattern)
+		}
+	}
+	return names, true
+}
+
+// walk 按深度优先遍历 key 及其子键,visiting 记录当前路径上的键,用于跳过损坏 hive 中的循环
+func (q *Query) walk(hive, path string, key *RegistryKey, states []int, visiting map[int]bool, yield func(*Match) bool) bool {
+	if len(states) == 0 || key == nil || key.Nkrecord == nil {
+		return true
+	}
+	if visiting[key.Nkrecord.Offset] {
+		return true
+	}
+	visiting[key.Nkrecord.Offset] = true
+	defer delete(visiting, key.Nkrecord.Offset)
+
+	if states[len(states)-1] == len(q.segments) {
+		if !q.yieldKey(hive, path, key, yield) {
+			return false
+		}
+	}
+	var subkeys []*RegistryKey
+	if names, ok := q.literals(states); ok {
+		for _, name := range names {
+			if sub := key.SubKey(name); sub != nil {
+				subkeys = append(subkeys, sub)
+			}
+		}
+	} else {
+		subkeys = key.Subkeys()
+	}
+	for _, sub := range subkeys {
+		name := sub.Name()
+		next := q.step(states, name)
+		if len(next) == 0 {
+			continue
+		}
+		if !q.walk(hive, joinQueryPath(path, name), sub, next, visiting, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query) yieldKey(hive, path string, key *RegistryKey, yield func(*Match) bool) bool {
+	if q.value == nil {
+		return yield(&Match{Hive: hive, Path: path, Key: key})
+	}
+	for _, v := range key.Values() {
+		name := ""
+		if v.Vkrecord.Has_name() {
+			name = v.Vkrecord.Name()
+		}
+		if q.value.match(name) {
+			if !yield(&Match{Hive: hive, Path: path, Key: key, Value: v}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func joinQueryPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "\\" + name
+}
+
+// Match 以 root 为起点执行查询,按深度优先顺序惰性地返回结果
+func (q *Query) Match(root *RegistryKey) iter.Seq[*Match] {
+	return func(yield func(*Match) bool) {
+		q.walk("", "", root, q.closure([]int{0}), make(map[int]bool), yield)
+	}
+}
+
+// MatchHives 在多个挂载的 hive 上执行查询,hives 的键为挂载路径,
+// 如 HKLM\SOFTWARE、HKLM\SYSTEM、HKU\S-1-5-21-...,查询从挂载路径开始匹配。
+// 挂载路径按字典序依次处理,结果的 Hive 为对应的挂载路径
+func (q *Query) MatchHives(hives map[string]*Registry) iter.Seq[*Match] {
+	mounts := make([]string, 0, len(hives))
+	for mount := range hives {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+	return func(yield func(*Match) bool) {
+		for _, mount := range mounts {
+			states := q.closure([]int{0})
+			for _, name := range strings.Split(mount, "\\") {
+				if name != "" {
+					states = q.step(states, name)
+				}
+			}
+			if !q.walk(mount, strings.Trim(mount, "\\"), hives[mount].Root(), states, make(map[int]bool), yield) {
+				return
+			}
+		}
+	}
+}
+
+// Query 编译并以该 hive 的根键为起点执行查询,路径与 Open 一样不包含根键名
+func (r *Registry) Query(expr string) (iter.Seq[*Match], error) {
+	return r.Root().Query(expr)
+}
+
+// Query 编译并以该键为起点执行查询
+func (r *RegistryKey) Query(expr string) (iter.Seq[*Match], error) {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Match(r), nil
+}
@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"testing"
+)
+
+func querySoftwareHive() *Registry {
+	root := &buildKey{name: "ROOT"}
+	run := root.add("Microsoft").add("Windows").add("CurrentVersion").add("Run")
+	run.values = []buildValue{
+		stringValue("", "default"),
+		stringValue("OneDrive", `C:\OneDrive.exe`),
+		stringValue("Updater", `C:\Updater.exe`),
+	}
+	vendor := root.add("Vendor@Corp")
+	vendor.values = []buildValue{stringValue(`Path\Sub`, "x"), stringValue("Other", "y")}
+	for _, name := range []string{"App1", "App2", "AppX", "Bpp"} {
+		root.add(name)
+	}
+	return NewRegistryFromBytes(buildHive(root, "SOFTWARE"))
+}
+
+func querySystemHive() *Registry {
+	root := &buildKey{name: "ROOT"}
+	services := root.add("ControlSet001").add("Services")
+	services.add("svcA").values = []buildValue{stringValue("ImagePath", "a.sys")}
+	svcB := services.add("svcB")
+	svcB.values = []buildValue{stringValue("ImagePath", "b.sys"), {name: "Start", typ: RegDWord, data: []byte{2, 0, 0, 0}}}
+	services.add("svcC")
+	return NewRegistryFromBytes(buildHive(root, "SYSTEM"))
+}
+
+// matchStrings 把结果格式化为 "挂载路径|路径@值名" 并排序
+func matchStrings(seq iter.Seq[*Match]) []string {
+	result := make([]string, 0)
+	for m := range seq {
+		s := m.Path
+		if m.Hive != "" {
+			s = m.Hive + "|" + s
+		}
+		if m.Value != nil {
+			s += "@" + m.Value.Name()
+		}
+		result = append(result, s)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestCutValue(t *testing.T) {
+	tests := []struct {
+		expr, path, value string
+		found             bool
+	}{
+		{`Run@OneDrive`, `Run`, `OneDrive`, true},
+		{`Run`, `Run`, ``, false},
+		{`Run@`, `Run`, ``, true},
+		{`Vendor[@]Corp`, `Vendor[@]Corp`, ``, false},
+		{`Vendor[@]Corp@Path\Sub`, `Vendor[@]Corp`, `Path\Sub`, true},
+		{`[!@]x@[@]`, `[!@]x`, `[@]`, true},
+		{`a[]@]b`, `a[]@]b`, ``, false},
+		{`a[@b@c`, `a[`, `b@c`, true},
+	}
+	for _, tt := range tests {
+		path, value, found := cutValue(tt.expr)
+		if path != tt.path || value != tt.value || found != tt.found {
+			t.Errorf("cutValue(%q) = %q, %q, %v,应为 %q, %q, %v", tt.expr, path, value, found, tt.path, tt.value, tt.found)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	reg := querySoftwareHive()
+	run := `Microsoft\Windows\CurrentVersion\Run`
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`Microsoft\Windows`, []string{`Microsoft\Windows`}},
+		{`microsoft\WINDOWS`, []string{`Microsoft\Windows`}},
+		{`App?`, []string{"App1", "App2", "AppX"}},
+		{`App[12]`, []string{"App1", "App2"}},
+		{`App[!12]`, []string{"AppX"}},
+		{`App[^0-9]`, []string{"AppX"}},
+		{`[a-b]pp*`, []string{"App1", "App2", "AppX", "Bpp"}},
+		{`**\Run`, []string{run}},
+		{`Microsoft\**\Run`, []string{run}},
+		{`Microsoft\**\**\Windows`, []string{`Microsoft\Windows`}},
+		{`**\CurrentVersion\**`, []string{`Microsoft\Windows\CurrentVersion`, run}},
+		{`**\Run@*`, []string{run + "@(default)", run + "@OneDrive", run + "@Updater"}},
+		{`**\Run@*Drive`, []string{run + "@OneDrive"}},
+		{`**\Run@`, []string{run + "@(default)"}},
+		{`**\Run@(default)`, []string{run + "@(default)"}},
+		{`Vendor[@]Corp`, []string{"Vendor@Corp"}},
+		{`Vendor[@]Corp@path\sub`, []string{`Vendor@Corp@Path\Sub`}},
+		{`*[@]*@O*`, []string{"Vendor@Corp@Other"}},
+		{`Vendor@Corp`, []string{}},
+		{`Missing\**`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			seq, err := reg.Query(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchStrings(seq); !slices.Equal(got, tt.want) {
+				t.Fatalf("结果为 %q,应为 %q", got, tt.want)
+			}
+		})
+	}
+
+	all, err := reg.Query(`**`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matchStrings(all); len(got) != 10 || got[0] != "" {
+		t.Fatalf("** 的结果为 %q", got)
+	}
+	for _, expr := range []string{`App[12`, `**\Run@[a`} {
+		if _, err := CompileQuery(expr); !errors.Is(err, ErrQuerySyntax) {
+			t.Errorf("%s 返回 %v,应为 ErrQuerySyntax", expr, err)
+		}
+	}
+}
+
+func TestMatchHives(t *testing.T) {
+	hives := map[string]*Registry{
+		`HKLM\SOFTWARE`:       querySoftwareHive(),
+		`HKLM\SYSTEM`:         querySystemHive(),
+		`HKU\S-1-5-21-1-1001`: querySoftwareHive(),
+	}
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`HKLM\*`, []string{`HKLM\SOFTWARE|HKLM\SOFTWARE`, `HKLM\SYSTEM|HKLM\SYSTEM`}},
+		{`HKLM`, []string{}},
+		{`HKCU\**`, []string{}},
+		{`HKLM\SOFTWARE\Microsoft\Windows`, []string{`HKLM\SOFTWARE|HKLM\SOFTWARE\Microsoft\Windows`}},
+		{`HK*\*\Microsoft`, []string{
+			`HKLM\SOFTWARE|HKLM\SOFTWARE\Microsoft`,
+			`HKU\S-1-5-21-1-1001|HKU\S-1-5-21-1-1001\Microsoft`,
+		}},
+		{`HKU\S-1-5-21-*\**\Run@OneDrive`, []string{
+			`HKU\S-1-5-21-1-1001|HKU\S-1-5-21-1-1001\Microsoft\Windows\CurrentVersion\Run@OneDrive`,
+		}},
+		{`HKLM\SYSTEM\ControlSet001\Services\*@ImagePath`, []string{
+			`HKLM\SYSTEM|HKLM\SYSTEM\ControlSet001\Services\svcA@ImagePath`,
+			`HKLM\SYSTEM|HKLM\SYSTEM\ControlSet001\Services\svcB@ImagePath`,
+		}},
+		{`**\svc[!a]`, []string{
+			`HKLM\SYSTEM|HKLM\SYSTEM\ControlSet001\Services\svcB`,
+			`HKLM\SYSTEM|HKLM\SYSTEM\ControlSet001\Services\svcC`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := CompileQuery(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchStrings(q.MatchHives(hives)); !slices.Equal(got, tt.want) {
+				t.Fatalf("结果为 %q,应为 %q", got, tt.want)
+			}
+		})
+	}
+}
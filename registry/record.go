@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/OblivionTime/go-registry/utils"
 )
@@ -32,7 +33,8 @@ func (u *Record) abs_offset_from_hbin_offset(offset uint32) int {
 	return NewHBINBlock(u.Buffer, h.Offset-int(reloffset_from_first_hbin), h.Parent).Offset + int(offset)
 }
 func (u *Record) Large_data(length int) []byte {
-	off := u.abs_offset_from_hbin_offset(u.UnpackDword(0x8))
+	// db 记录: 0x2 为数据段数量,0x4 为数据段偏移列表的偏移
+	off := u.abs_offset_from_hbin_offset(u.UnpackDword(0x4))
 	cell := NewHBINCell(u.Buffer, off, &u.RegistryBlock)
 	dbi := NewDBIndirectBlock(u.Buffer, cell.Data_offset(), &u.RegistryBlock)
 	return dbi.Large_data(length)
@@ -62,6 +64,16 @@ func NewVKRecord(buffer []byte, offset int, parent *RegistryBlock) *VKRecord {
 func (u *VKRecord) Data_type_ori() int {
 	return u.data_type()
 }
+
+// Data_type_raw 返回未经掩码处理的类型字段,SAM 的 Names 子键用它保存账户的 RID
+func (u *VKRecord) Data_type_raw() uint32 {
+	return u.UnpackDword(0xC)
+}
+
+// Is_tombstone 表示该值为分层 hive 中的删除标记,下层 hive 中的同名值在合成视图中不可见
+func (u *VKRecord) Is_tombstone() bool {
+	return u.UnpackWord(0x10)&vkFlagTombstone != 0
+}
 func (u *VKRecord) Data_type_str() string {
 	data_type := u.data_type()
 	switch data_type {
@@ -123,12 +135,12 @@ func (u *VKRecord) Data_type_str() string {
 		return "RegTimeSpan"
 	case RegGUID:
 		return "RegGUID"
-	case RegUnk111:
-		return "RegUnk111"
-	case RegUnk112:
-		return "RegUnk112"
-	case RegUnk113:
-		return "RegUnk113"
+	case RegPoint:
+		return "RegPoint"
+	case RegSize:
+		return "RegSize"
+	case RegRect:
+		return "RegRect"
 	case RegBytesArray:
 		return "RegBytesArray"
 	case RegInt16Array:
@@ -210,12 +222,20 @@ func (u *VKRecord) Data(overrun int) interface{} {
 		return utils.UnpackUint64LittleEndian(d)
 	} else if data_type == RegBigEndian {
 		return utils.UnpackUint32BigEndian(d)
-	} else if data_type == RegLink || data_type == RegResourceList || data_type == RegFullResourceDescriptor || data_type == RegResourceRequirementsList {
+	} else if data_type == RegLink {
+		return d
+	} else if data_type == RegResourceList || data_type == RegFullResourceDescriptor || data_type == RegResourceRequirementsList {
+		// 解析失败时退回原始字节
+		if v := parseResourceValue(data_type, d); v != nil {
+			return v
+		}
 		return d
 	} else if slices.Contains(tt, data_type) {
-		d = d[0 : len(d)-8]            //remove timestamp from end
-		comp_type := data_type & 0xEFF // Apply mask for composite types
-		return ParseAppDataCompositeValue(comp_type, d, len(d))
+		if len(d) < 8 {
+			return nil
+		}
+		d = d[0 : len(d)-8] //remove timestamp from end, see Timestamp()
+		return ParseAppDataCompositeValue(data_type, d, len(d))
 	} else if data_type == RegFileTime {
 		return ParseWindowsTimestamp(int64(utils.UnpackUint64LittleEndian(d)))
 	} else if data_length < 5 || data_length >= 0x80000000 {
@@ -224,7 +244,23 @@ func (u *VKRecord) Data(overrun int) interface{} {
 		return nil
 	}
 }
+
+// Timestamp 返回 settings.dat 中的值附带的修改时间,其他类型的值返回 false
+func (u *VKRecord) Timestamp() (time.Time, bool) {
+	if !slices.Contains(tt, u.data_type()) {
+		return time.Time{}, false
+	}
+	d := u.raw_data(0)
+	if len(d) < 8 {
+		return time.Time{}, false
+	}
+	return ParseWindowsTimestamp(int64(utils.UnpackUint64LittleEndian(d[len(d)-8:]))), true
+}
 func (u *VKRecord) raw_data(overrun int) []byte {
+	if u.Is_tombstone() {
+		// 删除标记没有数据,数据偏移为 0xFFFFFFFF
+		return []byte{}
+	}
 	data_type := u.data_type()
 	data_length := u.raw_data_length()
 	data_offset := u.data_offset()
@@ -247,7 +283,8 @@ func (u *VKRecord) raw_data(overrun int) []byte {
 		}
 	} else if data_type == RegBin || data_type == RegNone || slices.Contains(tt, data_type) {
 		if data_length >= 0x80000000 {
-			ret = []byte("")
+			// 不超过 4 字节的数据直接存放在 data_offset 字段中
+			ret = u.Buffer[data_offset : data_offset+min(data_length-0x80000000, 4)]
 		} else if 0x3fd8 < data_length && data_length < 0x80000000 {
 			d := NewHBINCell(u.Buffer, data_offset, &u.RegistryBlock)
 			if bytes.Equal(d.Data_id(), []byte("db")) {
@@ -350,6 +387,9 @@ func (u *NKRecord) Subkey_number() uint32 {
 }
 func (u *NKRecord) Subkey_List() *NKRecord {
 	subkey_list_offset := u.abs_offset_from_hbin_offset(u.UnpackDword(0x1C))
+	if !u.within(subkey_list_offset, 8) {
+		return nil
+	}
 	d := NewHBINCell(u.Buffer, subkey_list_offset, &u.RegistryBlock)
 	id := d.Data_id()
 	switch string(id) {
@@ -369,15 +409,42 @@ func (u *NKRecord) Subkey_List() *NKRecord {
 	return nil
 }
 
+// Keys 返回子键列表中的所有子键。lf/lh 的每项为 8 字节(偏移与哈希),li 的每项只有 4 字节偏移,
+// ri 的每项指向一个 lf/lh/li 子列表
 func (u *NKRecord) Keys() []*NKRecord {
+	return u.keys(true)
+}
+func (u *NKRecord) keys(allowIndex bool) []*NKRecord {
 	key_index := 0x4
+	stride := 8
+	id := string(u.UnpackString(0, 2))
+	switch id {
+	case "li":
+		stride = 4
+	case "ri":
+		stride = 4
+		if !allowIndex {
+			return nil
+		}
+	}
 	result := make([]*NKRecord, 0)
 	for i := 0; i < u._keys_len(); i++ {
+		if key_index+4 > len(u.Buffer)-u.Offset {
+			break
+		}
 		offset := u.UnpackDword(key_index)
 		key_offset := u.abs_offset_from_hbin_offset(offset)
+		key_index += stride
+		if !u.within(key_offset, 8) {
+			continue
+		}
 		d := NewHBINCell(u.Buffer, key_offset, &u.RegistryBlock)
-		result = append(result, NewNKRecord(u.Buffer, d.Data_offset(), &u.RegistryBlock))
-		key_index += 8
+		if id == "ri" {
+			sub := &NKRecord{Record: Record{RegistryBlock: RegistryBlock{Buffer: u.Buffer, Offset: d.Data_offset(), Parent: &u.RegistryBlock}}}
+			result = append(result, sub.keys(false)...)
+		} else if string(d.Data_id()) == "nk" {
+			result = append(result, NewNKRecord(u.Buffer, d.Data_offset(), &u.RegistryBlock))
+		}
 	}
 	return result
 
@@ -396,6 +463,21 @@ func (u *NKRecord) name() string {
 	}
 	return utils.DecodeUTF16(unpacked_string)
 }
+
+// Timestamp 返回键的最后写入时间
+func (u *NKRecord) Timestamp() time.Time {
+	return ParseWindowsTimestamp(int64(u.UnpackQword(0x4)))
+}
+
+// Layer_semantics 返回分层键的语义,保存在 0xD 处字节的低 2 位
+func (u *NKRecord) Layer_semantics() int {
+	return int(u.UnpackWord(0xC)>>8) & 0x3
+}
+
+// Inherit_class 表示分层键的类名继承自下层 hive,保存在 0xD 处字节的最高位
+func (u *NKRecord) Inherit_class() bool {
+	return u.UnpackWord(0xC)&0x8000 != 0
+}
 func (u *NKRecord) is_root() bool {
 	return u.UnpackWord(0x2)&0x0004 > 0
 }
@@ -418,9 +500,29 @@ func (u *NKRecord) Path() string {
 }
 func (u *NKRecord) parent_key() *NKRecord {
 	offset := u.abs_offset_from_hbin_offset(u.UnpackDword(0x10))
+	if !u.within(offset, 8) {
+		return nil
+	}
 	d := NewHBINCell(u.Buffer, offset, u.Parent)
+	// 父键所在的 hbin 缺失时不是 nk 记录,视为没有父键
+	if string(d.Data_id()) != "nk" {
+		return nil
+	}
 	return NewNKRecord(u.Buffer, d.Data_offset(), u.Parent)
 }
+
+// Security_record 返回键引用的 sk 记录,偏移无效或不是 sk 记录时返回 nil
+func (u *NKRecord) Security_record() *SKRecord {
+	offset := u.abs_offset_from_hbin_offset(u.UnpackDword(0x2C))
+	if !u.within(offset, 8) {
+		return nil
+	}
+	d := NewHBINCell(u.Buffer, offset, &u.RegistryBlock)
+	if string(d.Data_id()) != "sk" {
+		return nil
+	}
+	return NewSKRecord(u.Buffer, d.Data_offset(), &u.RegistryBlock)
+}
 func (u *NKRecord) has_parent_key() bool {
 	if u.is_root() {
 		return false
@@ -439,6 +541,9 @@ func (u *NKRecord) Values_list() *ValuesList {
 		return nil
 	}
 	values_list_offset := u.abs_offset_from_hbin_offset(u.UnpackDword(0x28))
+	if !u.within(values_list_offset, 4) {
+		return nil
+	}
 	d := NewHBINCell(u.Buffer, values_list_offset, &u.RegistryBlock)
 	return NewValuesList(u.Buffer, d.Data_offset(), &u.RegistryBlock, u.values_number())
 }
@@ -533,6 +638,18 @@ func NewSKRecord(buffer []byte, offset int, parent *RegistryBlock) *SKRecord {
 	}
 }
 
+// Descriptor 返回 sk 中自相对格式的安全描述符,0x10 处为其长度,超出缓冲区时返回 nil
+func (u *SKRecord) Descriptor() []byte {
+	if !u.within(u.Offset, 0x14) {
+		return nil
+	}
+	size := int(u.UnpackDword(0x10))
+	if !u.within(u.Offset+0x14, size) {
+		return nil
+	}
+	return u.UnpackBinary(0x14, size)
+}
+
 type DBRecord struct {
 	Record
 }
@@ -587,13 +704,17 @@ func NewDBIndirectBlock(buffer []byte, offset int, parent *RegistryBlock) *DBInd
 	}
 }
 func (u *DBIndirectBlock) Large_data(length int) []byte {
-	b := make([]byte, 0)
+	b := make([]byte, 0, length)
 	count := 0
 	for length > 0 {
 		off := u.abs_offset_from_hbin_offset(u.UnpackDword(4 * count))
 		cell := NewHBINCell(u.Buffer, off, &u.RegistryBlock)
-		size := slices.Min([]int{length, int(cell.size)})
-		b = append(b, NewHBINCell(u.Buffer, off, &u.RegistryBlock).Raw_data()[:size]...)
+		// 除最后一段外,每个数据段保存 0x3fd8 字节
+		size := slices.Min([]int{length, 0x3fd8, len(cell.Raw_data())})
+		if size <= 0 {
+			break
+		}
+		b = append(b, cell.Raw_data()[:size]...)
 		count += 1
 		length -= size
 	}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	regDatSignature  = "SHCC3.10"
+	regDatHeaderSize = 0x20
+	regDatEntrySize  = 8
+)
+
+// NewRegDatRegistry 读取 Windows 3.1 的 REG.DAT(SHCC3.10 格式),转换为 regf 后返回。
+// REG.DAT 只保存 HKEY_CLASSES_ROOT,每个键最多有一个字符串类型的默认值,
+// 字符串按 Windows-1252 解码,键没有最后写入时间。部分键损坏时仍返回可用的 Registry,
+// 同时返回合并后的错误
+func NewRegDatRegistry(buf []byte) (*Registry, error) {
+	return NewRegDatRegistryWithEncoding(buf, charmap.Windows1252)
+}
+
+// NewRegDatRegistryWithEncoding 与 NewRegDatRegistry 相同,但按 ANSI 代码页 enc 解码字符串,
+// enc 为 nil 时使用 Windows-1252
+func NewRegDatRegistryWithEncoding(buf []byte, enc encoding.Encoding) (*Registry, error) {
+	if enc == nil {
+		enc = charmap.Windows1252
+	}
+	root, err := parseRegDat(buf, enc)
+	if root == nil {
+		return nil, err
+	}
+	return NewRegistryFromBytes(buildHive(root, "REG.DAT")), err
+}
+
+// parseRegDat 解析导航表与文本表。导航表中的每一项为 4 个 WORD:目录项为兄弟项、
+// 子项、键名项与值项的索引,键名项与值项为哈希链、引用计数、字符串长度与字符串在文本表中的偏移。
+// 第 0 项的子项为第一个顶层键
+func parseRegDat(buf []byte, enc encoding.Encoding) (*buildKey, error) {
+	if !bytes.HasPrefix(buf, []byte(regDatSignature)) {
+		return nil, fmt.Errorf("%w: 缺少 %s 签名", ErrUnknownFormat, regDatSignature)
+	}
+	if len(buf) < regDatHeaderSize {
+		return nil, fmt.Errorf("%w: 文件头过短", ErrCorrupt)
+	}
+	// 0x8 处为哈希表的偏移,0xC 处为导航表的偏移,两者通常都为 0x20
+	tableOffset := int64(binary.LittleEndian.Uint32(buf[0xC:]))
+	count := int64(binary.LittleEndian.Uint32(buf[0x10:]))
+	textOffset := int64(binary.LittleEndian.Uint32(buf[0x14:]))
+	textSize := int64(binary.LittleEndian.Uint32(buf[0x18:]))
+	if tableOffset+count*regDatEntrySize > int64(len(buf)) {
+		return nil, fmt.Errorf("%w: 导航表超出文件范围", ErrCorrupt)
+	}
+	if textOffset > int64(len(buf)) {
+		return nil, fmt.Errorf("%w: 文本表超出文件范围", ErrCorrupt)
+	}
+	table := buf[tableOffset : tableOffset+count*regDatEntrySize]
+	text := buf[textOffset:min(textOffset+textSize, int64(len(buf)))]
+
+	var errs []error
+	entry := func(idx uint16) ([]uint16, bool) {
+		if int(idx)*regDatEntrySize+regDatEntrySize > len(table) {
+			errs = append(errs, fmt.Errorf("%w: 导航表索引 %d 超出范围", ErrCorrupt, idx))
+			return nil, false
+		}
+		e := table[int(idx)*regDatEntrySize:]
+		return []uint16{
+			binary.LittleEndian.Uint16(e[0:]), binary.LittleEndian.Uint16(e[2:]),
+			binary.LittleEndian.Uint16(e[4:]), binary.LittleEndian.Uint16(e[6:]),
+		}, true
+	}
+	str := func(idx uint16) (string, bool) {
+		e, ok := entry(idx)
+		if !ok {
+			return "", false
+		}
+		length, offset := int(e[2]), int(e[3])
+		if offset+length > len(text) {
+			errs = append(errs, fmt.Errorf("%w: 导航表第 %d 项的字符串超出文本表范围", ErrCorrupt, idx))
+			return "", false
+		}
+		return decodeANSI(enc, text[offset:offset+length]), true
+	}
+
+	root := &buildKey{name: legacyRootName}
+	first, ok := entry(0)
+	if !ok {
+		return nil, errors.Join(errs...)
+	}
+	visited := map[uint16]bool{0: true}
+	var build func(idx uint16, parent *buildKey)
+	build = func(idx uint16, parent *buildKey) {
+		for idx != 0 {
+			if visited[idx] {
+				errs = append(errs, fmt.Errorf("%w: 导航表第 %d 项重复出现", ErrCorrupt, idx))
+				return
+			}
+			visited[idx] = true
+			dir, ok := entry(idx)
+			if !ok {
+				return
+			}
+			key := parent.add("")
+			if dir[2] != 0 {
+				key.name, _ = str(dir[2])
+			}
+			if dir[3] != 0 {
+				if value, ok := str(dir[3]); ok {
+					key.values = append(key.values, buildValue{typ: RegSZ, data: encodeUTF16(value, true)})
+				}
+			}
+			build(dir[1], key)
+			idx = dir[0]
+		}
+	}
+	build(first[1], root)
+	return root, errors.Join(errs...)
+}
@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// regDatKey 为生成 REG.DAT 测试数据时的一个键,名称与默认值为 ANSI 编码,value 为空时没有默认值
+type regDatKey struct {
+	name    string
+	value   string
+	subkeys []*regDatKey
+}
+
+// regDatFile 为生成的 REG.DAT 及各键的目录项在导航表中的索引(按路径索引)
+type regDatFile struct {
+	buf   []byte
+	index map[string]uint16
+}
+
+// buildRegDat 生成 REG.DAT,导航表紧接文件头,文本表位于导航表之后
+func buildRegDat(keys []*regDatKey) *regDatFile {
+	f := &regDatFile{index: make(map[string]uint16)}
+	entries := [][4]uint16{{}}
+	var text []byte
+	str := func(s string) uint16 {
+		entries = append(entries, [4]uint16{0, 1, uint16(len(s)), uint16(len(text))})
+		text = append(text, s...)
+		return uint16(len(entries) - 1)
+	}
+	var add func(keys []*regDatKey, parent string) uint16
+	add = func(keys []*regDatKey, parent string) uint16 {
+		first, prev := uint16(0), uint16(0)
+		for _, k := range keys {
+			path := strings.TrimPrefix(parent+`\`+k.name, `\`)
+			idx := uint16(len(entries))
+			entries = append(entries, [4]uint16{})
+			f.index[path] = idx
+			entries[idx][2] = str(k.name)
+			if k.value != "" {
+				entries[idx][3] = str(k.value)
+			}
+			entries[idx][1] = add(k.subkeys, path)
+			if prev == 0 {
+				first = idx
+			} else {
+				entries[prev][0] = idx
+			}
+			prev = idx
+		}
+		return first
+	}
+	entries[0][1] = add(keys, "")
+
+	table := make([]byte, regDatEntrySize*len(entries))
+	for i, e := range entries {
+		for j, v := range e {
+			binary.LittleEndian.PutUint16(table[i*regDatEntrySize+2*j:], v)
+		}
+	}
+	header := make([]byte, regDatHeaderSize)
+	copy(header, regDatSignature)
+	binary.LittleEndian.PutUint32(header[0x8:], regDatHeaderSize)
+	binary.LittleEndian.PutUint32(header[0xC:], regDatHeaderSize)
+	binary.LittleEndian.PutUint32(header[0x10:], uint32(len(entries)))
+	binary.LittleEndian.PutUint32(header[0x14:], uint32(regDatHeaderSize+len(table)))
+	binary.LittleEndian.PutUint32(header[0x18:], uint32(len(text)))
+	f.buf = slices.Concat(header, table, text)
+	return f
+}
+
+// at 返回导航表中的第 idx 项
+func (f *regDatFile) at(idx uint16) []byte {
+	return f.buf[regDatHeaderSize+int(idx)*regDatEntrySize:]
+}
+
+// entry 返回导航表中 path 处键的目录项
+func (f *regDatFile) entry(path string) []byte {
+	return f.at(f.index[path])
+}
+
+func regDatTestFile() *regDatFile {
+	return buildRegDat([]*regDatKey{
+		{name: ".txt", value: "txtfile"},
+		{name: "txtfile", value: "Text Document", subkeys: []*regDatKey{
+			{name: "shell", subkeys: []*regDatKey{
+				{name: "open", subkeys: []*regDatKey{{name: "command", value: "notepad.exe %1"}}},
+				{name: "print", subkeys: []*regDatKey{{name: "command", value: "notepad.exe /p %1"}}},
+			}},
+		}},
+		{name: "Caf\xe9", value: "caf\xe9"},
+		{name: "\xd6\xd0\xce\xc4", value: "\xce\xc4\xb1\xbe"},
+	})
+}
+
+func TestRegDat(t *testing.T) {
+	reg, err := NewRegDatRegistry(regDatTestFile().buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subkeyNames(reg.Root()); !slices.Equal(got, []string{".txt", "Café", "txtfile", "ÖÐÎÄ"}) {
+		t.Fatalf("根键的子键为 %v", got)
+	}
+	if got := subkeyNames(reg.Open(`txtfile\shell`)); !slices.Equal(got, []string{"open", "print"}) {
+		t.Fatalf("shell 的子键为 %v", got)
+	}
+	for path, want := range map[string]string{
+		".txt":                        "txtfile",
+		"txtfile":                     "Text Document",
+		`txtfile\shell\open\command`:  "notepad.exe %1",
+		`txtfile\shell\print\command`: "notepad.exe /p %1",
+		"Café":                        "café",
+	} {
+		if s, err := reg.Open(path).GetStringValue("(default)"); err != nil || s != want {
+			t.Errorf("%s 的默认值为 %q, %v,应为 %q", path, s, err, want)
+		}
+	}
+	if values := reg.Open(`txtfile\shell`).Values(); len(values) != 0 {
+		t.Errorf("shell 不应有值: %d", len(values))
+	}
+	if auto := NewRegistryFromBytes(regDatTestFile().buf); auto.Open(`txtfile\shell\open\command`) == nil {
+		t.Error("NewRegistryFromBytes 没有识别 REG.DAT 格式")
+	}
+}
+
+func TestRegDatEncoding(t *testing.T) {
+	reg, err := NewRegDatRegistryWithEncoding(regDatTestFile().buf, simplifiedchinese.GBK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := reg.Open("中文").GetStringValue("(default)"); err != nil || s != "文本" {
+		t.Fatalf("按 GBK 解码的默认值为 %q, %v", s, err)
+	}
+}
+
+func TestRegDatCorrupt(t *testing.T) {
+	put := func(b []byte, field int, v uint16) { binary.LittleEndian.PutUint16(b[2*field:], v) }
+	tests := []struct {
+		name    string
+		corrupt func(f *regDatFile)
+		message string
+		// keep 为损坏后仍然可以访问的键
+		keep string
+	}{
+		{"sibling index", func(f *regDatFile) { put(f.entry("txtfile"), 0, 0xFFF0) }, "超出范围", `txtfile\shell\open\command`},
+		{"child index", func(f *regDatFile) { put(f.entry(`txtfile\shell`), 1, 0xFFF0) }, "超出范围", "Café"},
+		{"name index", func(f *regDatFile) { put(f.entry(".txt"), 2, 0xFFF0) }, "超出范围", "txtfile"},
+		{"string offset", func(f *regDatFile) {
+			value := binary.LittleEndian.Uint16(f.entry(".txt")[6:])
+			put(f.at(value), 3, 0xFFF0)
+		}, "文本表范围", ".txt"},
+		{"sibling cycle", func(f *regDatFile) { put(f.entry(`txtfile\shell\print`), 0, f.index[`txtfile\shell\open`]) }, "重复出现", `txtfile\shell\print\command`},
+		{"child cycle", func(f *regDatFile) { put(f.entry(`txtfile\shell\open\command`), 1, f.index["txtfile"]) }, "重复出现", "Café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := regDatTestFile()
+			tt.corrupt(f)
+			reg, err := NewRegDatRegistry(f.buf)
+			if !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("返回 %v,应为包含 %q 的 ErrCorrupt", err, tt.message)
+			}
+			if reg == nil || reg.Open(tt.keep) == nil {
+				t.Fatalf("损坏后找不到 %s", tt.keep)
+			}
+		})
+	}
+
+	f := regDatTestFile()
+	binary.LittleEndian.PutUint32(f.buf[0x10:], 0xFFFF)
+	if _, err := NewRegDatRegistry(f.buf); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("导航表超出文件时返回 %v", err)
+	}
+	if _, err := NewRegDatRegistry([]byte("SHCC3.10")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("过短的文件头返回 %v", err)
+	}
+}
@@ -1,11 +1,10 @@
 package registry
 
 import (
-	"errors"
-	"fmt"
+	"bytes"
 	"os"
-	"slices"
 	"strings"
+	"time"
 
 	"github.com/OblivionTime/go-registry/utils"
 )
@@ -17,6 +16,23 @@ type Registry struct {
 
 func NewRegistry(filePath string) *Registry {
 	buf, _ := os.ReadFile(filePath)
+	return NewRegistryFromBytes(buf)
+}
+
+// NewRegistryFromBytes 从内存中完整的 hive 数据创建 Registry,如雕复得到或从镜像中读取的 hive。
+// Windows 9x 的 CREG 格式与 Windows 3.1 的 REG.DAT 会自动转换,需要获取转换错误时
+// 使用 NewCREGRegistry 或 NewRegDatRegistry
+func NewRegistryFromBytes(buf []byte) *Registry {
+	if bytes.HasPrefix(buf, []byte("CREG")) {
+		if r, _ := NewCREGRegistry(buf); r != nil {
+			return r
+		}
+	}
+	if bytes.HasPrefix(buf, []byte(regDatSignature)) {
+		if r, _ := NewRegDatRegistry(buf); r != nil {
+			return r
+		}
+	}
 	return &Registry{
 		Buffers: buf,
 		Regf:    NewREGFBlock(buf, 0, nil),
@@ -24,6 +40,9 @@ func NewRegistry(filePath string) *Registry {
 }
 
 func (r *Registry) Root() *RegistryKey {
+	if r == nil || r.Regf == nil {
+		return nil
+	}
 	return NewRegistryKey(r.Regf.FirstKey())
 }
 func (r *Registry) Open(p string) *RegistryKey {
@@ -41,27 +60,45 @@ func NewRegistryKey(nkrecord *NKRecord) *RegistryKey {
 }
 func (r *RegistryKey) Subkeys() []*RegistryKey {
 	result := make([]*RegistryKey, 0)
-	if r.Nkrecord.Subkey_number() == 0 {
+	if r == nil || r.Nkrecord == nil || r.Nkrecord.Subkey_number() == 0 {
 		return result
 	}
 	l := r.Nkrecord.Subkey_List()
+	if l == nil {
+		return result
+	}
 	for _, v := range l.Keys() {
+		if v == nil {
+			continue
+		}
 		result = append(result, NewRegistryKey(v))
 	}
 	return result
 
 }
 func (r *RegistryKey) SubKey(name string) *RegistryKey {
-	if r.Nkrecord.Subkey_number() == 0 {
+	if r == nil || r.Nkrecord == nil || r.Nkrecord.Subkey_number() == 0 {
+		return nil
+	}
+	l := r.Nkrecord.Subkey_List()
+	if l == nil {
 		return nil
 	}
-	for _, k := range r.Nkrecord.Subkey_List().Keys() {
-		if strings.EqualFold(k.name(), name) {
+	for _, k := range l.Keys() {
+		if k != nil && strings.EqualFold(k.name(), name) {
 			return NewRegistryKey(k)
 		}
 	}
 	return nil
 }
+func (r *RegistryKey) Name() string {
+	return r.Nkrecord.name()
+}
+
+// Timestamp 返回键的最后写入时间
+func (r *RegistryKey) Timestamp() time.Time {
+	return r.Nkrecord.Timestamp()
+}
 func (r *RegistryKey) Path() string {
 	return r.Nkrecord.Path()
 }
@@ -71,87 +108,47 @@ func (r *RegistryKey) FindKey(p string) *RegistryKey {
 		return r
 	}
 	immediate, _, future := utils.Partition(p, "\\")
-	return r.SubKey(immediate).FindKey(future)
+	sub := r.SubKey(immediate)
+	if sub == nil {
+		return nil
+	}
+	return sub.FindKey(future)
 }
 
 func (r *RegistryKey) Values() []*RegistryValue {
 	result := make([]*RegistryValue, 0)
+	if r == nil || r.Nkrecord == nil {
+		return result
+	}
 	list := r.Nkrecord.Values_list()
 	if list == nil {
 		return result
 	}
-	for _, v := range r.Nkrecord.Values_list().Values() {
-		result = append(result, NewRegistryValue(v))
+	for _, v := range list.Values() {
+		if v != nil {
+			result = append(result, NewRegistryValue(v))
+		}
 	}
 	return result
 }
 func (r *RegistryKey) Value(name string) *RegistryValue {
+	if r == nil || r.Nkrecord == nil {
+		return nil
+	}
 	if name == "(default)" {
 		name = ""
 	}
-	for _, v := range r.Nkrecord.Values_list().Values() {
-		if strings.EqualFold(v.Name(), name) {
+	list := r.Nkrecord.Values_list()
+	if list == nil {
+		return nil
+	}
+	for _, v := range list.Values() {
+		if v != nil && strings.EqualFold(v.Name(), name) {
 			return NewRegistryValue(v)
 		}
 	}
 	return nil
 }
-func (r *RegistryKey) GetStringValue(name string) (string, error) {
-	if name == "(default)" {
-		name = ""
-	}
-	value := r.Value(name)
-	if value == nil {
-		return "", errors.New("未找到指定的注册表项")
-	}
-	data_type := value.Value_type_ori()
-	if slices.Contains(stringTypes, data_type) {
-		return value.Value(0).(string), nil
-	}
-	return "", fmt.Errorf("指定的注册表项的类型为:%s,而不是字符串类型", value.Value_type())
-}
-func (r *RegistryKey) GetBinaryValue(name string) ([]byte, error) {
-	if name == "(default)" {
-		name = ""
-	}
-	value := r.Value(name)
-	if value == nil {
-		return nil, errors.New("未找到指定的注册表项")
-	}
-	data_type := value.Value_type_ori()
-	if slices.Contains(byteArrayTypes, data_type) {
-		return value.Value(0).([]byte), nil
-	}
-	return nil, fmt.Errorf("指定的注册表项的类型为:%s,而不是字节数组类型", value.Value_type())
-}
-func (r *RegistryKey) GetInt32Value(name string) (uint32, error) {
-	if name == "(default)" {
-		name = ""
-	}
-	value := r.Value(name)
-	if value == nil {
-		return 0, errors.New("未找到指定的注册表项")
-	}
-	data_type := value.Value_type_ori()
-	if slices.Contains(int32Types, data_type) {
-		return value.Value(0).(uint32), nil
-	}
-	return 0, fmt.Errorf("指定的注册表项的类型为:%s,而不是int32类型", value.Value_type())
-}
-func (r *RegistryKey) GetInt64Value(name string) (uint64, error) {
-	if name == "(default)" {
-		name = ""
-	}
-	value := r.Value(name)
-	if value == nil {
-		return 0, errors.New("未找到指定的注册表项")
-	}
-	data_type := value.Value_type_ori()
-	if slices.Contains(int64Types, data_type) {
-		return value.Value(0).(uint64), nil
-	}
-	return 0, fmt.Errorf("指定的注册表项的类型为:%s,而不是int64类型", value.Value_type())
-}
 
 type RegistryValue struct {
 	Vkrecord *VKRecord
@@ -175,6 +172,16 @@ func (r *RegistryValue) Value_type() string {
 func (r *RegistryValue) Value_type_ori() int {
 	return r.Vkrecord.Data_type_ori()
 }
+
+// Value_type_raw 返回未经掩码处理的类型字段
+func (r *RegistryValue) Value_type_raw() uint32 {
+	return r.Vkrecord.Data_type_raw()
+}
 func (r *RegistryValue) Value(overrun int) interface{} {
 	return r.Vkrecord.Data(overrun)
 }
+
+// Timestamp 返回 settings.dat 中的值附带的修改时间,其他类型的值返回 false
+func (r *RegistryValue) Timestamp() (time.Time, bool) {
+	return r.Vkrecord.Timestamp()
+}
@@ -3,6 +3,7 @@ package registry
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math"
 	"time"
 )
@@ -21,6 +22,11 @@ func NewRegistryBlock(buffer []byte, offset int, parent *RegistryBlock) *Registr
 	}
 }
 
+// within 判断从绝对偏移量 offset 开始的 length 字节是否位于缓冲区内
+func (u *RegistryBlock) within(offset, length int) bool {
+	return offset >= 0 && length >= 0 && offset+length <= len(u.Buffer)
+}
+
 // UnpackBinary 从相对偏移量开始提取指定长度的二进制数据
 func (u *RegistryBlock) UnpackBinary(offset, length int) []byte {
 	start := u.Offset + offset
@@ -167,7 +173,16 @@ func (u *HBINCell) abs_offset_from_hbin_offset(offset uint32) int {
 	return NewHBINBlock(u.Buffer, h.Offset-int(reloffset_from_first_hbin), h.Parent).Offset + int(offset)
 }
 func (u *HBINCell) Raw_data() []byte {
-	return u.Buffer[u.Data_offset() : u.Data_offset()+int(u.size)]
+	// 已分配的 cell 大小为负数,大小包含开头 4 字节的长度字段
+	size := int(u.size)
+	if size < 0 {
+		size = -size
+	}
+	end := min(u.Offset+size, len(u.Buffer))
+	if end < u.Data_offset() {
+		return []byte{}
+	}
+	return u.Buffer[u.Data_offset():end]
 }
 func (u *HBINCell) Child() *NKRecord {
 	if u.size > 0 {
@@ -221,11 +236,20 @@ func (u *ValuesList) Values() []*VKRecord {
 	result := make([]*VKRecord, 0)
 	value_item := 0x0
 	for i := 0; i < int(u.number); i++ {
+		if !u.within(u.Offset+value_item, 4) {
+			break
+		}
 		value_offset := u.abs_offset_from_hbin_offset(u.UnpackDword(value_item))
-		d := NewHBINCell(u.Buffer, value_offset, &u.HBINCell.RegistryBlock)
-		v := NewVKRecord(u.Buffer, d.Data_offset(), &u.HBINCell.RegistryBlock)
 		value_item += 4
-		result = append(result, v)
+		// 指向缓冲区之外或不是 vk 记录的值(如碎片中缺失的 hbin)直接跳过
+		if !u.within(value_offset, 8) {
+			continue
+		}
+		d := NewHBINCell(u.Buffer, value_offset, &u.HBINCell.RegistryBlock)
+		if string(d.Data_id()) != "vk" {
+			continue
+		}
+		result = append(result, NewVKRecord(u.Buffer, d.Data_offset(), &u.HBINCell.RegistryBlock))
 	}
 	return result
 }
@@ -235,11 +259,12 @@ func ParseTimestamp(ticks int64, resolution int64, epoch time.Time) time.Time {
 	// Go 语言的 time 包支持纳秒精度，这里我们将其转换为微秒
 	datetimeResolution := int64(1e6)
 
-	// 将自纪元以来的刻度转换为自纪元以来的微秒
-	us := int64(math.Round(float64(ticks*datetimeResolution) / float64(resolution)))
+	// 将自纪元以来的刻度拆分为整秒和余数,避免乘法溢出以及 time.Duration 只能表示约 290 年的限制
+	secs := ticks / resolution
+	us := int64(math.Round(float64(ticks%resolution*datetimeResolution) / float64(resolution)))
 
 	// 转换为 time.Time
-	return epoch.Add(time.Duration(us) * time.Microsecond)
+	return time.Unix(epoch.Unix()+secs, us*int64(time.Microsecond)).In(epoch.Location())
 }
 
 // ParseWindowsTimestamp 解析 Windows 时间戳
@@ -250,3 +275,23 @@ func ParseWindowsTimestamp(qword int64) time.Time {
 	resolution := int64(1e7)
 	return ParseTimestamp(qword, resolution, epoch)
 }
+
+// ParseSystemTime 解析 16 字节的 SYSTEMTIME 结构:年、月、星期、日、时、分、秒、毫秒,各 2 字节。
+// 时区由写入者决定,这里按 UTC 返回
+func ParseSystemTime(data []byte) (time.Time, error) {
+	if len(data) < 16 {
+		return time.Time{}, fmt.Errorf("%w: SYSTEMTIME 需要 16 字节,实际为 %d 字节", ErrCorrupt, len(data))
+	}
+	field := func(i int) int {
+		return int(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	year, month, day := field(0), field(1), field(3)
+	hour, minute, second, millisecond := field(4), field(5), field(6), field(7)
+	if year == 0 && month == 0 && day == 0 {
+		return time.Time{}, nil
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 || millisecond > 999 {
+		return time.Time{}, fmt.Errorf("%w: 无效的 SYSTEMTIME %d-%d-%d %d:%d:%d.%d", ErrCorrupt, year, month, day, hour, minute, second, millisecond)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, millisecond*int(time.Millisecond), time.UTC), nil
+}
@@ -0,0 +1,532 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InterfaceType 对应 INTERFACE_TYPE 枚举,描述设备所在的总线类型
+type InterfaceType int32
+
+const (
+	InterfaceTypeUndefined InterfaceType = -1
+	Internal               InterfaceType = 0
+	Isa                    InterfaceType = 1
+	Eisa                   InterfaceType = 2
+	MicroChannel           InterfaceType = 3
+	TurboChannel           InterfaceType = 4
+	PCIBus                 InterfaceType = 5
+	VMEBus                 InterfaceType = 6
+	NuBus                  InterfaceType = 7
+	PCMCIABus              InterfaceType = 8
+	CBus                   InterfaceType = 9
+	MPIBus                 InterfaceType = 10
+	MPSABus                InterfaceType = 11
+	ProcessorInternal      InterfaceType = 12
+	InternalPowerBus       InterfaceType = 13
+	PNPISABus              InterfaceType = 14
+	PNPBus                 InterfaceType = 15
+	Vmcs                   InterfaceType = 16
+	ACPIBus                InterfaceType = 17
+)
+
+var interfaceTypeNames = []string{
+	"Internal", "Isa", "Eisa", "MicroChannel", "TurboChannel", "PCIBus",
+	"VMEBus", "NuBus", "PCMCIABus", "CBus", "MPIBus", "MPSABus",
+	"ProcessorInternal", "InternalPowerBus", "PNPISABus", "PNPBus",
+	"Vmcs", "ACPIBus",
+}
+
+func (t InterfaceType) String() string {
+	if t == InterfaceTypeUndefined {
+		return "InterfaceTypeUndefined"
+	}
+	if t >= 0 && int(t) < len(interfaceTypeNames) {
+		return interfaceTypeNames[t]
+	}
+	return fmt.Sprintf("InterfaceType(%d)", int32(t))
+}
+
+// ResourceType 对应 CmResourceType* 常量
+type ResourceType uint8
+
+const (
+	CmResourceTypeNull           ResourceType = 0
+	CmResourceTypePort           ResourceType = 1
+	CmResourceTypeInterrupt      ResourceType = 2
+	CmResourceTypeMemory         ResourceType = 3
+	CmResourceTypeDma            ResourceType = 4
+	CmResourceTypeDeviceSpecific ResourceType = 5
+	CmResourceTypeBusNumber      ResourceType = 6
+	CmResourceTypeMemoryLarge    ResourceType = 7
+	CmResourceTypeNonArbitrated  ResourceType = 128
+	CmResourceTypeDevicePrivate  ResourceType = 129
+	CmResourceTypePcCardConfig   ResourceType = 130
+	CmResourceTypeMfCardConfig   ResourceType = 131
+	CmResourceTypeConnection     ResourceType = 132
+	CmResourceTypeConfigData     ResourceType = CmResourceTypeNonArbitrated
+)
+
+const (
+	cmResourceMemoryLarge40 = 0x0200
+	cmResourceMemoryLarge48 = 0x0400
+	cmResourceMemoryLarge64 = 0x0800
+
+	partialResourceDescriptorSize  = 16 // 32 位系统
+	partialResourceDescriptorSizeX = 20 // 64 位系统(KAFFINITY 为 8 字节)
+	ioResourceDescriptorSize       = 32
+)
+
+func (t ResourceType) String() string {
+	switch t {
+	case CmResourceTypeNull:
+		return "Null"
+	case CmResourceTypePort:
+		return "Port"
+	case CmResourceTypeInterrupt:
+		return "Interrupt"
+	case CmResourceTypeMemory:
+		return "Memory"
+	case CmResourceTypeDma:
+		return "Dma"
+	case CmResourceTypeDeviceSpecific:
+		return "DeviceSpecific"
+	case CmResourceTypeBusNumber:
+		return "BusNumber"
+	case CmResourceTypeMemoryLarge:
+		return "MemoryLarge"
+	case CmResourceTypeNonArbitrated:
+		return "ConfigData"
+	case CmResourceTypeDevicePrivate:
+		return "DevicePrivate"
+	case CmResourceTypePcCardConfig:
+		return "PcCardConfig"
+	case CmResourceTypeMfCardConfig:
+		return "MfCardConfig"
+	case CmResourceTypeConnection:
+		return "Connection"
+	default:
+		return fmt.Sprintf("ResourceType(%d)", uint8(t))
+	}
+}
+
+// ShareDisposition 对应 CM_SHARE_DISPOSITION 枚举
+type ShareDisposition uint8
+
+const (
+	CmResourceShareUndetermined    ShareDisposition = 0
+	CmResourceShareDeviceExclusive ShareDisposition = 1
+	CmResourceShareDriverExclusive ShareDisposition = 2
+	CmResourceShareShared          ShareDisposition = 3
+)
+
+func (s ShareDisposition) String() string {
+	switch s {
+	case CmResourceShareUndetermined:
+		return "Undetermined"
+	case CmResourceShareDeviceExclusive:
+		return "DeviceExclusive"
+	case CmResourceShareDriverExclusive:
+		return "DriverExclusive"
+	case CmResourceShareShared:
+		return "Shared"
+	default:
+		return fmt.Sprintf("ShareDisposition(%d)", uint8(s))
+	}
+}
+
+// ResourceList 对应 REG_RESOURCE_LIST (CM_RESOURCE_LIST)
+type ResourceList struct {
+	List []*FullResourceDescriptor
+}
+
+// FullResourceDescriptor 对应 REG_FULL_RESOURCE_DESCRIPTOR (CM_FULL_RESOURCE_DESCRIPTOR)
+type FullResourceDescriptor struct {
+	InterfaceType InterfaceType
+	BusNumber     uint32
+	Version       uint16
+	Revision      uint16
+	Descriptors   []*PartialResourceDescriptor
+}
+
+// PartialResourceDescriptor 对应 CM_PARTIAL_RESOURCE_DESCRIPTOR,
+// 不同资源类型共用同一结构,只有与 Type 对应的字段有意义
+type PartialResourceDescriptor struct {
+	Type             ResourceType
+	ShareDisposition ShareDisposition
+	Flags            uint16
+	// Port / Memory / MemoryLarge / BusNumber
+	Start  uint64
+	Length uint64
+	// Interrupt
+	Level    uint32
+	Group    uint16
+	Vector   uint32
+	Affinity uint64
+	// Dma
+	Channel uint32
+	Port    uint32
+	// DevicePrivate / DeviceSpecific / Connection 等无法细分的原始数据
+	Data []byte
+}
+
+// ResourceRequirementsList 对应 REG_RESOURCE_REQUIREMENTS_LIST (IO_RESOURCE_REQUIREMENTS_LIST)
+type ResourceRequirementsList struct {
+	InterfaceType InterfaceType
+	BusNumber     uint32
+	SlotNumber    uint32
+	Alternatives  []*IoResourceList
+}
+
+// IoResourceList 对应 IO_RESOURCE_LIST,表示一组可选的资源配置
+type IoResourceList struct {
+	Version     uint16
+	Revision    uint16
+	Descriptors []*IoResourceDescriptor
+}
+
+// IoResourceDescriptor 对应 IO_RESOURCE_DESCRIPTOR,
+// Minimum/Maximum 对端口和内存为地址,对中断为向量,对 DMA 为通道,对总线号为总线号
+type IoResourceDescriptor struct {
+	Option           uint8
+	Type             ResourceType
+	ShareDisposition ShareDisposition
+	Flags            uint16
+	Length           uint32
+	Alignment        uint32
+	Minimum          uint64
+	Maximum          uint64
+	Affinity         uint64
+	Data             []byte
+}
+
+var errResourceTruncated = errors.New("资源描述数据长度不足")
+
+// resourceReader 按小端字节序顺序读取资源描述结构
+type resourceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *resourceReader) need(n int) error {
+	if r.pos+n > len(r.data) {
+		return errResourceTruncated
+	}
+	return nil
+}
+func (r *resourceReader) u16(off int) uint16 {
+	return binary.LittleEndian.Uint16(r.data[r.pos+off:])
+}
+func (r *resourceReader) u32(off int) uint32 {
+	return binary.LittleEndian.Uint32(r.data[r.pos+off:])
+}
+func (r *resourceReader) u64(off int) uint64 {
+	return binary.LittleEndian.Uint64(r.data[r.pos+off:])
+}
+
+// ParseResourceList 解析 REG_RESOURCE_LIST 数据
+func ParseResourceList(data []byte) (*ResourceList, error) {
+	var list *ResourceList
+	err := parseWithDescriptorSize(data, func(r *resourceReader, descSize int) error {
+		if err := r.need(4); err != nil {
+			return err
+		}
+		count := r.u32(0)
+		r.pos += 4
+		result := &ResourceList{}
+		for i := 0; i < int(count); i++ {
+			full, err := r.fullResourceDescriptor(descSize)
+			if err != nil {
+				return err
+			}
+			result.List = append(result.List, full)
+		}
+		list = result
+		return nil
+	})
+	return list, err
+}
+
+// ParseFullResourceDescriptor 解析 REG_FULL_RESOURCE_DESCRIPTOR 数据
+func ParseFullResourceDescriptor(data []byte) (*FullResourceDescriptor, error) {
+	var full *FullResourceDescriptor
+	err := parseWithDescriptorSize(data, func(r *resourceReader, descSize int) error {
+		result, err := r.fullResourceDescriptor(descSize)
+		if err != nil {
+			return err
+		}
+		full = result
+		return nil
+	})
+	return full, err
+}
+
+// parseWithDescriptorSize 分别按 64 位和 32 位的描述符布局解析,
+// 优先采用恰好消耗全部数据的结果
+func parseWithDescriptorSize(data []byte, parse func(r *resourceReader, descSize int) error) error {
+	var firstErr error
+	fallback := -1
+	for _, size := range []int{partialResourceDescriptorSizeX, partialResourceDescriptorSize} {
+		r := &resourceReader{data: data}
+		err := parse(r, size)
+		if err == nil && r.pos == len(data) {
+			return nil
+		}
+		if err == nil && fallback == -1 {
+			fallback = size
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if fallback != -1 {
+		return parse(&resourceReader{data: data}, fallback)
+	}
+	return firstErr
+}
+
+// parseResourceValue 按注册表值类型解析硬件资源数据,失败时返回 nil
+func parseResourceValue(dataType int, data []byte) interface{} {
+	switch dataType {
+	case RegResourceList:
+		if v, err := ParseResourceList(data); err == nil {
+			return v
+		}
+	case RegFullResourceDescriptor:
+		if v, err := ParseFullResourceDescriptor(data); err == nil {
+			return v
+		}
+	case RegResourceRequirementsList:
+		if v, err := ParseResourceRequirementsList(data); err == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func (r *resourceReader) fullResourceDescriptor(descSize int) (*FullResourceDescriptor, error) {
+	if err := r.need(16); err != nil {
+		return nil, err
+	}
+	full := &FullResourceDescriptor{
+		InterfaceType: InterfaceType(int32(r.u32(0))),
+		BusNumber:     r.u32(4),
+		Version:       r.u16(8),
+		Revision:      r.u16(10),
+	}
+	count := r.u32(12)
+	r.pos += 16
+	for i := 0; i < int(count); i++ {
+		if err := r.need(descSize); err != nil {
+			return nil, err
+		}
+		desc := r.partialResourceDescriptor(descSize)
+		r.pos += descSize
+		if desc.Type == CmResourceTypeDeviceSpecific {
+			// 设备相关数据紧跟在描述符之后
+			size := int(binary.LittleEndian.Uint32(desc.Data))
+			if err := r.need(size); err != nil {
+				return nil, err
+			}
+			desc.Data = r.data[r.pos : r.pos+size]
+			r.pos += size
+		}
+		full.Descriptors = append(full.Descriptors, desc)
+	}
+	return full, nil
+}
+
+func (r *resourceReader) partialResourceDescriptor(descSize int) *PartialResourceDescriptor {
+	desc := &PartialResourceDescriptor{
+		Type:             ResourceType(r.data[r.pos]),
+		ShareDisposition: ShareDisposition(r.data[r.pos+1]),
+		Flags:            r.u16(2),
+	}
+	switch desc.Type {
+	case CmResourceTypePort, CmResourceTypeMemory:
+		desc.Start = r.u64(4)
+		desc.Length = uint64(r.u32(12))
+	case CmResourceTypeMemoryLarge:
+		desc.Start = r.u64(4)
+		desc.Length = uint64(r.u32(12))
+		switch {
+		case desc.Flags&cmResourceMemoryLarge40 != 0:
+			desc.Length <<= 8
+		case desc.Flags&cmResourceMemoryLarge48 != 0:
+			desc.Length <<= 16
+		case desc.Flags&cmResourceMemoryLarge64 != 0:
+			desc.Length <<= 32
+		}
+	case CmResourceTypeInterrupt:
+		desc.Level = uint32(r.u16(4))
+		desc.Group = r.u16(6)
+		desc.Vector = r.u32(8)
+		if descSize == partialResourceDescriptorSizeX {
+			desc.Affinity = r.u64(12)
+		} else {
+			desc.Affinity = uint64(r.u32(12))
+		}
+	case CmResourceTypeDma:
+		desc.Channel = r.u32(4)
+		desc.Port = r.u32(8)
+	case CmResourceTypeBusNumber:
+		desc.Start = uint64(r.u32(4))
+		desc.Length = uint64(r.u32(8))
+	default:
+		desc.Data = r.data[r.pos+4 : r.pos+descSize]
+	}
+	return desc
+}
+
+// ParseResourceRequirementsList 解析 REG_RESOURCE_REQUIREMENTS_LIST 数据
+func ParseResourceRequirementsList(data []byte) (*ResourceRequirementsList, error) {
+	r := &resourceReader{data: data}
+	if err := r.need(32); err != nil {
+		return nil, err
+	}
+	listSize := r.u32(0)
+	if int(listSize) > len(data) {
+		return nil, errResourceTruncated
+	}
+	result := &ResourceRequirementsList{
+		InterfaceType: InterfaceType(int32(r.u32(4))),
+		BusNumber:     r.u32(8),
+		SlotNumber:    r.u32(12),
+	}
+	alternatives := r.u32(28)
+	r.pos += 32
+	for i := 0; i < int(alternatives); i++ {
+		if err := r.need(8); err != nil {
+			return nil, err
+		}
+		list := &IoResourceList{
+			Version:  r.u16(0),
+			Revision: r.u16(2),
+		}
+		count := r.u32(4)
+		r.pos += 8
+		for j := 0; j < int(count); j++ {
+			if err := r.need(ioResourceDescriptorSize); err != nil {
+				return nil, err
+			}
+			list.Descriptors = append(list.Descriptors, r.ioResourceDescriptor())
+			r.pos += ioResourceDescriptorSize
+		}
+		result.Alternatives = append(result.Alternatives, list)
+	}
+	return result, nil
+}
+
+func (r *resourceReader) ioResourceDescriptor() *IoResourceDescriptor {
+	desc := &IoResourceDescriptor{
+		Option:           r.data[r.pos],
+		Type:             ResourceType(r.data[r.pos+1]),
+		ShareDisposition: ShareDisposition(r.data[r.pos+2]),
+		Flags:            r.u16(4),
+	}
+	switch desc.Type {
+	case CmResourceTypePort, CmResourceTypeMemory, CmResourceTypeMemoryLarge:
+		desc.Length = r.u32(8)
+		desc.Alignment = r.u32(12)
+		desc.Minimum = r.u64(16)
+		desc.Maximum = r.u64(24)
+	case CmResourceTypeInterrupt:
+		desc.Minimum = uint64(r.u32(8))
+		desc.Maximum = uint64(r.u32(12))
+		desc.Affinity = r.u64(20)
+	case CmResourceTypeDma:
+		desc.Minimum = uint64(r.u32(8))
+		desc.Maximum = uint64(r.u32(12))
+	case CmResourceTypeBusNumber:
+		desc.Length = r.u32(8)
+		desc.Minimum = uint64(r.u32(12))
+		desc.Maximum = uint64(r.u32(16))
+	default:
+		desc.Data = r.data[r.pos+8 : r.pos+ioResourceDescriptorSize]
+	}
+	return desc
+}
+
+func (l *ResourceList) String() string {
+	parts := make([]string, 0, len(l.List))
+	for _, full := range l.List {
+		parts = append(parts, full.String())
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (f *FullResourceDescriptor) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s Bus %d (Version %d.%d)", f.InterfaceType, f.BusNumber, f.Version, f.Revision)
+	for _, d := range f.Descriptors {
+		b.WriteString("\n  ")
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
+
+func (d *PartialResourceDescriptor) String() string {
+	var detail string
+	switch d.Type {
+	case CmResourceTypePort, CmResourceTypeMemory, CmResourceTypeMemoryLarge:
+		end := d.Start
+		if d.Length > 0 {
+			end = d.Start + d.Length - 1
+		}
+		detail = fmt.Sprintf("0x%X-0x%X (Length 0x%X)", d.Start, end, d.Length)
+	case CmResourceTypeInterrupt:
+		detail = fmt.Sprintf("Level %d Vector %d Group %d Affinity 0x%X", d.Level, d.Vector, d.Group, d.Affinity)
+	case CmResourceTypeDma:
+		detail = fmt.Sprintf("Channel %d Port %d", d.Channel, d.Port)
+	case CmResourceTypeBusNumber:
+		detail = fmt.Sprintf("Start %d Length %d", d.Start, d.Length)
+	default:
+		detail = fmt.Sprintf("Data % X", d.Data)
+	}
+	return fmt.Sprintf("%s: %s %s Flags 0x%X", d.Type, detail, d.ShareDisposition, d.Flags)
+}
+
+func (l *ResourceRequirementsList) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s Bus %d Slot %d", l.InterfaceType, l.BusNumber, l.SlotNumber)
+	for i, alt := range l.Alternatives {
+		fmt.Fprintf(&b, "\n  Alternative %d (Version %d.%d)", i, alt.Version, alt.Revision)
+		for _, d := range alt.Descriptors {
+			b.WriteString("\n    ")
+			b.WriteString(d.String())
+		}
+	}
+	return b.String()
+}
+
+func (d *IoResourceDescriptor) String() string {
+	var detail string
+	switch d.Type {
+	case CmResourceTypePort, CmResourceTypeMemory, CmResourceTypeMemoryLarge:
+		detail = fmt.Sprintf("0x%X-0x%X (Length 0x%X Alignment 0x%X)", d.Minimum, d.Maximum, d.Length, d.Alignment)
+	case CmResourceTypeInterrupt:
+		detail = fmt.Sprintf("Vector %d-%d Affinity 0x%X", d.Minimum, d.Maximum, d.Affinity)
+	case CmResourceTypeDma:
+		detail = fmt.Sprintf("Channel %d-%d", d.Minimum, d.Maximum)
+	case CmResourceTypeBusNumber:
+		detail = fmt.Sprintf("Bus %d-%d (Length %d)", d.Minimum, d.Maximum, d.Length)
+	default:
+		detail = fmt.Sprintf("Data % X", d.Data)
+	}
+	return fmt.Sprintf("%s%s: %s %s Flags 0x%X", ioResourceOption(d.Option), d.Type, detail, d.ShareDisposition, d.Flags)
+}
+
+func ioResourceOption(option uint8) string {
+	switch {
+	case option&0x8 != 0:
+		return "[Alternative] "
+	case option&0x1 != 0:
+		return "[Preferred] "
+	case option&0x2 != 0:
+		return "[Default] "
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,327 @@
+package registry
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchField 为搜索的范围,可以组合使用
+type SearchField int
+
+const (
+	SearchKeyNames SearchField = 1 << iota
+	SearchValueNames
+	SearchData
+	SearchAll = SearchKeyNames | SearchValueNames | SearchData
+)
+
+func (f SearchField) String() string {
+	switch f {
+	case SearchKeyNames:
+		return "key"
+	case SearchValueNames:
+		return "value"
+	case SearchData:
+		return "data"
+	}
+	return fmt.Sprintf("SearchField(%d)", int(f))
+}
+
+// 二进制数据的编码
+const (
+	EncodingASCII   = "ascii"
+	EncodingUTF16LE = "utf-16le"
+)
+
+// defaultSearchContext 为 SearchOptions.Context 为 0 时匹配前后保留的字符数
+const defaultSearchContext = 32
+
+// SearchOptions 为搜索条件
+type SearchOptions struct {
+	// Pattern 为要查找的文本,Regexp 为 true 时为正则表达式
+	Pattern       string
+	Regexp        bool
+	CaseSensitive bool
+	// Fields 为搜索范围,为 0 时搜索键名、值名与数据
+	Fields SearchField
+	// Binary 为 true 时同时以 ASCII 与 UTF-16LE 两种编码搜索 REG_BINARY 等非文本数据
+	Binary bool
+	// Types 为值类型过滤(如 RegSZ、RegBin),为空时不过滤。设置后不再搜索键名
+	Types []int
+	// Since 与 Until 按键的最后写入时间过滤,零值表示不限制
+	Since time.Time
+	Until time.Time
+	// Scope 为限定搜索范围的路径查询,语法见 CompileQuery,为空时搜索所有键
+	Scope string
+	// Context 为匹配前后保留的字符数,为 0 时为 32
+	Context int
+}
+
+// SearchHit 为一个搜索结果
+type SearchHit struct {
+	// Hive 为 SearchHives 中 hive 的挂载路径
+	Hive  string
+	Path  string
+	Key   *RegistryKey
+	Value *RegistryValue
+	Field SearchField
+	// Text 为被搜索的文本,字符串数组中的每一项单独搜索;二进制数据的匹配不设置 Text
+	Text string
+	// Encoding 为二进制数据匹配时使用的编码,文本匹配时为空
+	Encoding string
+	// Offset 为匹配在 Text 中的字节位置,二进制数据匹配时为在原始数据中的字节位置
+	Offset  int
+	Match   string
+	Context string
+}
+
+// Searcher 为编译后的搜索条件,可以在多个 hive 上重复使用
+type Searcher struct {
+	opts    SearchOptions
+	re      *regexp.Regexp
+	scope   *Query
+	context int
+}
+
+// NewSearcher 编译搜索条件
+func NewSearcher(opts SearchOptions) (*Searcher, error) {
+	expr := opts.Pattern
+	if !opts.Regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !opts.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQuerySyntax, err)
+	}
+	scope := opts.Scope
+	if scope == "" {
+		scope = "**"
+	}
+	q, err := CompileQuery(scope)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Fields == 0 {
+		opts.Fields = SearchAll
+	}
+	s := &Searcher{opts: opts, re: re, scope: q, context: opts.Context}
+	if s.context <= 0 {
+		s.context = defaultSearchContext
+	}
+	return s, nil
+}
+
+// Search 在以 root 为起点的所有键中搜索,惰性地返回结果
+func (s *Searcher) Search(root *RegistryKey) iter.Seq[*SearchHit] {
+	return s.search(s.scope.Match(root))
+}
+
+// SearchHives 在多个挂载的 hive 上搜索,hives 的键为挂载路径,与 Query.MatchHives 相同
+func (s *Searcher) SearchHives(hives map[string]*Registry) iter.Seq[*SearchHit] {
+	return s.search(s.scope.MatchHives(hives))
+}
+
+func (s *Searcher) search(matches iter.Seq[*Match]) iter.Seq[*SearchHit] {
+	return func(yield func(*SearchHit) bool) {
+		for m := range matches {
+			if !s.inTimeRange(m.Key.Timestamp()) {
+				continue
+			}
+			if !s.searchKey(m, yield) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Searcher) inTimeRange(t time.Time) bool {
+	if !s.opts.Since.IsZero() && t.Before(s.opts.Since) {
+		return false
+	}
+	if !s.opts.Until.IsZero() && t.After(s.opts.Until) {
+		return false
+	}
+	return true
+}
+
+func (s *Searcher) searchKey(m *Match, yield func(*SearchHit) bool) bool {
+	hit := func(value *RegistryValue, field SearchField) *SearchHit {
+		return &SearchHit{Hive: m.Hive, Path: m.Path, Key: m.Key, Value: value, Field: field}
+	}
+	values := []*RegistryValue{m.Value}
+	if m.Value == nil {
+		if s.opts.Fields&SearchKeyNames != 0 && len(s.opts.Types) == 0 {
+			if !s.matchText(hit(nil, SearchKeyNames), m.Key.Name(), yield) {
+				return false
+			}
+		}
+		values = m.Key.Values()
+	}
+	for _, v := range values {
+		if len(s.opts.Types) > 0 && !slices.Contains(s.opts.Types, v.Value_type_ori()) {
+			continue
+		}
+		if s.opts.Fields&SearchValueNames != 0 {
+			name := ""
+			if v.Vkrecord.Has_name() {
+				name = v.Vkrecord.Name()
+			}
+			if !s.matchText(hit(v, SearchValueNames), name, yield) {
+				return false
+			}
+		}
+		if s.opts.Fields&SearchData == 0 {
+			continue
+		}
+		texts, isText := searchTexts(v)
+		for _, text := range texts {
+			if !s.matchText(hit(v, SearchData), text, yield) {
+				return false
+			}
+		}
+		if !isText && s.opts.Binary {
+			if !s.matchBinary(hit(v, SearchData), v, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// searchTexts 返回值数据的文本形式:字符串与字符串数组的每一项、整数的十进制形式,
+// 其他类型的数据返回 false,由二进制搜索处理
+func searchTexts(v *RegistryValue) ([]string, bool) {
+	t := v.Value_type_ori()
+	switch {
+	case slices.Contains(stringTypes, t) || slices.Contains(stringArrayTypes, t):
+		s, err := v.AsStrings()
+		if err != nil {
+			return nil, true
+		}
+		return s, true
+	case slices.Contains(int32Types, t):
+		n, err := v.AsInt32()
+		if err != nil {
+			return nil, true
+		}
+		return []string{strconv.FormatUint(uint64(n), 10)}, true
+	case slices.Contains(int64Types, t):
+		n, err := v.AsInt64()
+		if err != nil {
+			return nil, true
+		}
+		return []string{strconv.FormatUint(n, 10)}, true
+	}
+	return nil, false
+}
+
+func (s *Searcher) matchText(base *SearchHit, text string, yield func(*SearchHit) bool) bool {
+	for _, loc := range s.re.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		hit := *base
+		hit.Text = text
+		hit.Offset = loc[0]
+		hit.Match = text[loc[0]:loc[1]]
+		hit.Context = s.contextOf(text, loc[0], loc[1])
+		if !yield(&hit) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchBinary 把原始数据分别按单字节和两种对齐方式的 UTF-16LE 转换为文本后搜索,
+// 每个字节或 UTF-16 码元对应一个字符,因此匹配位置可以换算回原始数据中的偏移
+func (s *Searcher) matchBinary(base *SearchHit, v *RegistryValue, yield func(*SearchHit) bool) bool {
+	data := rawValueData(v)
+	if len(data) == 0 {
+		return true
+	}
+	views := []struct {
+		encoding string
+		start    int
+		width    int
+	}{
+		{EncodingASCII, 0, 1},
+		{EncodingUTF16LE, 0, 2},
+		{EncodingUTF16LE, 1, 2},
+	}
+	for _, view := range views {
+		var sb strings.Builder
+		for i := view.start; i+view.width <= len(data); i += view.width {
+			if view.width == 1 {
+				sb.WriteRune(rune(data[i]))
+			} else {
+				sb.WriteRune(rune(uint16(data[i]) | uint16(data[i+1])<<8))
+			}
+		}
+		text := sb.String()
+		for _, loc := range s.re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			hit := *base
+			hit.Encoding = view.encoding
+			hit.Offset = view.start + utf8.RuneCountInString(text[:loc[0]])*view.width
+			hit.Match = text[loc[0]:loc[1]]
+			hit.Context = printable(s.contextOf(text, loc[0], loc[1]))
+			if !yield(&hit) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rawValueData 返回值的原始数据,数据损坏时返回 nil
+func rawValueData(v *RegistryValue) (data []byte) {
+	defer func() {
+		if recover() != nil {
+			data = nil
+		}
+	}()
+	return v.Vkrecord.raw_data(0)
+}
+
+// contextOf 返回匹配前后各 s.context 个字符组成的文本
+func (s *Searcher) contextOf(text string, start, end int) string {
+	for i := 0; i < s.context && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	for i := 0; i < s.context && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return text[start:end]
+}
+
+// printable 把控制字符替换为 '.',用于显示二进制数据的上下文
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7F && r < 0xA0) || r == utf8.RuneError {
+			return '.'
+		}
+		return r
+	}, s)
+}
+
+// Search 以该 hive 的根键为起点搜索
+func (r *Registry) Search(opts SearchOptions) (iter.Seq[*SearchHit], error) {
+	s, err := NewSearcher(opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.Search(r.Root()), nil
+}
@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// searchBlob 返回在已知偏移处包含 "Secret" 的二进制数据:ASCII 位于 2,
+// UTF-16LE 位于偶数偏移 16 与奇数偏移 33,其余字节为 0xFF
+func searchBlob() []byte {
+	data := bytes.Repeat([]byte{0xFF}, 64)
+	copy(data[2:], "Secret")
+	copy(data[16:], encodeUTF16("Secret", false))
+	copy(data[33:], encodeUTF16("Secret", false))
+	return data
+}
+
+func searchTestHive() *Registry {
+	root := &buildKey{name: "ROOT"}
+	old := root.add("Old")
+	old.timestamp = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old.values = []buildValue{{name: "blob", typ: RegBin, data: searchBlob()}}
+	recent := root.add("New")
+	recent.timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent.values = []buildValue{
+		{name: "blob", typ: RegBin, data: searchBlob()},
+		stringValue("note", "top secret"),
+	}
+	root.add("SecretStore").timestamp = recent.timestamp
+	return NewRegistryFromBytes(buildHive(root, "SEARCH"))
+}
+
+// hitStrings 把结果格式化为 "路径@值名 字段 编码:偏移" 并排序
+func hitStrings(t *testing.T, reg *Registry, opts SearchOptions) []string {
+	t.Helper()
+	seq, err := reg.Search(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, 0)
+	for hit := range seq {
+		s := hit.Path
+		if hit.Value != nil {
+			s += "@" + hit.Value.Name()
+		}
+		s += fmt.Sprintf(" %s %s:%d", hit.Field, hit.Encoding, hit.Offset)
+		result = append(result, s)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestSearchBinary(t *testing.T) {
+	reg := searchTestHive()
+	binary := func(path string) []string {
+		return []string{
+			path + "@blob data ascii:2",
+			path + "@blob data utf-16le:16",
+			path + "@blob data utf-16le:33",
+		}
+	}
+	text := []string{"New@note data :4"}
+	key := []string{"SecretStore key :0"}
+	after := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts SearchOptions
+		want []string
+	}{
+		{"text only", SearchOptions{Pattern: "secret"}, slices.Concat(text, key)},
+		{"binary", SearchOptions{Pattern: "secret", Binary: true}, slices.Concat(binary("New"), text, binary("Old"), key)},
+		{"case sensitive", SearchOptions{Pattern: "secret", Binary: true, CaseSensitive: true}, text},
+		{"regexp", SearchOptions{Pattern: "S.CR.T", Regexp: true, Binary: true, Fields: SearchData}, slices.Concat(binary("New"), text, binary("Old"))},
+		{"types", SearchOptions{Pattern: "secret", Binary: true, Types: []int{RegBin}}, slices.Concat(binary("New"), binary("Old"))},
+		{"since", SearchOptions{Pattern: "secret", Binary: true, Since: after}, slices.Concat(binary("New"), text, key)},
+		{"until", SearchOptions{Pattern: "secret", Binary: true, Until: after}, binary("Old")},
+		{"since and types", SearchOptions{Pattern: "secret", Binary: true, Since: after, Types: []int{RegSZ}}, text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hitStrings(t, reg, tt.opts); !slices.Equal(got, tt.want) {
+				t.Fatalf("结果为 %q,应为 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchBinaryMatch(t *testing.T) {
+	seq, err := searchTestHive().Search(SearchOptions{Pattern: "secret", Binary: true, Scope: "Old", Context: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := searchBlob()
+	count := 0
+	for hit := range seq {
+		count++
+		if hit.Match != "Secret" || hit.Text != "" {
+			t.Fatalf("匹配为 %q,文本为 %q", hit.Match, hit.Text)
+		}
+		// 按编码从原始数据中的偏移处取回匹配的内容
+		raw := data[hit.Offset : hit.Offset+len("Secret")]
+		if hit.Encoding == EncodingUTF16LE {
+			raw = data[hit.Offset : hit.Offset+2*len("Secret")]
+			if !bytes.Equal(raw, encodeUTF16("Secret", false)) {
+				t.Fatalf("偏移 %d 处为 %x", hit.Offset, raw)
+			}
+		} else if string(raw) != "Secret" {
+			t.Fatalf("偏移 %d 处为 %q", hit.Offset, raw)
+		}
+		if want := "ÿÿSecretÿÿ"; hit.Encoding == EncodingASCII && hit.Context != want {
+			t.Fatalf("上下文为 %q,应为 %q", hit.Context, want)
+		}
+	}
+	if count != 3 {
+		t.Fatalf("共 %d 个结果,应为 3 个", count)
+	}
+}
@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSID 解析二进制形式的 SID,返回 "S-1-5-21-..." 形式的字符串与 SID 占用的字节数
+func ParseSID(data []byte) (string, int, error) {
+	if len(data) < 8 {
+		return "", 0, fmt.Errorf("%w: SID 至少需要 8 字节,实际为 %d 字节", ErrCorrupt, len(data))
+	}
+	if data[0] != 1 {
+		return "", 0, fmt.Errorf("%w: 不支持的 SID 版本 %d", ErrCorrupt, data[0])
+	}
+	count := int(data[1])
+	size := 8 + count*4
+	if count > 15 || len(data) < size {
+		return "", 0, fmt.Errorf("%w: SID 中有 %d 个子授权,但只有 %d 字节", ErrCorrupt, count, len(data))
+	}
+	// 标识符授权为 48 位大端整数,子授权为小端 DWORD
+	var authority uint64
+	for _, b := range data[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+	var sb strings.Builder
+	sb.WriteString("S-1-")
+	sb.WriteString(strconv.FormatUint(authority, 10))
+	for i := 0; i < count; i++ {
+		sb.WriteByte('-')
+		sb.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data[8+i*4:])), 10))
+	}
+	return sb.String(), size, nil
+}
+
+// wellKnownSIDs 为固定不变的知名 SID
+var wellKnownSIDs = map[string]string{
+	"S-1-0-0":      "NULL SID",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "LOCAL",
+	"S-1-2-1":      "CONSOLE LOGON",
+	"S-1-3-0":      "CREATOR OWNER",
+	"S-1-3-1":      "CREATOR GROUP",
+	"S-1-3-4":      "OWNER RIGHTS",
+	"S-1-5-1":      "NT AUTHORITY\\DIALUP",
+	"S-1-5-2":      "NT AUTHORITY\\NETWORK",
+	"S-1-5-3":      "NT AUTHORITY\\BATCH",
+	"S-1-5-4":      "NT AUTHORITY\\INTERACTIVE",
+	"S-1-5-6":      "NT AUTHORITY\\SERVICE",
+	"S-1-5-7":      "NT AUTHORITY\\ANONYMOUS LOGON",
+	"S-1-5-9":      "NT AUTHORITY\\ENTERPRISE DOMAIN CONTROLLERS",
+	"S-1-5-10":     "NT AUTHORITY\\SELF",
+	"S-1-5-11":     "NT AUTHORITY\\Authenticated Users",
+	"S-1-5-12":     "NT AUTHORITY\\RESTRICTED",
+	"S-1-5-13":     "NT AUTHORITY\\TERMINAL SERVER USER",
+	"S-1-5-14":     "NT AUTHORITY\\REMOTE INTERACTIVE LOGON",
+	"S-1-5-15":     "NT AUTHORITY\\This Organization",
+	"S-1-5-17":     "NT AUTHORITY\\IUSR",
+	"S-1-5-18":     "NT AUTHORITY\\SYSTEM",
+	"S-1-5-19":     "NT AUTHORITY\\LOCAL SERVICE",
+	"S-1-5-20":     "NT AUTHORITY\\NETWORK SERVICE",
+	"S-1-5-32-544": "BUILTIN\\Administrators",
+	"S-1-5-32-545": "BUILTIN\\Users",
+	"S-1-5-32-546": "BUILTIN\\Guests",
+	"S-1-5-32-547": "BUILTIN\\Power Users",
+	"S-1-5-32-548": "BUILTIN\\Account Operators",
+	"S-1-5-32-549": "BUILTIN\\Server Operators",
+	"S-1-5-32-550": "BUILTIN\\Print Operators",
+	"S-1-5-32-551": "BUILTIN\\Backup Operators",
+	"S-1-5-32-552": "BUILTIN\\Replicator",
+	"S-1-5-32-555": "BUILTIN\\Remote Desktop Users",
+	"S-1-5-32-556": "BUILTIN\\Network Configuration Operators",
+	"S-1-5-32-558": "BUILTIN\\Performance Monitor Users",
+	"S-1-5-32-559": "BUILTIN\\Performance Log Users",
+	"S-1-5-32-562": "BUILTIN\\Distributed COM Users",
+	"S-1-5-32-568": "BUILTIN\\IIS_IUSRS",
+	"S-1-5-32-569": "BUILTIN\\Cryptographic Operators",
+	"S-1-5-32-573": "BUILTIN\\Event Log Readers",
+	"S-1-5-32-578": "BUILTIN\\Hyper-V Administrators",
+	"S-1-5-32-580": "BUILTIN\\Remote Management Users",
+	"S-1-5-80-0":   "NT SERVICE\\ALL SERVICES",
+	"S-1-15-2-1":   "APPLICATION PACKAGE AUTHORITY\\ALL APPLICATION PACKAGES",
+	"S-1-15-2-2":   "APPLICATION PACKAGE AUTHORITY\\ALL RESTRICTED APPLICATION PACKAGES",
+	"S-1-16-0":     "Mandatory Label\\Untrusted Mandatory Level",
+	"S-1-16-4096":  "Mandatory Label\\Low Mandatory Level",
+	"S-1-16-8192":  "Mandatory Label\\Medium Mandatory Level",
+	"S-1-16-8448":  "Mandatory Label\\Medium Plus Mandatory Level",
+	"S-1-16-12288": "Mandatory Label\\High Mandatory Level",
+	"S-1-16-16384": "Mandatory Label\\System Mandatory Level",
+}
+
+// wellKnownRIDs 为域或本机 SID(S-1-5-21-...)下的知名 RID
+var wellKnownRIDs = map[string]string{
+	"500": "Administrator",
+	"501": "Guest",
+	"502": "krbtgt",
+	"503": "DefaultAccount",
+	"504": "WDAGUtilityAccount",
+	"512": "Domain Admins",
+	"513": "Domain Users",
+	"514": "Domain Guests",
+	"515": "Domain Computers",
+	"516": "Domain Controllers",
+	"518": "Schema Admins",
+	"519": "Enterprise Admins",
+	"520": "Group Policy Creator Owners",
+}
+
+// WellKnownSID 返回知名 SID 的名称,包括 S-1-5-21-... 下的知名 RID(如 -500 为 Administrator)
+func WellKnownSID(sid string) (string, bool) {
+	sid = strings.ToUpper(sid)
+	if name, ok := wellKnownSIDs[sid]; ok {
+		return name, true
+	}
+	if strings.HasPrefix(sid, "S-1-5-21-") {
+		if i := strings.LastIndexByte(sid, '-'); i >= 0 {
+			if name, ok := wellKnownRIDs[sid[i+1:]]; ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SIDResolver 把 SID 解析为账户名,无法解析时原样返回 SID。
+// plugins/profiles 中的 Resolver 实现了该接口
+type SIDResolver interface {
+	Name(sid string) string
+}
+
+// SecurityDescriptor 为键的 sk 记录中的安全描述符
+type SecurityDescriptor struct {
+	Control uint16
+	// Owner 与 Group 为 "S-1-..." 形式的所有者与主组 SID,描述符中没有时为空
+	Owner string
+	Group string
+	// Raw 为完整的自相对格式安全描述符,DACL 与 SACL 可以从中解析
+	Raw []byte
+}
+
+// seSelfRelative 为安全描述符控制字段中表示自相对格式的标志
+const seSelfRelative = 0x8000
+
+// ParseSecurityDescriptor 解析自相对格式的安全描述符中的所有者与主组
+func ParseSecurityDescriptor(data []byte) (*SecurityDescriptor, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("%w: 安全描述符至少需要 20 字节,实际为 %d 字节", ErrCorrupt, len(data))
+	}
+	if data[0] != 1 {
+		return nil, fmt.Errorf("%w: 不支持的安全描述符版本 %d", ErrCorrupt, data[0])
+	}
+	sd := &SecurityDescriptor{Control: binary.LittleEndian.Uint16(data[2:]), Raw: data}
+	if sd.Control&seSelfRelative == 0 {
+		return nil, fmt.Errorf("%w: 安全描述符不是自相对格式", ErrCorrupt)
+	}
+	for i, field := range []*string{&sd.Owner, &sd.Group} {
+		offset := binary.LittleEndian.Uint32(data[4+4*i:])
+		if offset == 0 {
+			continue
+		}
+		if uint64(offset) >= uint64(len(data)) {
+			return nil, fmt.Errorf("%w: SID 偏移 %#x 超出安全描述符范围", ErrCorrupt, offset)
+		}
+		sid, _, err := ParseSID(data[offset:])
+		if err != nil {
+			return nil, err
+		}
+		*field = sid
+	}
+	return sd, nil
+}
+
+// Names 用 resolver 把所有者与主组解析为账户名,resolver 为 nil 时只解析知名 SID
+func (d *SecurityDescriptor) Names(resolver SIDResolver) (owner, group string) {
+	name := func(sid string) string {
+		if sid == "" {
+			return ""
+		}
+		if resolver != nil {
+			return resolver.Name(sid)
+		}
+		if name, ok := WellKnownSID(sid); ok {
+			return name
+		}
+		return sid
+	}
+	return name(d.Owner), name(d.Group)
+}
+
+// SecurityDescriptor 返回键的安全描述符
+func (r *RegistryKey) SecurityDescriptor() (*SecurityDescriptor, error) {
+	if r == nil || r.Nkrecord == nil {
+		return nil, fmt.Errorf("%w: 键不存在", ErrNotFound)
+	}
+	sk := r.Nkrecord.Security_record()
+	if sk == nil {
+		return nil, fmt.Errorf("%w: %s 的 sk 记录", ErrNotFound, r.Path())
+	}
+	data := sk.Descriptor()
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s 的安全描述符超出 sk 记录", ErrCorrupt, r.Path())
+	}
+	return ParseSecurityDescriptor(data)
+}
@@ -0,0 +1,369 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FieldError 描述 Unmarshal 时某个字段的错误,Err 为 ErrNotFound、ErrTypeMismatch 等
+type FieldError struct {
+	Path  string // 注册表键路径
+	Name  string // 值或子键名称
+	Field string // 结构体字段名
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s\\%s (字段 %s): %v", e.Path, e.Name, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	uuidType     = reflect.TypeOf(uuid.UUID{})
+	keyType      = reflect.TypeOf((*RegistryKey)(nil))
+	compositeMap = reflect.TypeOf(map[string]interface{}{})
+)
+
+// regTag 为解析后的 `reg:"名称,选项..."` 标签
+//
+// 支持的选项:
+//
+//	optional   值或子键不存在时不报告错误
+//	filetime   按 FILETIME 解析 REG_QWORD / REG_BINARY / REG_FILETIME
+//	unix       按 Unix 秒数解析 REG_DWORD / REG_QWORD
+//	systemtime 按 16 字节的 SYSTEMTIME 结构解析 REG_BINARY
+//	keyname    字段接收键名(无需名称)
+//	timestamp  字段接收键的最后写入时间(无需名称)
+//
+// 名称为 "*" 的切片或映射字段接收当前键的所有子键,标签为 "-" 的字段会被忽略
+type regTag struct {
+	name    string
+	options map[string]bool
+}
+
+func parseRegTag(field reflect.StructField) (regTag, bool) {
+	tag, ok := field.Tag.Lookup("reg")
+	if tag == "-" {
+		return regTag{}, false
+	}
+	parts := strings.Split(tag, ",")
+	t := regTag{name: parts[0], options: make(map[string]bool)}
+	for _, opt := range parts[1:] {
+		t.options[strings.TrimSpace(opt)] = true
+	}
+	if !ok || t.name == "" && !t.options["keyname"] && !t.options["timestamp"] {
+		t.name = field.Name
+	}
+	return t, true
+}
+
+// Unmarshal 按结构体字段的 reg 标签把键下的值和子键填充到 v 中,v 必须是非 nil 的结构体指针。
+// 结构体字段对应同名子键,结构体切片和映射对应该子键下的所有子键,
+// *RegistryKey 字段接收子键本身。所有字段都会尽量填充,
+// 缺失或类型不符的字段以 *FieldError 的形式通过 errors.Join 合并返回
+func (r *RegistryKey) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Unmarshal 需要非 nil 的结构体指针")
+	}
+	if r == nil || r.Nkrecord == nil {
+		return ErrNotFound
+	}
+	var errs []error
+	r.unmarshalStruct(rv.Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func (r *RegistryKey) unmarshalStruct(rv reflect.Value, errs *[]error) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, ok := parseRegTag(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("reg") == "" {
+			// 嵌入的结构体与当前键共用值
+			r.unmarshalStruct(fv, errs)
+			continue
+		}
+		if err := r.unmarshalField(fv, tag, errs); err != nil {
+			if errors.Is(err, ErrNotFound) && tag.options["optional"] {
+				continue
+			}
+			*errs = append(*errs, &FieldError{Path: r.Path(), Name: tag.name, Field: field.Name, Err: err})
+		}
+	}
+}
+
+func (r *RegistryKey) unmarshalField(fv reflect.Value, tag regTag, errs *[]error) error {
+	switch {
+	case tag.options["keyname"]:
+		if fv.Kind() != reflect.String {
+			return fmt.Errorf("%w: keyname 只能用于 string 字段", ErrTypeMismatch)
+		}
+		fv.SetString(r.Name())
+		return nil
+	case tag.options["timestamp"]:
+		if fv.Type() != timeType {
+			return fmt.Errorf("%w: timestamp 只能用于 time.Time 字段", ErrTypeMismatch)
+		}
+		fv.Set(reflect.ValueOf(r.Timestamp()))
+		return nil
+	}
+
+	ft := fv.Type()
+	switch {
+	case ft == keyType:
+		sub := r.SubKey(tag.name)
+		if sub == nil {
+			return ErrNotFound
+		}
+		fv.Set(reflect.ValueOf(sub))
+		return nil
+	case isSubkeyStruct(ft):
+		sub := r.SubKey(tag.name)
+		if sub == nil {
+			return ErrNotFound
+		}
+		if ft.Kind() == reflect.Pointer {
+			fv.Set(reflect.New(ft.Elem()))
+			fv = fv.Elem()
+		}
+		sub.unmarshalStruct(fv, errs)
+		return nil
+	case (ft.Kind() == reflect.Slice || ft.Kind() == reflect.Map) && isSubkeyStruct(ft.Elem()):
+		parent := r
+		if tag.name != "*" {
+			parent = r.SubKey(tag.name)
+			if parent == nil {
+				return ErrNotFound
+			}
+		}
+		parent.unmarshalSubkeys(fv, errs)
+		return nil
+	}
+
+	value := r.Value(tag.name)
+	if value == nil {
+		return ErrNotFound
+	}
+	return value.unmarshalValue(fv, tag)
+}
+
+// isSubkeyStruct 判断字段类型是否对应子键,time.Time 等按值解析的结构体除外
+func isSubkeyStruct(t reflect.Type) bool {
+	if t == keyType {
+		return true
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && t != reflect.TypeOf(ResourceList{}) &&
+		t != reflect.TypeOf(FullResourceDescriptor{}) && t != reflect.TypeOf(ResourceRequirementsList{})
+}
+
+// unmarshalSubkeys 把所有子键解析为切片元素或以子键名为索引的映射元素
+func (r *RegistryKey) unmarshalSubkeys(fv reflect.Value, errs *[]error) {
+	ft := fv.Type()
+	elem := ft.Elem()
+	if ft.Kind() == reflect.Map {
+		if ft.Key().Kind() != reflect.String {
+			*errs = append(*errs, fmt.Errorf("%w: 子键映射的键必须为 string", ErrTypeMismatch))
+			return
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.MakeMap(ft))
+		}
+	}
+	for _, sub := range r.Subkeys() {
+		item := reflect.New(elem).Elem()
+		switch {
+		case elem == keyType:
+			item.Set(reflect.ValueOf(sub))
+		case elem.Kind() == reflect.Pointer:
+			item.Set(reflect.New(elem.Elem()))
+			sub.unmarshalStruct(item.Elem(), errs)
+		default:
+			sub.unmarshalStruct(item, errs)
+		}
+		if ft.Kind() == reflect.Map {
+			fv.SetMapIndex(reflect.ValueOf(sub.Name()).Convert(ft.Key()), item)
+		} else {
+			fv.Set(reflect.Append(fv, item))
+		}
+	}
+}
+
+// unmarshalValue 把值转换为字段的类型
+func (r *RegistryValue) unmarshalValue(fv reflect.Value, tag regTag) error {
+	ft := fv.Type()
+	switch {
+	case ft == timeType:
+		t, err := r.timeWithOptions(tag)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case ft == durationType:
+		d, err := r.AsDuration()
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case ft == uuidType:
+		id, err := r.AsGUID()
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(id))
+		return nil
+	case ft == compositeMap:
+		m, err := r.AsComposite()
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(m))
+		return nil
+	case ft == reflect.TypeOf((*ResourceList)(nil)):
+		l, err := r.AsResourceList()
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(l))
+		return nil
+	case ft == reflect.TypeOf((*FullResourceDescriptor)(nil)):
+		d, err := r.AsFullResourceDescriptor()
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(d))
+		return nil
+	case ft == reflect.TypeOf((*ResourceRequirementsList)(nil)):
+		l, err := r.AsResourceRequirementsList()
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(l))
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.String:
+		s, err := r.AsString()
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := r.AsBool()
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := r.AsInt64()
+		if err != nil {
+			return err
+		}
+		// 按字段宽度截断,DWORD 中的负数可以正确还原
+		fv.SetInt(int64(n))
+		if ft.Bits() < 64 {
+			fv.SetInt(fv.Int() << (64 - ft.Bits()) >> (64 - ft.Bits()))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := r.AsInt64()
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(n) {
+			return fmt.Errorf("%w: 数值 %d 超出字段范围", ErrTypeMismatch, n)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := r.AsFloat64()
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		return r.unmarshalSlice(fv)
+	case reflect.Interface:
+		v, err := r.decoded()
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		if !reflect.TypeOf(v).AssignableTo(ft) {
+			return fmt.Errorf("%w: 无法将 %T 赋值给 %s", ErrTypeMismatch, v, ft)
+		}
+		fv.Set(reflect.ValueOf(v))
+	default:
+		return fmt.Errorf("%w: 不支持的字段类型 %s", ErrTypeMismatch, ft)
+	}
+	return nil
+}
+
+func (r *RegistryValue) unmarshalSlice(fv reflect.Value) error {
+	var v interface{}
+	var err error
+	switch fv.Type().Elem().Kind() {
+	case reflect.Uint8:
+		v, err = r.AsBinary()
+	case reflect.String:
+		v, err = r.AsStrings()
+	case reflect.Bool:
+		v, err = r.AsBools()
+	case reflect.Uint32:
+		v, err = r.AsInt32s()
+	case reflect.Uint64:
+		v, err = r.AsInt64s()
+	case reflect.Float64:
+		v, err = r.AsFloat64s()
+	default:
+		return fmt.Errorf("%w: 不支持的字段类型 %s", ErrTypeMismatch, fv.Type())
+	}
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().ConvertibleTo(fv.Type()) {
+		return fmt.Errorf("%w: 无法将 %s 赋值给 %s", ErrTypeMismatch, rv.Type(), fv.Type())
+	}
+	fv.Set(rv.Convert(fv.Type()))
+	return nil
+}
+
+// timeWithOptions 按标签选项把值解析为时间
+func (r *RegistryValue) timeWithOptions(tag regTag) (time.Time, error) {
+	if tag.options["unix"] {
+		n, err := r.AsInt64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(n), 0).UTC(), nil
+	}
+	if tag.options["systemtime"] {
+		return r.AsSystemTime()
+	}
+	// filetime 为 AsTime 的默认解析方式
+	return r.AsTime()
+}
@@ -0,0 +1,494 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OblivionTime/go-registry/utils"
+)
+
+// ValidationCheck 为完整性检查的类别
+type ValidationCheck string
+
+const (
+	// CheckBaseBlock 为 base block 的签名、版本、文件类型、格式与 hive 大小,根键偏移无效时报告为 CheckPointer
+	CheckBaseBlock ValidationCheck = "base-block"
+	CheckChecksum  ValidationCheck = "checksum"
+	// CheckSequence 为主次序列号,不一致说明 hive 未完整写入,需要应用事务日志
+	CheckSequence ValidationCheck = "sequence"
+	// CheckHbin 为 hbin 的签名、偏移与大小
+	CheckHbin ValidationCheck = "hbin"
+	// CheckCell 为 cell 的大小、对齐、越界以及记录内的长度字段
+	CheckCell ValidationCheck = "cell"
+	// CheckPointer 为指向无效位置、空闲 cell 或类型不符的 cell 的指针
+	CheckPointer     ValidationCheck = "pointer"
+	CheckSubkeyCount ValidationCheck = "subkey-count"
+	// CheckParent 为子键的父键指针、根键标志以及子键列表构成的环
+	CheckParent ValidationCheck = "parent"
+	// CheckSecurity 为 sk 链表与引用计数
+	CheckSecurity ValidationCheck = "security"
+	// CheckHash 为 lf 的名称提示与 lh 的名称哈希
+	CheckHash ValidationCheck = "hash"
+)
+
+// ValidationIssue 为完整性检查发现的一个问题
+type ValidationIssue struct {
+	Check ValidationCheck
+	// Offset 为问题所在位置在文件中的偏移
+	Offset int64
+	// Path 为相关键的路径,与具体的键无关时为空
+	Path    string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("[%s] %#x: %s", i.Check, i.Offset, i.Message)
+	}
+	return fmt.Sprintf("[%s] %#x %s: %s", i.Check, i.Offset, i.Path, i.Message)
+}
+
+// Report 为 Validate 的结果与检查过程中的统计
+type Report struct {
+	Issues              []ValidationIssue
+	Bins                int
+	Cells               int
+	FreeCells           int
+	Keys                int
+	Values              int
+	SecurityDescriptors int
+}
+
+// OK 表示没有发现问题
+func (r Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Err 把所有问题合并为包装了 ErrCorrupt 的错误,没有问题时返回 nil
+func (r Report) Err() error {
+	errs := make([]error, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrCorrupt, issue))
+	}
+	return errors.Join(errs...)
+}
+
+// String 返回适合打印的检查结果
+func (r Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d 个 hbin,%d 个 cell(%d 个空闲),%d 个键,%d 个值,%d 个安全描述符,发现 %d 个问题",
+		r.Bins, r.Cells, r.FreeCells, r.Keys, r.Values, r.SecurityDescriptors, len(r.Issues))
+	for _, issue := range r.Issues {
+		sb.WriteString("\n")
+		sb.WriteString(issue.String())
+	}
+	return sb.String()
+}
+
+type validator struct {
+	buf    []byte
+	report *Report
+	// cells 为已分配 cell 的相对偏移与大小
+	cells map[uint32]int
+	keys  map[uint32]bool
+	// skRefs 为每个 sk 被键引用的次数
+	skRefs map[uint32]int
+	skSeen []uint32
+	// incomplete 表示有键因指针无效而无法访问,此时实际引用数可能小于引用计数
+	incomplete bool
+}
+
+// Validate 检查 hive 的完整性,用于判断 hive 是否被篡改或损坏:base block 的校验和与序列号、
+// hbin 的偏移与大小、cell 的对齐与越界,从根键开始遍历所有键检查子键列表与值列表中的指针、
+// 子键数量、父键指针、lf/lh 的名称哈希、sk 链表与引用计数。Validate 只读取原始数据,不会因数据损坏而 panic
+func Validate(r *Registry) Report {
+	var report Report
+	v := &validator{report: &report, cells: make(map[uint32]int), keys: make(map[uint32]bool), skRefs: make(map[uint32]int)}
+	if r != nil {
+		v.buf = r.Buffers
+	}
+	root, length, ok := v.baseBlock()
+	if !ok {
+		return report
+	}
+	v.bins(length)
+	if _, ok := v.key(root, 0xFFFFFFFF, ""); ok {
+		v.security()
+	}
+	return report
+}
+
+func (v *validator) issue(check ValidationCheck, offset int64, path, format string, args ...any) {
+	v.report.Issues = append(v.report.Issues, ValidationIssue{Check: check, Offset: offset, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) u32(pos int) uint32 { return binary.LittleEndian.Uint32(v.buf[pos:]) }
+
+func (v *validator) baseBlock() (root uint32, length int, ok bool) {
+	if len(v.buf) < baseBlockSize || string(v.buf[:4]) != "regf" {
+		v.issue(CheckBaseBlock, 0, "", "缺少 regf 签名或文件小于 base block")
+		return 0, 0, false
+	}
+	if primary, secondary := v.u32(0x4), v.u32(0x8); primary != secondary {
+		v.issue(CheckSequence, 0x4, "", "主序列号 %d 与次序列号 %d 不一致,hive 未完整写入,需要应用事务日志", primary, secondary)
+	}
+	if stored, sum := v.u32(0x1FC), baseBlockChecksum(v.buf[:baseBlockSize]); stored != sum {
+		v.issue(CheckChecksum, 0x1FC, "", "校验和为 %#x,应为 %#x", stored, sum)
+	}
+	if major, minor := v.u32(0x14), v.u32(0x18); major != 1 || minor < 2 || minor > 6 {
+		v.issue(CheckBaseBlock, 0x14, "", "不支持的版本 %d.%d", major, minor)
+	}
+	if typ := v.u32(0x1C); typ != 0 {
+		v.issue(CheckBaseBlock, 0x1C, "", "文件类型为 %d,不是主 hive 文件", typ)
+	}
+	if format := v.u32(0x20); format != 1 {
+		v.issue(CheckBaseBlock, 0x20, "", "文件格式为 %d,应为 1", format)
+	}
+	length = int(v.u32(0x28))
+	if length == 0 || length%hbinAlignment != 0 {
+		v.issue(CheckBaseBlock, 0x28, "", "hive 大小 %#x 不是 4K 的整数倍", length)
+	}
+	if baseBlockSize+length > len(v.buf) {
+		v.issue(CheckBaseBlock, 0x28, "", "hive 大小 %#x 超出文件大小,数据被截断", length)
+		length = len(v.buf) - baseBlockSize
+	}
+	return v.u32(0x24), length, true
+}
+
+// bins 依次检查 hbin 头部与其中的 cell,记录所有已分配的 cell 供指针检查使用
+func (v *validator) bins(length int) {
+	end := baseBlockSize + length
+	for pos := baseBlockSize; pos < end; {
+		if pos+hbinHeaderLen > end || string(v.buf[pos:pos+4]) != "hbin" {
+			v.issue(CheckHbin, int64(pos), "", "缺少 hbin 签名")
+			pos += hbinAlignment
+			continue
+		}
+		v.report.Bins++
+		if offset := v.u32(pos + 4); int(offset) != pos-baseBlockSize {
+			v.issue(CheckHbin, int64(pos+4), "", "hbin 偏移字段为 %#x,应为 %#x", offset, pos-baseBlockSize)
+		}
+		size := int(v.u32(pos + 8))
+		if size < hbinAlignment || size%hbinAlignment != 0 {
+			v.issue(CheckHbin, int64(pos+8), "", "hbin 大小 %#x 不是 4K 的整数倍", size)
+			pos += hbinAlignment
+			continue
+		}
+		if pos+size > end {
+			v.issue(CheckHbin, int64(pos+8), "", "hbin 大小 %#x 超出 hive 范围", size)
+			size = end - pos
+		}
+		for cell := pos + hbinHeaderLen; cell+4 <= pos+size; {
+			raw := int32(v.u32(cell))
+			n := int(raw)
+			if n < 0 {
+				n = -n
+			}
+			if n < 8 || n%8 != 0 {
+				v.issue(CheckCell, int64(cell), "", "cell 大小 %#x 无效或未按 8 字节对齐,跳过该 hbin 的剩余部分", n)
+				break
+			}
+			if cell+n > pos+size {
+				v.issue(CheckCell, int64(cell), "", "cell 大小 %#x 越过 hbin 的边界", n)
+				break
+			}
+			v.report.Cells++
+			if raw < 0 {
+				v.cells[uint32(cell-baseBlockSize)] = n
+			} else {
+				v.report.FreeCells++
+			}
+			cell += n
+		}
+		pos += size
+	}
+}
+
+// cell 返回相对偏移 offset 处已分配 cell 的数据部分,id 不为空时同时检查记录类型。
+// 指针无效时记录问题并返回 nil,from 为引用该指针的位置
+func (v *validator) cell(offset uint32, id string, from int64, path, what string) []byte {
+	size, ok := v.cells[offset]
+	if !ok {
+		v.issue(CheckPointer, from, path, "%s指针 %#x 不指向已分配的 cell", what, offset)
+		return nil
+	}
+	pos := baseBlockSize + int(offset)
+	data := v.buf[pos+4 : pos+size]
+	if id != "" && (len(data) < 2 || string(data[:2]) != id) {
+		v.issue(CheckPointer, from, path, "%s指针 %#x 指向的 cell 不是 %s 记录", what, offset, id)
+		return nil
+	}
+	return data
+}
+
+// key 检查 offset 处的 nk 记录及其子树,返回键名
+func (v *validator) key(offset, parent uint32, parentPath string) (string, bool) {
+	from := int64(baseBlockSize) + int64(parent) + 4
+	if parent == 0xFFFFFFFF {
+		from = 0x24
+	}
+	if v.keys[offset] {
+		v.issue(CheckParent, from, parentPath, "键 %#x 被多次引用,子键列表中存在环或共享的子键", offset)
+		return "", false
+	}
+	d := v.cell(offset, "nk", from, parentPath, "子键")
+	if d == nil {
+		return "", false
+	}
+	pos := int64(baseBlockSize) + int64(offset) + 4
+	if len(d) < 0x4C {
+		v.issue(CheckCell, pos, parentPath, "nk 记录过短")
+		return "", false
+	}
+	v.keys[offset] = true
+	v.report.Keys++
+
+	flags := binary.LittleEndian.Uint16(d[2:])
+	nameLength := int(binary.LittleEndian.Uint16(d[0x48:]))
+	if 0x4C+nameLength > len(d) {
+		v.issue(CheckCell, pos, parentPath, "键名长度 %d 超出 nk 记录", nameLength)
+		nameLength = len(d) - 0x4C
+	}
+	var name string
+	if flags&nkFlagCompName != 0 {
+		name = utils.DecodeWindows1252(d[0x4C : 0x4C+nameLength])
+	} else {
+		name = utils.DecodeUTF16(d[0x4C : 0x4C+nameLength])
+	}
+	path := name
+	if parent != 0xFFFFFFFF {
+		path = parentPath + "\\" + name
+	}
+
+	if parent == 0xFFFFFFFF {
+		if flags&nkFlagHiveEntry == 0 {
+			v.issue(CheckParent, pos, path, "根键缺少 KEY_HIVE_ENTRY 标志")
+		}
+	} else if p := binary.LittleEndian.Uint32(d[0x10:]); p != parent {
+		v.issue(CheckParent, pos+0x10, path, "父键指针为 %#x,实际父键为 %#x", p, parent)
+	}
+
+	if sk := binary.LittleEndian.Uint32(d[0x2C:]); v.cell(sk, "sk", pos+0x2C, path, "安全描述符") != nil {
+		if v.skRefs[sk] == 0 {
+			v.skSeen = append(v.skSeen, sk)
+		}
+		v.skRefs[sk]++
+	}
+	if classLength := int(binary.LittleEndian.Uint16(d[0x4A:])); classLength > 0 {
+		if c := v.cell(binary.LittleEndian.Uint32(d[0x30:]), "", pos+0x30, path, "类名"); c != nil && len(c) < classLength {
+			v.issue(CheckCell, pos+0x4A, path, "类名长度 %d 超出 cell 大小", classLength)
+		}
+	}
+
+	if count := int(binary.LittleEndian.Uint32(d[0x24:])); count > 0 {
+		if list := v.cell(binary.LittleEndian.Uint32(d[0x28:]), "", pos+0x28, path, "值列表"); list != nil {
+			if len(list) < 4*count {
+				v.issue(CheckCell, pos+0x24, path, "值列表只能容纳 %d 个值,值数量为 %d", len(list)/4, count)
+				count = len(list) / 4
+			}
+			for i := 0; i < count; i++ {
+				v.value(binary.LittleEndian.Uint32(list[4*i:]), pos+0x28, path)
+			}
+		}
+	}
+
+	count := int(binary.LittleEndian.Uint32(d[0x14:]))
+	if count == 0 {
+		return name, true
+	}
+	entries := v.subkeyList(binary.LittleEndian.Uint32(d[0x1C:]), pos+0x1C, path, false)
+	if len(entries) != count {
+		v.issue(CheckSubkeyCount, pos+0x14, path, "子键数量为 %d,子键列表中有 %d 项", count, len(entries))
+	}
+	if len(entries) < count {
+		v.incomplete = true
+	}
+	for _, e := range entries {
+		child, ok := v.key(e.offset, offset, path)
+		if !ok {
+			v.incomplete = true
+			continue
+		}
+		switch e.kind {
+		case "lf":
+			if hint, ok := nameHint(child); ok && hint != e.hint {
+				v.issue(CheckHash, e.from, path+"\\"+child, "lf 名称提示为 %#x,应为 %#x", e.hint, hint)
+			}
+		case "lh":
+			if hash := nameHash(child); hash != e.hint {
+				v.issue(CheckHash, e.from, path+"\\"+child, "lh 名称哈希为 %#x,应为 %#x", e.hint, hash)
+			}
+		}
+	}
+	return name, true
+}
+
+type subkeyEntry struct {
+	offset uint32
+	kind   string
+	hint   uint32
+	// from 为该项在文件中的位置
+	from int64
+}
+
+// subkeyList 读取子键列表中的所有项,ri 列表中的子列表只能为 li/lf/lh
+func (v *validator) subkeyList(offset uint32, from int64, path string, nested bool) []subkeyEntry {
+	d := v.cell(offset, "", from, path, "子键列表")
+	if d == nil {
+		return nil
+	}
+	pos := int64(baseBlockSize) + int64(offset) + 4
+	if len(d) < 4 {
+		v.issue(CheckCell, pos, path, "子键列表过短")
+		return nil
+	}
+	kind := string(d[:2])
+	count := int(binary.LittleEndian.Uint16(d[2:]))
+	stride := 4
+	switch kind {
+	case "lf", "lh":
+		stride = 8
+	case "li":
+	case "ri":
+		if nested {
+			v.issue(CheckPointer, pos, path, "ri 列表中嵌套了 ri 列表")
+			return nil
+		}
+	default:
+		v.issue(CheckPointer, from, path, "子键列表指针 %#x 指向的 cell 类型 %q 无效", offset, kind)
+		return nil
+	}
+	if 4+stride*count > len(d) {
+		v.issue(CheckCell, pos+2, path, "%s 列表只能容纳 %d 项,列表中的数量为 %d", kind, (len(d)-4)/stride, count)
+		count = (len(d) - 4) / stride
+	}
+	entries := make([]subkeyEntry, 0, count)
+	for i := 0; i < count; i++ {
+		p := 4 + stride*i
+		target := binary.LittleEndian.Uint32(d[p:])
+		if kind == "ri" {
+			entries = append(entries, v.subkeyList(target, pos+int64(p), path, true)...)
+			continue
+		}
+		e := subkeyEntry{offset: target, kind: kind, from: pos + int64(p)}
+		if stride == 8 {
+			e.hint = binary.LittleEndian.Uint32(d[p+4:])
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// nameHint 返回 lf 列表中的名称提示,即键名的前 4 个字符,名称包含非 ASCII 字符时不检查
+func nameHint(name string) (uint32, bool) {
+	var b [4]byte
+	for i, r := range name {
+		if r >= 0x80 {
+			return 0, false
+		}
+		if i < 4 {
+			b[i] = byte(r)
+		}
+	}
+	return binary.LittleEndian.Uint32(b[:]), true
+}
+
+// value 检查 vk 记录及其数据
+func (v *validator) value(offset uint32, from int64, path string) {
+	d := v.cell(offset, "vk", from, path, "值")
+	if d == nil {
+		return
+	}
+	pos := int64(baseBlockSize) + int64(offset) + 4
+	if len(d) < 0x14 {
+		v.issue(CheckCell, pos, path, "vk 记录过短")
+		return
+	}
+	v.report.Values++
+	if nameLength := int(binary.LittleEndian.Uint16(d[2:])); 0x14+nameLength > len(d) {
+		v.issue(CheckCell, pos, path, "值名长度 %d 超出 vk 记录", nameLength)
+	}
+	if binary.LittleEndian.Uint16(d[0x10:])&vkFlagTombstone != 0 {
+		return
+	}
+	length := binary.LittleEndian.Uint32(d[4:])
+	if length&0x80000000 != 0 {
+		if length-0x80000000 > 4 {
+			v.issue(CheckCell, pos+4, path, "内联数据长度 %d 超过 4 字节", length-0x80000000)
+		}
+		return
+	}
+	if length == 0 {
+		return
+	}
+	data := v.cell(binary.LittleEndian.Uint32(d[8:]), "", pos+8, path, "值数据")
+	if data == nil {
+		return
+	}
+	if length > 0x3fd8 && len(data) >= 8 && string(data[:2]) == "db" {
+		v.bigData(data, int64(baseBlockSize)+int64(binary.LittleEndian.Uint32(d[8:]))+4, length, path)
+		return
+	}
+	if int(length) > len(data) {
+		v.issue(CheckCell, pos+4, path, "数据长度 %d 超出数据 cell 的大小 %d", length, len(data))
+	}
+}
+
+// bigData 检查 db 记录的分段列表,每段最多 0x3fd8 字节
+func (v *validator) bigData(db []byte, pos int64, length uint32, path string) {
+	count := int(binary.LittleEndian.Uint16(db[2:]))
+	list := v.cell(binary.LittleEndian.Uint32(db[4:]), "", pos+4, path, "db 分段列表")
+	if list == nil {
+		return
+	}
+	if len(list) < 4*count {
+		v.issue(CheckCell, pos+2, path, "db 分段列表只能容纳 %d 段,分段数量为 %d", len(list)/4, count)
+		count = len(list) / 4
+	}
+	total := 0
+	for i := 0; i < count; i++ {
+		if segment := v.cell(binary.LittleEndian.Uint32(list[4*i:]), "", pos+4, path, "db 分段"); segment != nil {
+			total += min(len(segment), 0x3fd8)
+		}
+	}
+	if total < int(length) {
+		v.issue(CheckCell, pos, path, "db 分段共 %d 字节,小于数据长度 %d", total, length)
+	}
+}
+
+// security 沿 flink 遍历 sk 链表,检查链表的双向指针以及每个 sk 的引用计数与实际引用的键数是否一致。
+// 有键无法访问时只报告实际引用数大于引用计数的 sk
+func (v *validator) security() {
+	inList := make(map[uint32]bool)
+	for _, start := range v.skSeen {
+		if inList[start] {
+			continue
+		}
+		for cur := start; !inList[cur]; {
+			inList[cur] = true
+			v.report.SecurityDescriptors++
+			pos := int64(baseBlockSize) + int64(cur) + 4
+			d := v.cell(cur, "sk", pos, "", "sk 链表")
+			if d == nil || len(d) < 0x14 {
+				break
+			}
+			if size := int(binary.LittleEndian.Uint32(d[0x10:])); 0x14+size > len(d) {
+				v.issue(CheckCell, pos+0x10, "", "安全描述符长度 %d 超出 sk 记录", size)
+			}
+			if refs, count := binary.LittleEndian.Uint32(d[0xC:]), v.skRefs[cur]; int(refs) < count || (int(refs) > count && !v.incomplete) {
+				v.issue(CheckSecurity, pos+0xC, "", "sk 引用计数为 %d,实际被 %d 个键引用", refs, count)
+			}
+			next := binary.LittleEndian.Uint32(d[4:])
+			n := v.cell(next, "sk", pos+4, "", "sk 链表的 flink")
+			if n == nil || len(n) < 0xC {
+				break
+			}
+			if back := binary.LittleEndian.Uint32(n[8:]); back != cur {
+				v.issue(CheckSecurity, int64(baseBlockSize)+int64(next)+4+8, "", "sk 的 blink 为 %#x,应为 %#x", back, cur)
+			}
+			cur = next
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func validateTestHive() []byte {
+	root := &buildKey{name: "ROOT"}
+	alpha := root.add("Alpha")
+	alpha.values = append(alpha.values,
+		buildValue{name: "dword", typ: RegDWord, data: []byte{1, 0, 0, 0}},
+		buildValue{name: "string", typ: RegSZ, data: encodeUTF16("hello world", true)})
+	alpha.add("Child").add("Grand")
+	root.add("Beta").add("Gamma")
+	root.add("Delta")
+	return buildHive(root, "TEST")
+}
+
+func TestValidateClean(t *testing.T) {
+	report := Validate(NewRegistryFromBytes(validateTestHive()))
+	if !report.OK() {
+		t.Fatal(report)
+	}
+	if report.Bins != 1 || report.Keys != 7 || report.Values != 2 || report.SecurityDescriptors != 1 {
+		t.Fatalf("统计不符: %s", report)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if Validate(nil).OK() {
+		t.Fatal("nil 应报告问题")
+	}
+}
+
+func TestValidateCorruption(t *testing.T) {
+	clean := NewRegistryFromBytes(validateTestHive())
+	root := clean.Root().Nkrecord.Offset
+	alpha := clean.Open("Alpha").Nkrecord.Offset
+	grand := clean.Open(`Alpha\Child\Grand`).Nkrecord.Offset
+	u32 := func(b []byte, off int) uint32 { return binary.LittleEndian.Uint32(b[off:]) }
+	put := func(b []byte, off int, v uint32) { binary.LittleEndian.PutUint32(b[off:], v) }
+	// list 返回 nk 中 offset 处的指针所指 cell 的数据部分的位置
+	list := func(b []byte, nk, offset int) int { return baseBlockSize + int(u32(b, nk+offset)) + 4 }
+	sk := baseBlockSize + hbinHeaderLen + 4
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte)
+		check   ValidationCheck
+	}{
+		{"checksum", func(b []byte) { b[0x1FC] ^= 1 }, CheckChecksum},
+		{"sequence", func(b []byte) {
+			put(b, 0x4, 9)
+			put(b, 0x1FC, baseBlockChecksum(b))
+		}, CheckSequence},
+		{"file type", func(b []byte) {
+			put(b, 0x1C, 1)
+			put(b, 0x1FC, baseBlockChecksum(b))
+		}, CheckBaseBlock},
+		{"root pointer", func(b []byte) {
+			put(b, 0x24, 0x7FFFFFF0)
+			put(b, 0x1FC, baseBlockChecksum(b))
+		}, CheckPointer},
+		{"hbin offset", func(b []byte) { put(b, baseBlockSize+4, hbinAlignment) }, CheckHbin},
+		{"cell size", func(b []byte) { put(b, sk-4, u32(b, sk-4)-3) }, CheckCell},
+		{"dangling value", func(b []byte) { put(b, list(b, alpha, 0x28), 0x123450) }, CheckPointer},
+		{"dangling subkey list", func(b []byte) { put(b, alpha+0x1C, 0x7FFF0) }, CheckPointer},
+		{"subkey count", func(b []byte) { put(b, root+0x14, u32(b, root+0x14)+1) }, CheckSubkeyCount},
+		{"parent", func(b []byte) { put(b, alpha+0x10, uint32(grand-baseBlockSize-4)) }, CheckParent},
+		{"cycle", func(b []byte) {
+			put(b, grand+0x14, u32(b, root+0x14))
+			put(b, grand+0x1C, u32(b, root+0x1C))
+		}, CheckParent},
+		{"sk refcount", func(b []byte) { put(b, sk+0xC, 3) }, CheckSecurity},
+		{"lh hash", func(b []byte) { put(b, list(b, root, 0x1C)+8, 0xDEAD) }, CheckHash},
+		{"lf hint", func(b []byte) {
+			// 把根键的 lh 改为 lf,名称提示为子键名的前 4 个字符,第一项的提示错误
+			l := list(b, root, 0x1C)
+			copy(b[l:], "lf")
+			for i, name := range []string{"Alpha", "Beta", "Delta"} {
+				copy(b[l+8+8*i:l+12+8*i], name)
+			}
+			copy(b[l+8:], "Xlph")
+		}, CheckHash},
+		{"truncated", nil, CheckBaseBlock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := slices.Clone(clean.Buffers)
+			if tt.corrupt != nil {
+				tt.corrupt(b)
+			} else {
+				b = b[:len(b)-hbinAlignment/2]
+			}
+			report := Validate(NewRegistryFromBytes(b))
+			found := false
+			for _, issue := range report.Issues {
+				found = found || issue.Check == tt.check
+			}
+			if !found {
+				t.Fatalf("没有报告 %s 类的问题:\n%s", tt.check, report)
+			}
+		})
+	}
+}
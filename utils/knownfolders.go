@@ -0,0 +1,95 @@
+package utils
+
+import "strings"
+
+// KnownFolders 记录常见的 Shell 文件夹及 Known Folder GUID 对应的名称
+var KnownFolders = map[string]string{
+	// Shell 根文件夹
+	"{20D04FE0-3AEA-1069-A2D8-08002B30309D}": "My Computer",
+	"{450D8FBA-AD25-11D0-98A8-0800361B1103}": "My Documents",
+	"{208D2C60-3AEA-1069-A2D7-08002B30309D}": "My Network Places",
+	"{F02C1A0D-BE21-4350-88B0-7367FC96EF3C}": "Network",
+	"{645FF040-5081-101B-9F08-00AA002F954E}": "Recycle Bin",
+	"{21EC2020-3AEA-1069-A2DD-08002B30309D}": "Control Panel",
+	"{26EE0668-A00A-44D7-9371-BEB064C98683}": "Control Panel",
+	"{5399E694-6CE5-4D6C-8FCE-1D8870FDCBA0}": "Control Panel Home",
+	"{59031A47-3F72-44A7-89C5-5595FE6B30EE}": "Users Files",
+	"{031E4825-7B94-4DC3-B131-E946B44C8DD5}": "Libraries",
+	"{679F85CB-0220-4080-B29B-5540CC05AAB6}": "Quick Access",
+	"{871C5380-42A0-1069-A2EA-08002B30309D}": "Internet Explorer",
+	"{2227A280-3AEA-1069-A2DE-08002B30309D}": "Printers",
+	"{4336A54D-038B-4685-AB02-99BB52D3FB8B}": "Public",
+	"{018D5C66-4533-4307-9B53-224DE2ED1FE6}": "OneDrive",
+	"{D20EA4E1-3957-11D2-A40B-0C5020524153}": "Administrative Tools",
+	"{7007ACC7-3202-11D1-AAD2-00805FC1270E}": "Network Connections",
+	"{9343812E-1C37-4A49-A12E-4B2D810D956B}": "Search Home",
+	"{F3364BA0-65B9-11CE-A9BA-00AA004AE837}": "Shell File System Folder",
+	"{B4BFCC3A-DB2C-424C-B029-7FE99A87C641}": "Desktop",
+	"{D3162B92-9365-467A-956B-92703ACA08AF}": "Documents",
+	"{FDD39AD0-238F-46AF-ADB4-6C85480369C7}": "Documents",
+	"{088E3905-0323-4B02-9826-5D99428E115F}": "Downloads",
+	"{374DE290-123F-4565-9164-39C4925E467B}": "Downloads",
+	"{3DFDF296-DBEC-4FB4-81D1-6A3438BCF4DE}": "Music",
+	"{1CF1260C-4DD0-4EBB-811F-33C572699FDE}": "Music",
+	"{4BD8D571-6D19-48D3-BE97-422220080E43}": "Music",
+	"{24AD3AD4-A569-4530-98E1-AB02F9417AA8}": "Pictures",
+	"{3ADD1653-EB32-4CB0-BBD7-DFA0ABB5ACCA}": "Pictures",
+	"{33E28130-4E1E-4676-835A-98395C3BC3BB}": "Pictures",
+	"{F86FA3AB-70D2-4FC7-9C99-FCBF05467F3A}": "Videos",
+	"{A0953C92-50DC-43BF-BE83-3742FED03C9C}": "Videos",
+	"{18989B1D-99B5-455B-841C-AB7C74E4DDFC}": "Videos",
+	"{0DB7E03F-FC29-4DC6-9020-FF41B59E513A}": "3D Objects",
+	"{1777F761-68AD-4D8A-87BD-30B759FA33DD}": "Favorites",
+	"{323CA680-C24D-4099-B94D-446DD2D7249E}": "Favorites",
+	// 程序路径中常见的 Known Folder
+	"{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}": "%SystemRoot%\\System32",
+	"{D65231B0-B2F1-4857-A4CE-A8E7C6EA7D27}": "%SystemRoot%\\SysWOW64",
+	"{F38BF404-1D43-42F2-9305-67DE0B28FC23}": "%SystemRoot%",
+	"{905E63B6-C1BF-494E-B29C-65B732D3D21A}": "%ProgramFiles%",
+	"{6D809377-6AF0-444B-8957-A3773F02200E}": "%ProgramFiles%",
+	"{7C5A40EF-A0FB-4BFC-874A-C0F2E0B9FA8E}": "%ProgramFiles(x86)%",
+	"{F7F1ED05-9F6D-47A2-AAAE-29D317C6F066}": "%CommonProgramFiles%",
+	"{6365D5A7-0F0D-45E5-87F6-0DA56B6A4F7D}": "%CommonProgramFiles%",
+	"{DE974D24-D9C6-4D3E-BF91-F4455120B917}": "%CommonProgramFiles(x86)%",
+	"{0139D44E-6AFE-49F2-8690-3DAFCAE6FFB8}": "%ProgramData%\\Microsoft\\Windows\\Start Menu\\Programs",
+	"{A77F5D77-2E2B-44C3-A6A2-ABA601054A51}": "%AppData%\\Microsoft\\Windows\\Start Menu\\Programs",
+	"{625B53C3-AB48-4EC1-BA1F-A1EF4146FC19}": "%AppData%\\Microsoft\\Windows\\Start Menu",
+	"{A4115719-D62E-491D-AA7C-E74B8BE3B067}": "%ProgramData%\\Microsoft\\Windows\\Start Menu",
+	"{9E3995AB-1F9C-4F13-B827-48B24B6C7174}": "%AppData%\\Microsoft\\Internet Explorer\\Quick Launch\\User Pinned",
+	"{62AB5D82-FDC1-4DC3-A9DD-070D1D495D97}": "%ProgramData%",
+	"{3EB685DB-65F9-4CF6-A03A-E3EF65729F3D}": "%AppData%",
+	"{F1B32785-6FBA-4FCF-9D55-7B8E7F157091}": "%LocalAppData%",
+	"{A520A1A4-1780-4FF6-BD18-167343C5AF16}": "%LocalAppData%Low",
+	"{5E6C858F-0E22-4760-9AFE-EA3317B67173}": "%UserProfile%",
+	"{0762D272-C50A-4BB0-A382-697DCD729B80}": "%SystemDrive%\\Users",
+	"{DFDF76A2-C82A-4D63-906A-5644AC457385}": "%Public%",
+	"{C4AA340D-F20F-4863-AFEF-F87EF2E6BA25}": "%Public%\\Desktop",
+	"{B97D20BB-F46A-4C97-BA10-5E3608430854}": "%AppData%\\Microsoft\\Windows\\Start Menu\\Programs\\StartUp",
+	"{82A5EA35-D9CD-47C5-9629-E15D2F714E6E}": "%ProgramData%\\Microsoft\\Windows\\Start Menu\\Programs\\StartUp",
+	"{AE50C081-EBD2-438A-8655-8A092E34987A}": "%AppData%\\Microsoft\\Windows\\Recent",
+	"{8983036C-27C0-404B-8F08-102D10DCFD74}": "%AppData%\\Microsoft\\Windows\\SendTo",
+	"{B94237E7-57AC-4347-9151-B08C6C32D1F7}": "%ProgramData%\\Microsoft\\Windows\\Templates",
+	"{A63293E8-664E-48DB-A079-DF759E0509F7}": "%AppData%\\Microsoft\\Windows\\Templates",
+}
+
+// KnownFolderName 返回 GUID 对应的文件夹名称,GUID 可以带或不带大括号,不区分大小写
+func KnownFolderName(guid string) (string, bool) {
+	guid = strings.ToUpper(strings.Trim(guid, "{}"))
+	name, ok := KnownFolders["{"+guid+"}"]
+	return name, ok
+}
+
+// ResolveKnownFolderPath 把路径开头的 Known Folder GUID 替换为文件夹名称
+func ResolveKnownFolderPath(path string) string {
+	if !strings.HasPrefix(path, "{") {
+		return path
+	}
+	end := strings.Index(path, "}")
+	if end == -1 {
+		return path
+	}
+	if name, ok := KnownFolderName(path[:end+1]); ok {
+		return name + path[end+1:]
+	}
+	return path
+}
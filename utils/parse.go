@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"strings"
 )
 
 // unpackUint32BigEndian 函数用于从字节切片中按大端字节序解包出一个无符号 32 位整数
@@ -54,3 +55,25 @@ func UnpackUint64LittleEndian(d []byte) uint64 {
 	}
 	return result
 }
+
+// ParseMRUListEx 解析 MRUListEx 值,返回按最近使用排序的条目编号,以 0xFFFFFFFF 结束
+func ParseMRUListEx(data []byte) []uint32 {
+	result := make([]uint32, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		n := binary.LittleEndian.Uint32(data[i:])
+		if n == 0xFFFFFFFF {
+			break
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// ParseMRUList 解析 MRUList 字符串值,返回按最近使用排序的值名(每个字符为一个值名)
+func ParseMRUList(s string) []string {
+	result := make([]string, 0, len(s))
+	for _, c := range strings.TrimRight(s, "\x00") {
+		result = append(result, string(c))
+	}
+	return result
+}